@@ -1,15 +1,28 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"golang.org/x/exp/slog" // Change this
 
 	"github.com/dzhisl/license-manager/internal/config"
 	"github.com/dzhisl/license-manager/internal/http-server/server"
+	"github.com/dzhisl/license-manager/internal/jobs"
+	"github.com/dzhisl/license-manager/internal/lib/grace"
+	"github.com/dzhisl/license-manager/internal/lib/licensekey"
 	"github.com/dzhisl/license-manager/internal/lib/logger"
 	"github.com/dzhisl/license-manager/internal/lib/logger/sl"
+	"github.com/dzhisl/license-manager/internal/lib/signing"
+	"github.com/dzhisl/license-manager/internal/storage"
+	"github.com/dzhisl/license-manager/internal/storage/postgres"
 	"github.com/dzhisl/license-manager/internal/storage/sqlite"
 )
 
@@ -17,17 +30,89 @@ func main() {
 	cfg := config.MustLoad()
 	logger := logger.SetupLogger()
 
-	storage, err := sqlite.New(cfg.StoragePath)
+	storage, err := setupStorage(cfg)
 	if err != nil {
 		log.Fatalf("failed to initialize storage: %s", sl.Err(err))
 		logger.Error("failed to initialize storage", sl.Err(err))
 		os.Exit(1)
 	}
+	defer storage.Close()
 
-	r := server.SetupRouter(storage, &cfg.AuthData, logger)
+	// `api migrate ...` manages the schema and exits without starting the server
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(storage, os.Args[2:]); err != nil {
+			logger.Error("migration failed", sl.Err(err))
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.Storage.AutoMigrate {
+		if err := applyMigrations(storage, logger); err != nil {
+			logger.Error("failed to apply migrations", sl.Err(err))
+			os.Exit(1)
+		}
+	}
+
+	signingKey, err := signing.LoadOrCreateKey(cfg.Signing.KeyPath)
+	if err != nil {
+		logger.Error("failed to load signing key", sl.Err(err))
+		os.Exit(1)
+	}
+	logger.Info("signing key loaded", slog.String("public_key", signing.PublicKeyString(signingKey)))
+
+	// Background jobs and the server stop on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	sweeper := jobs.NewExpirySweeper(storage, grace.Policy{Days: cfg.Expiry.DefaultGraceDays}, logger, nil)
+	jobs.Start(ctx, logger, jobs.ReapSessions(storage, cfg.Sessions.ReapInterval, logger))
+	jobs.Start(ctx, logger, jobs.PruneNonces(storage, cfg.Signatures.PruneInterval, logger))
+	jobs.Start(ctx, logger, sweeper.Job(cfg.Expiry.SweepInterval))
+
+	r := server.SetupRouter(storage, cfg, signingKey, sweeper, logger)
+	logger.Info("storage initialized", slog.String("driver", cfg.Storage.Driver))
 	logger.Info("initializing server", slog.String("address", cfg.HTTPServer.Address))
-	if err := r.Run(cfg.HTTPServer.Address); err != nil {
+
+	srv := &http.Server{
+		Addr:         cfg.HTTPServer.Address,
+		Handler:      r,
+		ReadTimeout:  cfg.HTTPServer.Timeout,
+		WriteTimeout: cfg.HTTPServer.Timeout,
+		IdleTimeout:  cfg.HTTPServer.IdleTimeout,
+	}
+
+	serverErr := make(chan error, 1)
+	go func() { serverErr <- srv.ListenAndServe() }()
+
+	select {
+	case err := <-serverErr:
 		logger.Error("server failed", sl.Err(err))
 		os.Exit(1)
+	case <-ctx.Done():
+	}
+
+	logger.Info("shutting down server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("server shutdown failed", sl.Err(err))
+	}
+}
+
+// shutdownTimeout is how long in-flight requests get to finish on shutdown
+const shutdownTimeout = 10 * time.Second
+
+// setupStorage opens the storage backend selected by storage.driver
+func setupStorage(cfg *config.Config) (storage.Store, error) {
+	hasher := licensekey.NewHasher(cfg.LicenseKey.HashSecret, cfg.LicenseKey.Format())
+
+	switch cfg.Storage.Driver {
+	case "sqlite":
+		return sqlite.New(cfg.StoragePath, hasher)
+	case "postgres":
+		return postgres.New(cfg.Storage.DSN, hasher)
+	default:
+		return nil, fmt.Errorf("unknown storage driver: %q", cfg.Storage.Driver)
 	}
 }
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"golang.org/x/exp/slog"
+
+	"github.com/dzhisl/license-manager/internal/storage"
+)
+
+// applyMigrations brings the schema up to date on startup
+func applyMigrations(store storage.Store, logger *slog.Logger) error {
+	migrator, err := store.Migrator()
+	if err != nil {
+		return err
+	}
+
+	applied, err := migrator.Up()
+	for _, m := range applied {
+		logger.Info("migration applied", slog.Int("version", m.Version), slog.String("name", m.Name))
+	}
+	if err != nil {
+		return err
+	}
+
+	hashed, err := store.HashPlaintextKeys()
+	if hashed > 0 {
+		logger.Info("plaintext license keys hashed", slog.Int("count", hashed))
+	}
+	if err != nil {
+		return err
+	}
+
+	shortened, err := store.ShortenDisplayPrefixes()
+	if shortened > 0 {
+		logger.Info("license display prefixes shortened", slog.Int("count", shortened))
+	}
+
+	return err
+}
+
+// runMigrate implements the `migrate` subcommand:
+//
+//	migrate [up]       apply all pending migrations
+//	migrate down [N]   roll back the last N migrations (default 1)
+//	migrate status     print every migration and whether it is applied
+func runMigrate(store storage.Store, args []string) error {
+	migrator, err := store.Migrator()
+	if err != nil {
+		return err
+	}
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		applied, err := migrator.Up()
+		for _, m := range applied {
+			fmt.Printf("applied  %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("schema is up to date")
+		}
+
+		hashed, err := store.HashPlaintextKeys()
+		if hashed > 0 {
+			fmt.Printf("hashed %d plaintext license keys\n", hashed)
+		}
+		if err != nil {
+			return err
+		}
+
+		shortened, err := store.ShortenDisplayPrefixes()
+		if shortened > 0 {
+			fmt.Printf("shortened %d license display prefixes\n", shortened)
+		}
+		return err
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps: %q", args[1])
+			}
+		}
+
+		rolledBack, err := migrator.Down(steps)
+		for _, m := range rolledBack {
+			fmt.Printf("rolled back  %04d_%s\n", m.Version, m.Name)
+		}
+		return err
+
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-30s %s\n", s.Version, s.Name, state)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down or status", command)
+	}
+}
@@ -5,22 +5,106 @@ import (
 	"os"
 	"time"
 
+	"github.com/dzhisl/license-manager/internal/lib/licensekey"
 	"github.com/ilyakaznacheev/cleanenv"
 	"github.com/joho/godotenv" // Import godotenv package
 )
 
 // Config holds the application configuration.
 type Config struct {
-	StoragePath string     `yaml:"storage_path" env-required:"true"`
-	HTTPServer  HTTPServer `yaml:"http_server"`
-	AuthData    AuthData   `yaml:"auth_data"`
+	StoragePath string      `yaml:"storage_path"`
+	Storage     Storage     `yaml:"storage"`
+	HTTPServer  HTTPServer  `yaml:"http_server"`
+	AuthData    AuthData    `yaml:"auth_data"`
+	LicenseKey  LicenseKey  `yaml:"license_key"`
+	Signing     Signing     `yaml:"signing"`
+	Lease       Lease       `yaml:"lease"`
+	Sessions    Sessions    `yaml:"sessions"`
+	Expiry      Expiry      `yaml:"expiry"`
+	Trial       Trial       `yaml:"trial"`
+	HwidReset   HwidReset   `yaml:"hwid_reset"`
+	Fingerprint Fingerprint `yaml:"fingerprint"`
+	Signatures  Signatures  `yaml:"request_signing"`
 }
 
 // AuthData holds authentication credentials.
+// ApiKey is the root key, it has every scope, manages tenants and is meant for creating the scoped keys kept in the database.
 type AuthData struct {
 	ApiKey string `env:"API_KEY" env-required:"true"`
 }
 
+// Storage selects and configures the storage backend.
+type Storage struct {
+	Driver      string `yaml:"driver" env:"STORAGE_DRIVER" env-default:"sqlite"`
+	DSN         string `yaml:"dsn" env:"STORAGE_DSN"` // postgres connection string
+	AutoMigrate bool   `yaml:"auto_migrate" env:"STORAGE_AUTO_MIGRATE" env-default:"true"`
+}
+
+// LicenseKey describes the format of generated license keys.
+type LicenseKey struct {
+	Prefix       string `yaml:"prefix" env-default:"LIC"` // used for products without their own prefix
+	Groups       int    `yaml:"groups" env-default:"3"`
+	GroupSize    int    `yaml:"group_size" env-default:"5"`
+	AcceptLegacy bool   `yaml:"accept_legacy" env-default:"true"`      // accept keys issued before the format existed
+	HashSecret   string `env:"LICENSE_KEY_SECRET" env-required:"true"` // HMAC secret keys are stored under, never change it
+}
+
+// Format returns the format of generated license keys
+func (k LicenseKey) Format() licensekey.Format {
+	return licensekey.Format{
+		Prefix:       k.Prefix,
+		Groups:       k.Groups,
+		GroupSize:    k.GroupSize,
+		AcceptLegacy: k.AcceptLegacy,
+	}
+}
+
+// Signing holds the location of the Ed25519 key used to sign license files.
+type Signing struct {
+	KeyPath string `yaml:"key_path" env:"SIGNING_KEY_PATH" env-default:"./storage/signing.key"` // created on first start
+}
+
+// Lease configures the offline leases returned by license validation.
+type Lease struct {
+	OfflineWindow time.Duration `yaml:"offline_window" env-default:"72h"` // how long a client may run without validating online
+}
+
+// Sessions configures the heartbeat sessions of floating licenses.
+type Sessions struct {
+	HeartbeatTimeout time.Duration `yaml:"heartbeat_timeout" env-default:"5m"` // a session without a heartbeat for this long is released
+	ReapInterval     time.Duration `yaml:"reap_interval" env-default:"1m"`     // how often released sessions are deleted
+}
+
+// Expiry configures when licenses stop working and the job moving them to the "expired" status.
+type Expiry struct {
+	SweepInterval    time.Duration `yaml:"sweep_interval" env-default:"10m"`
+	DefaultGraceDays int           `yaml:"default_grace_days" env-default:"0"` // for products without their own grace period
+}
+
+// Trial bounds the length of trial licenses.
+type Trial struct {
+	DefaultDays int `yaml:"default_days" env-default:"14"` // used when the request doesn't give a length
+	MaxDays     int `yaml:"max_days" env-default:"30"`
+}
+
+// HwidReset limits how often customers can unbind a machine themselves through /unbind-license.
+type HwidReset struct {
+	Limit    int           `yaml:"limit" env-default:"3"`      // resets per window
+	Window   time.Duration `yaml:"window" env-default:"720h"`  // rolling, 30 days by default
+	Cooldown time.Duration `yaml:"cooldown" env-default:"24h"` // minimum time between two resets
+}
+
+// Fingerprint configures how machines are recognized by their hardware fingerprint after their HWID changed.
+type Fingerprint struct {
+	Threshold float64 `yaml:"threshold" env-default:"0.6"` // share of the known components that must still match
+}
+
+// Signatures configures the HMAC signed requests of API keys created with request signing.
+type Signatures struct {
+	MaxSkew       time.Duration `yaml:"max_skew" env-default:"5m"`        // how far the timestamp of a request may be from the server clock
+	PruneInterval time.Duration `yaml:"prune_interval" env-default:"10m"` // how often nonces too old to matter are deleted
+}
+
 // HTTPServer holds HTTP server configuration.
 type HTTPServer struct {
 	Address     string        `yaml:"address" env-default:"localhost:8080"`
@@ -51,5 +135,50 @@ func MustLoad() *Config {
 		log.Fatalf("error reading config file: %s", err)
 	}
 
+	switch cfg.Storage.Driver {
+	case "sqlite":
+		if cfg.StoragePath == "" {
+			log.Fatal("storage_path is required for the sqlite driver")
+		}
+	case "postgres":
+		if cfg.Storage.DSN == "" {
+			log.Fatal("storage.dsn (STORAGE_DSN) is required for the postgres driver")
+		}
+	default:
+		log.Fatalf("unknown storage driver: %q", cfg.Storage.Driver)
+	}
+
+	if cfg.LicenseKey.Groups < 1 || cfg.LicenseKey.Groups > 8 || cfg.LicenseKey.GroupSize < 3 || cfg.LicenseKey.GroupSize > 8 {
+		log.Fatal("license_key.groups must be 1-8 and license_key.group_size 3-8")
+	}
+	if err := licensekey.ValidatePrefix(cfg.LicenseKey.Prefix); err != nil {
+		log.Fatalf("license_key.prefix: %s", err)
+	}
+	if cfg.Lease.OfflineWindow <= 0 {
+		log.Fatal("lease.offline_window must be positive")
+	}
+	if cfg.Sessions.HeartbeatTimeout <= 0 || cfg.Sessions.ReapInterval <= 0 {
+		log.Fatal("sessions.heartbeat_timeout and sessions.reap_interval must be positive")
+	}
+	if cfg.Expiry.SweepInterval <= 0 {
+		log.Fatal("expiry.sweep_interval must be positive")
+	}
+	if cfg.Expiry.DefaultGraceDays < 0 {
+		log.Fatal("expiry.default_grace_days must not be negative")
+	}
+	if cfg.Trial.DefaultDays < 1 || cfg.Trial.DefaultDays > cfg.Trial.MaxDays {
+		log.Fatal("trial.default_days must be between 1 and trial.max_days")
+	}
+	if cfg.HwidReset.Limit < 1 || cfg.HwidReset.Window <= 0 || cfg.HwidReset.Cooldown < 0 {
+		log.Fatal("hwid_reset.limit and hwid_reset.window must be positive, hwid_reset.cooldown must not be negative")
+	}
+	if cfg.Fingerprint.Threshold <= 0 || cfg.Fingerprint.Threshold > 1 {
+		log.Fatal("fingerprint.threshold must be above 0 and at most 1")
+	}
+
+	if cfg.Signatures.MaxSkew <= 0 || cfg.Signatures.PruneInterval <= 0 {
+		log.Fatal("request_signing.max_skew and request_signing.prune_interval must be positive")
+	}
+
 	return &cfg
 }
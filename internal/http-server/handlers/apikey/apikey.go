@@ -0,0 +1,275 @@
+package apikey
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/dzhisl/license-manager/internal/http-server/response"
+	"github.com/dzhisl/license-manager/internal/lib/apikey"
+	"github.com/dzhisl/license-manager/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+type apiKeyAdder interface {
+	AddApiKey(apiKey *storage.ApiKey, key string) (int64, error)
+}
+
+type apiKeyLister interface {
+	GetApiKeys() ([]storage.ApiKey, error)
+}
+
+type apiKeyRevoker interface {
+	RevokeApiKey(id int64) error
+}
+
+type signingSecretSetter interface {
+	SetApiKeySigningSecret(id int64, sealedSecret string) error
+}
+
+// secretSealer encrypts signing secrets with the server secret
+type secretSealer interface {
+	Seal(plaintext string) (string, error)
+}
+
+type apiKeyRoleSetter interface {
+	GetApiKeyById(id int64) (*storage.ApiKey, error)
+	SetApiKeyRole(id int64, role apikey.Role) error
+}
+
+// AddInputData represents a new API key, it needs a role, scopes or both
+type AddInputData struct {
+	Name      string      `json:"name" binding:"required,max=100"`
+	Role      apikey.Role `json:"role" binding:"omitempty,oneof=viewer support billing admin"`
+	Scopes    []string    `json:"scopes"`               // on top of the scopes of the role, see lib/apikey
+	ExpiresAt *time.Time  `json:"expires_at,omitempty"` // never expires if not set
+	// RequestSigning gives the key a signing secret, the key then only accepts signed requests
+	RequestSigning bool `json:"request_signing"`
+}
+
+// SetRoleInputData changes the role of an API key, an empty role removes it
+type SetRoleInputData struct {
+	ApiKeyId int64       `json:"api_key_id" binding:"required"`
+	Role     apikey.Role `json:"role" binding:"omitempty,oneof=viewer support billing admin"`
+}
+
+// ApiKeyRef identifies an API key
+type ApiKeyRef struct {
+	ApiKeyId int64 `json:"api_key_id" binding:"required"`
+}
+
+// ApiKeyOutput describes an API key, Key and SigningSecret are only set when they were just created
+type ApiKeyOutput struct {
+	ApiKeyId       int64       `json:"api_key_id"`
+	Name           string      `json:"name"`
+	Key            string      `json:"key,omitempty"`
+	SigningSecret  string      `json:"signing_secret,omitempty"` // see pkg/reqsign
+	RequestSigning bool        `json:"request_signing"`
+	KeyPrefix      string      `json:"key_prefix"`
+	Role           apikey.Role `json:"role,omitempty"`
+	Scopes         []string    `json:"scopes"`
+	Granted        []string    `json:"granted"` // the scopes of the role and of the key together
+	CreatedAt      time.Time   `json:"created_at"`
+	ExpiresAt      *time.Time  `json:"expires_at,omitempty"`
+	LastUsedAt     *time.Time  `json:"last_used_at,omitempty"`
+	RevokedAt      *time.Time  `json:"revoked_at,omitempty"`
+}
+
+// SigningSecretOutput is a new signing secret of an API key
+type SigningSecretOutput struct {
+	ApiKeyId      int64  `json:"api_key_id"`
+	SigningSecret string `json:"signing_secret"`
+}
+
+// AddApiKeyHandler creates an API key with the given scopes, the key is only returned here.
+// callerScopes are the scopes of the key making the request, the new key can't get any other.
+func AddApiKeyHandler(c *gin.Context, adder apiKeyAdder, sealer secretSealer, callerScopes []string) {
+	var input AddInputData
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.InvalidInputError(c, err)
+		return
+	}
+
+	if input.Role == "" && len(input.Scopes) == 0 {
+		response.Error(c, "An API key needs a role or scopes", http.StatusBadRequest, nil)
+		return
+	}
+	if err := apikey.ValidateScopes(input.Scopes); err != nil {
+		response.InvalidInputError(c, err)
+		return
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		response.Error(c, "expires_at must be in the future", http.StatusBadRequest, nil)
+		return
+	}
+	if missing := apikey.Missing(callerScopes, apikey.Grant(input.Role, input.Scopes)); missing != "" {
+		response.Forbidden(c, missing)
+		return
+	}
+
+	if input.Scopes == nil {
+		input.Scopes = []string{}
+	}
+
+	key, err := apikey.Generate()
+	if err != nil {
+		response.InternalError(c, "Failed to generate API key", err)
+		return
+	}
+
+	apiKey := storage.ApiKey{Name: input.Name, Role: input.Role, Scopes: input.Scopes, ExpiresAt: input.ExpiresAt}
+	var signingSecret string
+	if input.RequestSigning {
+		if signingSecret, apiKey.SigningSecret, err = newSigningSecret(sealer); err != nil {
+			response.InternalError(c, "Failed to generate signing secret", err)
+			return
+		}
+	}
+
+	if _, err := adder.AddApiKey(&apiKey, key); err != nil {
+		response.InternalError(c, "Failed to add API key", err)
+		return
+	}
+
+	output := apiKeyOutput(apiKey)
+	output.Key = key
+	output.SigningSecret = signingSecret
+
+	response.Ok(c, "API key added! Store it now, it cannot be retrieved again", output)
+}
+
+// GetApiKeysHandler responds with every API key, revoked ones included
+func GetApiKeysHandler(c *gin.Context, lister apiKeyLister) {
+	apiKeys, err := lister.GetApiKeys()
+	if err != nil {
+		response.InternalError(c, "Failed to get API keys", err)
+		return
+	}
+
+	output := []ApiKeyOutput{}
+	for _, apiKey := range apiKeys {
+		output = append(output, apiKeyOutput(apiKey))
+	}
+
+	response.Ok(c, "API keys received", output)
+}
+
+// RevokeApiKeyHandler stops an API key from working
+func RevokeApiKeyHandler(c *gin.Context, revoker apiKeyRevoker) {
+	var input ApiKeyRef
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.InvalidInputError(c, err)
+		return
+	}
+
+	if err := revoker.RevokeApiKey(input.ApiKeyId); err != nil {
+		if errors.Is(err, storage.ErrApiKeyNotFound) {
+			response.Error(c, "API key not found", http.StatusNotFound, nil)
+			return
+		}
+		response.InternalError(c, "Failed to revoke API key", err)
+		return
+	}
+
+	response.Ok(c, "API key revoked successfully", nil)
+}
+
+// SetApiKeyRoleHandler changes the role of an API key, its own scopes stay as they are.
+// callerScopes are the scopes of the key making the request, the key can't end up with any other.
+func SetApiKeyRoleHandler(c *gin.Context, setter apiKeyRoleSetter, callerScopes []string) {
+	var input SetRoleInputData
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.InvalidInputError(c, err)
+		return
+	}
+
+	apiKey, err := setter.GetApiKeyById(input.ApiKeyId)
+	if err != nil {
+		if errors.Is(err, storage.ErrApiKeyNotFound) {
+			response.Error(c, "API key not found", http.StatusNotFound, nil)
+			return
+		}
+		response.InternalError(c, "Failed to get API key", err)
+		return
+	}
+	if missing := apikey.Missing(callerScopes, apikey.Grant(input.Role, apiKey.Scopes)); missing != "" {
+		response.Forbidden(c, missing)
+		return
+	}
+
+	if err := setter.SetApiKeyRole(input.ApiKeyId, input.Role); err != nil {
+		if errors.Is(err, storage.ErrApiKeyNotFound) {
+			response.Error(c, "API key not found", http.StatusNotFound, nil)
+			return
+		}
+		response.InternalError(c, "Failed to set API key role", err)
+		return
+	}
+
+	response.Ok(c, "API key role updated successfully", nil)
+}
+
+// RotateSigningSecretHandler gives an API key a new signing secret, the old one stops working right away.
+// Keys without a signing secret get one and only accept signed requests from then on.
+func RotateSigningSecretHandler(c *gin.Context, setter signingSecretSetter, sealer secretSealer) {
+	var input ApiKeyRef
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.InvalidInputError(c, err)
+		return
+	}
+
+	signingSecret, sealed, err := newSigningSecret(sealer)
+	if err != nil {
+		response.InternalError(c, "Failed to generate signing secret", err)
+		return
+	}
+
+	if err := setter.SetApiKeySigningSecret(input.ApiKeyId, sealed); err != nil {
+		if errors.Is(err, storage.ErrApiKeyNotFound) {
+			response.Error(c, "API key not found", http.StatusNotFound, nil)
+			return
+		}
+		response.InternalError(c, "Failed to set signing secret", err)
+		return
+	}
+
+	response.Ok(c, "Signing secret rotated! Store it now, it cannot be retrieved again", SigningSecretOutput{
+		ApiKeyId:      input.ApiKeyId,
+		SigningSecret: signingSecret,
+	})
+}
+
+// newSigningSecret returns a new signing secret and its sealed form for the database
+func newSigningSecret(sealer secretSealer) (string, string, error) {
+	secret, err := apikey.GenerateSigningSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	sealed, err := sealer.Seal(secret)
+	if err != nil {
+		return "", "", err
+	}
+
+	return secret, sealed, nil
+}
+
+func apiKeyOutput(apiKey storage.ApiKey) ApiKeyOutput {
+	return ApiKeyOutput{
+		ApiKeyId:       apiKey.ID,
+		Name:           apiKey.Name,
+		KeyPrefix:      apiKey.DisplayPrefix,
+		Role:           apiKey.Role,
+		Scopes:         apiKey.Scopes,
+		Granted:        apikey.Grant(apiKey.Role, apiKey.Scopes),
+		RequestSigning: apiKey.SigningSecret != "",
+		CreatedAt:      apiKey.CreatedAt,
+		ExpiresAt:      apiKey.ExpiresAt,
+		LastUsedAt:     apiKey.LastUsedAt,
+		RevokedAt:      apiKey.RevokedAt,
+	}
+}
@@ -0,0 +1,37 @@
+package expiry
+
+import (
+	"net/http"
+
+	"github.com/dzhisl/license-manager/internal/http-server/response"
+	"github.com/dzhisl/license-manager/internal/jobs"
+	"github.com/gin-gonic/gin"
+)
+
+// sweeper is the background job moving expired licenses to the "expired" status
+type sweeper interface {
+	Sweep() (jobs.SweepResult, error)
+	LastRun() (jobs.SweepResult, bool)
+}
+
+// SweeperStatusHandler responds with the result of the latest expiry sweep
+func SweeperStatusHandler(c *gin.Context, sweeper sweeper) {
+	result, ok := sweeper.LastRun()
+	if !ok {
+		response.Error(c, "Expiry sweeper has not run yet", http.StatusNotFound, nil)
+		return
+	}
+
+	response.Ok(c, "Expiry sweeper status received", result)
+}
+
+// RunSweeperHandler runs the expiry sweeper right away
+func RunSweeperHandler(c *gin.Context, sweeper sweeper) {
+	result, err := sweeper.Sweep()
+	if err != nil {
+		response.InternalError(c, "Expiry sweep failed", err)
+		return
+	}
+
+	response.Ok(c, "Expiry sweep finished", result)
+}
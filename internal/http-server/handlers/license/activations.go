@@ -0,0 +1,170 @@
+package license
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dzhisl/license-manager/internal/http-server/response"
+	"github.com/dzhisl/license-manager/internal/lib/hwidreset"
+	"github.com/dzhisl/license-manager/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+type activationLister interface {
+	licenseResolver
+	GetActivations(licenseId int64) ([]storage.Activation, error)
+}
+
+type hwidResetLister interface {
+	licenseResolver
+	GetHwidResets(licenseId int64) ([]storage.HwidReset, error)
+}
+
+type machineDeactivator interface {
+	licenseResolver
+	DeactivateMachine(licenseId int64, hwid string) error
+}
+
+type maxActivationsSetter interface {
+	licenseResolver
+	SetMaxActivations(id int64, max int) error
+}
+
+// DeactivateInputData represents the machine to remove from a license
+type DeactivateInputData struct {
+	LicenseRef
+	HWID string `json:"hwid" binding:"required"`
+}
+
+// MaxActivationsInputData represents the new activation limit of a license
+type MaxActivationsInputData struct {
+	LicenseRef
+	MaxActivations int `json:"max_activations" binding:"required,min=1"`
+}
+
+// HwidResetsOutput lists the machines the owner of a license unbound, NextResetAt is left out
+// when they can unbind one right away
+type HwidResetsOutput struct {
+	Resets      []storage.HwidReset `json:"resets"`
+	NextResetAt *time.Time          `json:"next_reset_at,omitempty"`
+}
+
+// GetActivationsHandler responds with the machines a license is activated on,
+// the license is given by the License or LicenseId query parameter
+func GetActivationsHandler(c *gin.Context, lister activationLister) {
+	ref := LicenseRef{License: c.Query("License")}
+	if licenseId := c.Query("LicenseId"); licenseId != "" {
+		id, err := strconv.ParseInt(licenseId, 10, 64)
+		if err != nil {
+			response.InvalidInputError(c, fmt.Errorf("LicenseId must be an integer"))
+			return
+		}
+		ref.LicenseId = id
+	}
+
+	licenseId, ok := resolveLicenseId(c, lister, ref)
+	if !ok {
+		return
+	}
+
+	activations, err := lister.GetActivations(licenseId)
+	if err != nil {
+		response.InternalError(c, "Failed to get activations", err)
+		return
+	}
+
+	response.Ok(c, "Activations received", activations)
+}
+
+// DeactivateMachineHandler frees the seat a machine takes on a license
+func DeactivateMachineHandler(c *gin.Context, deactivator machineDeactivator) {
+	var input DeactivateInputData
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.InvalidInputError(c, err)
+		return
+	}
+
+	licenseId, ok := resolveLicenseId(c, deactivator, input.LicenseRef)
+	if !ok {
+		return
+	}
+
+	if err := deactivator.DeactivateMachine(licenseId, input.HWID); err != nil {
+		if errors.Is(err, storage.ErrActivationNotFound) {
+			response.Error(c, "License is not activated on this machine", http.StatusNotFound, nil)
+			return
+		}
+		response.InternalError(c, "Failed to deactivate machine", err)
+		return
+	}
+
+	response.Ok(c, "Machine deactivated successfully", nil)
+}
+
+// SetMaxActivationsHandler changes how many machines a license may be activated on
+func SetMaxActivationsHandler(c *gin.Context, setter maxActivationsSetter) {
+	var input MaxActivationsInputData
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.InvalidInputError(c, err)
+		return
+	}
+
+	licenseId, ok := resolveLicenseId(c, setter, input.LicenseRef)
+	if !ok {
+		return
+	}
+
+	if err := setter.SetMaxActivations(licenseId, input.MaxActivations); err != nil {
+		if errors.Is(err, storage.ErrLicenseNotFound) {
+			response.Error(c, "License not found", http.StatusNotFound, nil)
+			return
+		}
+		response.InternalError(c, "Failed to set max activations", err)
+		return
+	}
+
+	response.Ok(c, "Max activations updated successfully", nil)
+}
+
+// GetHwidResetsHandler responds with the machines the owner of a license unbound and when they can unbind the next one,
+// the license is given by the License or LicenseId query parameter
+func GetHwidResetsHandler(c *gin.Context, lister hwidResetLister, policy hwidreset.Policy) {
+	ref := LicenseRef{License: c.Query("License")}
+	if licenseId := c.Query("LicenseId"); licenseId != "" {
+		id, err := strconv.ParseInt(licenseId, 10, 64)
+		if err != nil {
+			response.InvalidInputError(c, fmt.Errorf("LicenseId must be an integer"))
+			return
+		}
+		ref.LicenseId = id
+	}
+
+	licenseId, ok := resolveLicenseId(c, lister, ref)
+	if !ok {
+		return
+	}
+
+	resets, err := lister.GetHwidResets(licenseId)
+	if err != nil {
+		response.InternalError(c, "Failed to get HWID resets", err)
+		return
+	}
+
+	output := HwidResetsOutput{Resets: []storage.HwidReset{}}
+	times := make([]time.Time, 0, len(resets))
+	for _, reset := range resets {
+		output.Resets = append(output.Resets, reset)
+		times = append(times, reset.CreatedAt)
+	}
+	if next := policy.NextAllowed(times); next.After(time.Now()) {
+		next = next.UTC()
+		output.NextResetAt = &next
+	}
+
+	response.Ok(c, "HWID resets received", output)
+}
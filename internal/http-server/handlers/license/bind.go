@@ -1,63 +1,124 @@
 package license
 
 import (
+	"errors"
+	"net/http"
+	"time"
+
 	"github.com/dzhisl/license-manager/internal/http-server/response"
+	"github.com/dzhisl/license-manager/internal/lib/fingerprint"
+	"github.com/dzhisl/license-manager/internal/lib/hwidreset"
+	"github.com/dzhisl/license-manager/internal/storage"
 	"github.com/gin-gonic/gin"
 )
 
-// LicenseBinder defines an interface for binding a license to an HWID
+// ownedLicenseResolver looks up a license by key and checks that the caller owns it
+type ownedLicenseResolver interface {
+	licenseResolver
+	ownershipChecker
+}
+
+// LicenseBinder defines an interface for activating a license on an HWID
 type LicenseBinder interface {
-	BindHwidToLicenseByLicense(license, hwid string) error
+	ownedLicenseResolver
+	ActivateMachine(licenseId int64, hwid, label string, fp fingerprint.Fingerprint, policy fingerprint.Policy, proof string) (*storage.Activation, error)
 }
 
-// LicenseUnbinder defines an interface for unbinding a license from an HWID
+// LicenseUnbinder defines an interface for freeing the seat an HWID takes on a license, within the reset limits
 type LicenseUnbinder interface {
-	UnbindHwidFromLicense(license string) error
+	ownedLicenseResolver
+	ResetMachine(licenseId int64, hwid string, policy hwidreset.Policy, now time.Time, proof string) (time.Time, error)
 }
 
 // LicenseActionInput represents the common incoming data structure for license actions
 type LicenseActionInput struct {
 	License string `json:"license" binding:"required"`
-	HWID    string `json:"hwid,omitempty"` // HWID is optional, only used for binding
+	HWID    string `json:"hwid" binding:"required,max=255"`
+	Label   string `json:"label,omitempty" binding:"max=100"` // only used for binding
+	// Fingerprint is only used for binding, see validateInputData
+	Fingerprint fingerprint.Fingerprint `json:"fingerprint,omitempty" binding:"omitempty,max=16,dive,keys,required,max=32,endkeys,required,max=128"`
+	OwnershipProof
 }
 
-// processLicenseAction handles the common logic for binding and unbinding licenses
-// It takes an action function, a success message, and manages error handling.
-func processLicenseAction(c *gin.Context, action func(input LicenseActionInput) error, successMessage string) bool {
-	var input LicenseActionInput
-
+// prepareLicenseAction reads the input of a public license action, resolves its license and checks
+// that the caller owns it, see proveOwnership. It returns the license ID and how ownership was proven.
+// It writes the error response itself and returns false when any of it fails.
+func prepareLicenseAction(c *gin.Context, resolver ownedLicenseResolver, input *LicenseActionInput, allowFirst bool) (int64, string, bool) {
 	// Validate incoming JSON data
-	if err := c.ShouldBindJSON(&input); err != nil {
+	if err := c.ShouldBindJSON(input); err != nil {
 		response.InvalidInputError(c, err)
-		return false
+		return 0, "", false
 	}
 
-	// Perform the provided license action
-	if err := action(input); err != nil {
-		response.InternalError(c, "Operation failed", err)
-		return false
+	licenseId, ok := resolveLicenseId(c, resolver, LicenseRef{License: input.License})
+	if !ok {
+		return 0, "", false
 	}
 
-	response.Ok(c, successMessage, nil)
-	return true
+	proof, ok := proveOwnership(c, resolver, licenseId, input.OwnershipProof, allowFirst)
+	if !ok {
+		return 0, "", false
+	}
+
+	return licenseId, proof, true
+}
+
+// writeLicenseActionError responds with why binding or unbinding a license failed
+func writeLicenseActionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, storage.ErrActivationLimit):
+		response.Error(c, "License is activated on the maximum number of machines", http.StatusForbidden, nil)
+	case errors.Is(err, storage.ErrTrialUsed):
+		response.Error(c, "A trial has already been used on this machine", http.StatusForbidden, nil)
+	case errors.Is(err, storage.ErrActivationNotFound):
+		response.Error(c, "License is not activated on this machine", http.StatusNotFound, nil)
+	default:
+		response.InternalError(c, "Operation failed", err)
+	}
 }
 
-// BindLicenseHandler handles binding a license to an HWID
-func BindLicenseHandler(c *gin.Context, licenseBinder LicenseBinder) {
-	// Define the action for binding a license to an HWID
-	action := func(input LicenseActionInput) error {
-		return licenseBinder.BindHwidToLicenseByLicense(input.License, input.HWID)
+// BindLicenseHandler handles activating a license on an HWID.
+// Once the license is activated anywhere, new machines need proof of ownership.
+func BindLicenseHandler(c *gin.Context, licenseBinder LicenseBinder, fingerprintPolicy fingerprint.Policy) {
+	var input LicenseActionInput
+
+	licenseId, proof, ok := prepareLicenseAction(c, licenseBinder, &input, true)
+	if !ok {
+		return
+	}
+
+	if _, err := licenseBinder.ActivateMachine(licenseId, input.HWID, input.Label, input.Fingerprint, fingerprintPolicy, proof); err != nil {
+		writeLicenseActionError(c, err)
+		return
 	}
-	// Process the action
-	processLicenseAction(c, action, "License bound successfully")
+
+	response.Ok(c, "License bound successfully", nil)
+}
+
+// UnbindOutput tells the owner of a license when they can unbind a machine again
+type UnbindOutput struct {
+	NextResetAt time.Time `json:"next_reset_at"`
 }
 
-// UnbindLicenseHandler handles unbinding a license from an HWID
-func UnbindLicenseHandler(c *gin.Context, licenseUnbinder LicenseUnbinder) {
-	// Define the action for unbinding a license
-	action := func(input LicenseActionInput) error {
-		return licenseUnbinder.UnbindHwidFromLicense(input.License)
+// UnbindLicenseHandler handles deactivating a license on an HWID, it always needs proof of ownership.
+// Owners can only unbind as often as policy allows, admins use /deactivate-machine instead.
+func UnbindLicenseHandler(c *gin.Context, licenseUnbinder LicenseUnbinder, policy hwidreset.Policy) {
+	var input LicenseActionInput
+
+	licenseId, proof, ok := prepareLicenseAction(c, licenseUnbinder, &input, false)
+	if !ok {
+		return
 	}
-	// Process the action
-	processLicenseAction(c, action, "License unbound successfully")
+
+	next, err := licenseUnbinder.ResetMachine(licenseId, input.HWID, policy, time.Now(), proof)
+	if err != nil {
+		if errors.Is(err, storage.ErrResetLimit) {
+			response.TooManyRequests(c, "HWID reset limit reached", next)
+			return
+		}
+		writeLicenseActionError(c, err)
+		return
+	}
+
+	response.Ok(c, "License unbound successfully", UnbindOutput{NextResetAt: next.UTC()})
 }
@@ -1,43 +1,71 @@
 package license
 
 import (
-	"math/rand"
+	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/dzhisl/license-manager/internal/http-server/response"
+	"github.com/dzhisl/license-manager/internal/lib/licensekey"
+	"github.com/dzhisl/license-manager/internal/lib/renewal"
+	"github.com/dzhisl/license-manager/internal/storage"
 	"github.com/gin-gonic/gin"
 )
 
 // licenseAdder defines an interface for adding a license
 type licenseAdder interface {
-	AddLicense(license, username, status string, hwid *string, expiresAt time.Time) (int64, error)
+	AddLicense(license *storage.License, key, secret string) (int64, error)
+	GetProductByCode(code string) (*storage.Product, error)
 }
 
 // AddInputData represents the incoming data structure
 type AddInputData struct {
-	UserId string `json:"user_id" binding:"required"`
+	UserId  string `json:"user_id" binding:"required"`
+	Product string `json:"product,omitempty"` // optional product code
+	// Type is "subscription" (the default), "trial" or "perpetual"
+	Type string `json:"type,omitempty" binding:"omitempty,oneof=subscription trial perpetual"`
+	// Years, Months and Days are how long a subscription or trial runs,
+	// a month for subscriptions and TrialLimits.DefaultDays for trials by default
+	Years  int `json:"years,omitempty" binding:"min=0"`
+	Months int `json:"months,omitempty" binding:"min=0"`
+	Days   int `json:"days,omitempty" binding:"min=0"`
+	// UpdatesUntil is the last release date a perpetual license covers, every release if not set
+	UpdatesUntil *time.Time `json:"updates_until,omitempty"`
+	// MaxActivations is how many machines may use the license, defaults to 1
+	MaxActivations int `json:"max_activations,omitempty" binding:"omitempty,min=1"`
+	// MaxSessions is how many floating sessions may be checked out at once, defaults to 1
+	MaxSessions int `json:"max_sessions,omitempty" binding:"omitempty,min=1"`
 }
 
 // OutputData represents the data structure to return
 type OutputData struct {
-	UserId    string    `json:"user_id"`
-	License   string    `json:"license"`
-	Status    string    `json:"status"`
-	Hwid      string    `json:"hwid"`
-	ExpiresAt time.Time `json:"expires_at"`
+	LicenseId      int64      `json:"license_id"`
+	UserId         string     `json:"user_id"`
+	Product        string     `json:"product,omitempty"`
+	License        string     `json:"license"` // the only time the full key is ever returned
+	Secret         string     `json:"secret"`  // proves ownership on /bind-license and /unbind-license, only returned here
+	Type           string     `json:"type"`
+	Status         string     `json:"status"`
+	MaxActivations int        `json:"max_activations"`
+	MaxSessions    int        `json:"max_sessions"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"` // not set for perpetual licenses
+	UpdatesUntil   *time.Time `json:"updates_until,omitempty"`
 }
 
-// seededRand is used for generating random licenses.
-var seededRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+// TrialLimits bounds how long trial licenses run
+type TrialLimits struct {
+	DefaultDays int
+	MaxDays     int
+}
 
-const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
-const licenseLength = 10
+// maxKeyAttempts bounds how often a key is regenerated after colliding with an existing one
+const maxKeyAttempts = 5
 
 // AddLicenseHandler generates a random license, sets the status to "active",
-// sets the HWID to an empty string, and sets expires_at to 1 month from now.
+// allows a single machine unless told otherwise, and sets expires_at to the end of its term.
 // It also handles errors in both input validation and license addition.
-func AddLicenseHandler(c *gin.Context, licenseAdder licenseAdder) {
+func AddLicenseHandler(c *gin.Context, licenseAdder licenseAdder, keyFormat licensekey.Format, trialLimits TrialLimits) {
 	var input AddInputData
 
 	// Bind incoming JSON data to the AddInputData struct
@@ -46,37 +74,125 @@ func AddLicenseHandler(c *gin.Context, licenseAdder licenseAdder) {
 		return
 	}
 
-	// Generate a random license and prepare default values
-	license := generateRandomLicense(licenseLength)
-	status := "active"
-	hwid := ""
-	expiresAt := time.Now().AddDate(0, 1, 0)
+	if input.Type == "" {
+		input.Type = storage.TypeSubscription
+	}
+	expiresAt, err := licenseExpiry(input, trialLimits, time.Now())
+	if err != nil {
+		response.InvalidInputError(c, err)
+		return
+	}
+
+	// Resolve the product the license is sold for, if any
+	var productId *int64
+	if input.Product != "" {
+		product, err := licenseAdder.GetProductByCode(input.Product)
+		if err != nil {
+			if errors.Is(err, storage.ErrProductNotFound) {
+				response.Error(c, "Product not found", http.StatusNotFound, nil)
+				return
+			}
+			response.InternalError(c, "Failed to get product", err)
+			return
+		}
+		productId = &product.ID
+		keyFormat = keyFormat.WithPrefix(product.KeyPrefix)
+	}
+
+	if input.MaxActivations == 0 {
+		input.MaxActivations = 1
+	}
+	if input.MaxSessions == 0 {
+		input.MaxSessions = 1
+	}
+
+	// Prepare default values, the key itself is generated below
+	license := storage.License{
+		UserId:         input.UserId,
+		ProductId:      productId,
+		Type:           input.Type,
+		Status:         "active",
+		MaxActivations: input.MaxActivations,
+		MaxSessions:    input.MaxSessions,
+		ExpiresAt:      expiresAt,
+		UpdatesUntil:   input.UpdatesUntil,
+	}
+
+	secret, err := newToken()
+	if err != nil {
+		response.InternalError(c, "Failed to generate license secret", err)
+		return
+	}
+
+	// Attempt to add the license, generating a fresh key whenever it collides with an existing one
+	var key string
+	var licenseId int64
+	for attempt := 0; attempt < maxKeyAttempts; attempt++ {
+		key, err = keyFormat.Generate()
+		if err != nil {
+			response.InternalError(c, "Failed to generate license key", err)
+			return
+		}
 
-	// Attempt to add the license to the system via the licenseAdder
-	if _, err := licenseAdder.AddLicense(license, input.UserId, status, &hwid, expiresAt); err != nil {
+		licenseId, err = licenseAdder.AddLicense(&license, key, secret)
+		if !errors.Is(err, storage.ErrLicenseExists) {
+			break
+		}
+	}
+	if err != nil {
 		response.InternalError(c, "Failed to add license", err)
 		return
 	}
 
 	// Prepare response data
 	output := OutputData{
-		UserId:    input.UserId,
-		License:   license,
-		Status:    status,
-		Hwid:      hwid,
-		ExpiresAt: expiresAt,
+		LicenseId:      licenseId,
+		UserId:         license.UserId,
+		Product:        input.Product,
+		License:        key,
+		Secret:         secret,
+		Type:           license.Type,
+		Status:         license.Status,
+		MaxActivations: license.MaxActivations,
+		MaxSessions:    license.MaxSessions,
+		ExpiresAt:      license.ExpiresAt,
+		UpdatesUntil:   license.UpdatesUntil,
 	}
 
-	// Respond with success and generated data
-	response.Ok(c, "License added!", output)
+	// Respond with success and generated data, only hashes of the key and secret are stored
+	response.Ok(c, "License added! Store the key and secret now, they cannot be retrieved again", output)
 }
 
-// generateRandomLicense generates a random alphanumeric license of the given length
-func generateRandomLicense(length int) string {
-	b := make([]byte, length)
-	charsetLength := len(charset) // Cache length outside of the loop for efficiency
-	for i := range b {
-		b[i] = charset[seededRand.Intn(charsetLength)]
+// licenseExpiry returns the expiry date of a new license of the type in input, nil if it never expires
+func licenseExpiry(input AddInputData, trialLimits TrialLimits, now time.Time) (*time.Time, error) {
+	term := renewal.Term{Years: input.Years, Months: input.Months, Days: input.Days}
+	if input.UpdatesUntil != nil && input.Type != storage.TypePerpetual {
+		return nil, fmt.Errorf("updates_until is only used by perpetual licenses")
+	}
+
+	switch input.Type {
+	case storage.TypePerpetual:
+		if !term.IsZero() {
+			return nil, fmt.Errorf("perpetual licenses don't expire, leave out years, months and days")
+		}
+		return nil, nil
+	case storage.TypeTrial:
+		if input.MaxActivations > 1 || input.MaxSessions > 1 {
+			return nil, fmt.Errorf("trial licenses are limited to a single machine")
+		}
+		if term.IsZero() {
+			term.Days = trialLimits.DefaultDays
+		}
+		expiresAt := term.AddTo(now)
+		if expiresAt.After(now.AddDate(0, 0, trialLimits.MaxDays)) {
+			return nil, fmt.Errorf("trial licenses can't run longer than %d days", trialLimits.MaxDays)
+		}
+		return &expiresAt, nil
+	default:
+		if term.IsZero() {
+			term.Months = 1
+		}
+		expiresAt := term.AddTo(now)
+		return &expiresAt, nil
 	}
-	return string(b)
 }
@@ -5,14 +5,15 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// licenseAdder defines an interface for adding a license
+// licenseDeleter defines an interface for deleting a license
 type licenseDeleter interface {
-	DeleteLicenseById(username string) error
+	licenseResolver
+	DeleteLicenseById(id int64) error
 }
 
 // DeleteInputData represents the incoming data structure
 type DeleteInputData struct {
-	UserId string `json:"user_id" binding:"required"`
+	LicenseRef
 }
 
 func DeletelicenseHandler(c *gin.Context, licenseDeleter licenseDeleter) {
@@ -23,14 +24,19 @@ func DeletelicenseHandler(c *gin.Context, licenseDeleter licenseDeleter) {
 		return
 	}
 
-	err := licenseDeleter.DeleteLicenseById(input.UserId)
+	licenseId, ok := resolveLicenseId(c, licenseDeleter, input.LicenseRef)
+	if !ok {
+		return
+	}
+
+	err := licenseDeleter.DeleteLicenseById(licenseId)
 	if err != nil {
 		response.InternalError(c, "Failed to delete license", err)
 		return
 	}
 
-	output := map[string]string{
-		"UserId": input.UserId,
+	output := map[string]int64{
+		"license_id": licenseId,
 	}
 
 	response.Ok(c, "License deleted successfully", output)
@@ -0,0 +1,195 @@
+package license
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/dzhisl/license-manager/internal/http-server/response"
+	"github.com/dzhisl/license-manager/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// entitlementGetter looks up what a product grants and how a license deviates from it
+type entitlementGetter interface {
+	GetProductEntitlements(productId int64) ([]storage.Entitlement, error)
+	GetLicenseEntitlements(licenseId int64) ([]storage.EntitlementOverride, error)
+}
+
+type licenseEntitlementLister interface {
+	licenseResolver
+	entitlementGetter
+}
+
+type licenseEntitlementSetter interface {
+	licenseResolver
+	SetLicenseEntitlement(licenseId int64, override storage.EntitlementOverride) error
+}
+
+type licenseEntitlementRemover interface {
+	licenseResolver
+	RemoveLicenseEntitlement(licenseId int64, feature string) error
+}
+
+// EntitlementOutput is a feature the license grants, Limit is left out when it is unlimited
+type EntitlementOutput struct {
+	Feature string `json:"feature"`
+	Limit   *int64 `json:"limit,omitempty"`
+}
+
+// OverrideOutput is a per license change to the entitlements of its product
+type OverrideOutput struct {
+	Feature string `json:"feature"`
+	Limit   *int64 `json:"limit,omitempty"`
+	Enabled bool   `json:"enabled"`
+}
+
+// LicenseEntitlementsOutput lists what a license grants and the overrides it comes from
+type LicenseEntitlementsOutput struct {
+	Entitlements []EntitlementOutput `json:"entitlements"`
+	Overrides    []OverrideOutput    `json:"overrides"`
+}
+
+// LicenseEntitlementInputData represents an override of one feature on a license
+type LicenseEntitlementInputData struct {
+	LicenseRef
+	Feature string `json:"feature" binding:"required,max=64"`
+	Limit   *int64 `json:"limit" binding:"omitempty,min=0"` // null means unlimited
+	// Enabled false takes a feature of the product away from the license, defaults to true
+	Enabled *bool `json:"enabled"`
+}
+
+// RemoveLicenseEntitlementInputData identifies the override to drop
+type RemoveLicenseEntitlementInputData struct {
+	LicenseRef
+	Feature string `json:"feature" binding:"required"`
+}
+
+// GetLicenseEntitlementsHandler responds with the effective entitlements and the overrides of a license,
+// the license is given by the License or LicenseId query parameter
+func GetLicenseEntitlementsHandler(c *gin.Context, lister licenseEntitlementLister) {
+	ref := LicenseRef{License: c.Query("License")}
+	if licenseId := c.Query("LicenseId"); licenseId != "" {
+		id, err := strconv.ParseInt(licenseId, 10, 64)
+		if err != nil {
+			response.InvalidInputError(c, fmt.Errorf("LicenseId must be an integer"))
+			return
+		}
+		ref.LicenseId = id
+	}
+
+	licenseData, ok := resolveLicense(c, lister, ref)
+	if !ok {
+		return
+	}
+
+	entitlements, err := effectiveEntitlements(lister, licenseData)
+	if err != nil {
+		response.InternalError(c, "Failed to get entitlements", err)
+		return
+	}
+
+	overrides, err := lister.GetLicenseEntitlements(licenseData.ID)
+	if err != nil {
+		response.InternalError(c, "Failed to get entitlements", err)
+		return
+	}
+
+	output := LicenseEntitlementsOutput{Entitlements: entitlements, Overrides: []OverrideOutput{}}
+	for _, override := range overrides {
+		output.Overrides = append(output.Overrides, OverrideOutput{Feature: override.Feature, Limit: override.Limit, Enabled: override.Enabled})
+	}
+
+	response.Ok(c, "Entitlements received", output)
+}
+
+// SetLicenseEntitlementHandler grants, limits or revokes a feature for a single license
+func SetLicenseEntitlementHandler(c *gin.Context, setter licenseEntitlementSetter) {
+	var input LicenseEntitlementInputData
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.InvalidInputError(c, err)
+		return
+	}
+
+	licenseData, ok := resolveLicense(c, setter, input.LicenseRef)
+	if !ok {
+		return
+	}
+
+	override := storage.EntitlementOverride{Feature: input.Feature, Limit: input.Limit, Enabled: true}
+	if input.Enabled != nil {
+		override.Enabled = *input.Enabled
+	}
+
+	if err := setter.SetLicenseEntitlement(licenseData.ID, override); err != nil {
+		response.InternalError(c, "Failed to set entitlement", err)
+		return
+	}
+
+	response.Ok(c, "Entitlement updated successfully", nil)
+}
+
+// RemoveLicenseEntitlementHandler drops an override, the license falls back to what its product grants
+func RemoveLicenseEntitlementHandler(c *gin.Context, remover licenseEntitlementRemover) {
+	var input RemoveLicenseEntitlementInputData
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.InvalidInputError(c, err)
+		return
+	}
+
+	licenseId, ok := resolveLicenseId(c, remover, input.LicenseRef)
+	if !ok {
+		return
+	}
+
+	if err := remover.RemoveLicenseEntitlement(licenseId, input.Feature); err != nil {
+		if errors.Is(err, storage.ErrEntitlementNotFound) {
+			response.Error(c, "License has no override for this feature", http.StatusNotFound, nil)
+			return
+		}
+		response.InternalError(c, "Failed to remove entitlement", err)
+		return
+	}
+
+	response.Ok(c, "Entitlement removed successfully", nil)
+}
+
+// effectiveEntitlements returns what the license grants: the entitlements of its product
+// with the overrides of the license applied, sorted by feature
+func effectiveEntitlements(getter entitlementGetter, licenseData *storage.License) ([]EntitlementOutput, error) {
+	features := make(map[string]*int64)
+
+	if licenseData.ProductId != nil {
+		entitlements, err := getter.GetProductEntitlements(*licenseData.ProductId)
+		if err != nil {
+			return nil, err
+		}
+		for _, entitlement := range entitlements {
+			features[entitlement.Feature] = entitlement.Limit
+		}
+	}
+
+	overrides, err := getter.GetLicenseEntitlements(licenseData.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, override := range overrides {
+		if override.Enabled {
+			features[override.Feature] = override.Limit
+		} else {
+			delete(features, override.Feature)
+		}
+	}
+
+	output := make([]EntitlementOutput, 0, len(features))
+	for feature, limit := range features {
+		output = append(output, EntitlementOutput{Feature: feature, Limit: limit})
+	}
+	sort.Slice(output, func(i, j int) bool { return output[i].Feature < output[j].Feature })
+
+	return output, nil
+}
@@ -6,25 +6,31 @@ import (
 )
 
 type LicenseFreezer interface {
-	FreezeLicenseById(UserId string) error
-	UnfreezeLicenseById(UserId string) error
+	licenseResolver
+	FreezeLicenseById(id int64) error
+	UnfreezeLicenseById(id int64) error
 }
 
 // FreezeInputData represents the incoming data structure
 type FreezeInputData struct {
-	UserId string `json:"user_id" binding:"required"`
+	LicenseRef
 }
 
 // handleLicenseAction is a generic handler for freezing or unfreezing licenses
-func handleLicenseAction(c *gin.Context, licenseAction func(string) error, successMessage string) {
+func handleLicenseAction(c *gin.Context, resolver licenseResolver, licenseAction func(int64) error, successMessage string) {
 	var input FreezeInputData
 	if err := c.ShouldBindJSON(&input); err != nil {
 		response.InvalidInputError(c, err)
 		return
 	}
 
+	licenseId, ok := resolveLicenseId(c, resolver, input.LicenseRef)
+	if !ok {
+		return
+	}
+
 	// Execute the passed license action (freeze/unfreeze)
-	if err := licenseAction(input.UserId); err != nil {
+	if err := licenseAction(licenseId); err != nil {
 		response.InternalError(c, "Operaion failed", err)
 		return
 	}
@@ -35,10 +41,10 @@ func handleLicenseAction(c *gin.Context, licenseAction func(string) error, succe
 
 // FreezeLicenseHandler handles the freezing of a license
 func FreezeLicenseHandler(c *gin.Context, licenseFreezer LicenseFreezer) {
-	handleLicenseAction(c, licenseFreezer.FreezeLicenseById, "License frozen successfully")
+	handleLicenseAction(c, licenseFreezer, licenseFreezer.FreezeLicenseById, "License frozen successfully")
 }
 
 // UnfreezeLicenseHandler handles the unfreezing of a license
 func UnfreezeLicenseHandler(c *gin.Context, licenseFreezer LicenseFreezer) {
-	handleLicenseAction(c, licenseFreezer.UnfreezeLicenseById, "License unfrozen successfully")
+	handleLicenseAction(c, licenseFreezer, licenseFreezer.UnfreezeLicenseById, "License unfrozen successfully")
 }
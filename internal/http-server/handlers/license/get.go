@@ -2,35 +2,55 @@ package license
 
 import (
 	"fmt"
+	"strconv"
 
 	"github.com/dzhisl/license-manager/internal/http-server/response"
-	"github.com/dzhisl/license-manager/internal/storage/sqlite"
+	"github.com/dzhisl/license-manager/internal/storage"
 	"github.com/gin-gonic/gin"
 )
 
-type licenseGetterByUserId interface {
-	GetLicenseById(Id string) (*sqlite.UserLicense, error)
-	GetLicenseByLicense(License string) (*sqlite.UserLicense, error)
+type licenseGetter interface {
+	GetLicenseById(id int64) (*storage.License, error)
+	GetLicenseByLicense(License string) (*storage.License, error)
+	GetLicensesByUserId(userId string) ([]storage.License, error)
 }
 
-// GetLicenseHandler responds with license information based on either UserId or License
-func GetLicenseHandler(c *gin.Context, licenseGetter licenseGetterByUserId) {
+// GetLicenseHandler responds with license information based on LicenseId or License,
+// or with every license of the user when UserId is given
+func GetLicenseHandler(c *gin.Context, licenseGetter licenseGetter) {
 	userId := c.Query("UserId")
 	license := c.Query("License")
+	licenseId := c.Query("LicenseId")
 
-	// Check if both parameters are empty
-	if userId == "" && license == "" {
-		response.InvalidInputError(c, fmt.Errorf("either UserId or License parameter is required"))
+	// Check if all parameters are empty
+	if userId == "" && license == "" && licenseId == "" {
+		response.InvalidInputError(c, fmt.Errorf("either UserId, License or LicenseId parameter is required"))
 		return
 	}
 
-	var licenseData *sqlite.UserLicense
+	// A user may own several licenses, return all of them
+	if userId != "" {
+		licenses, err := licenseGetter.GetLicensesByUserId(userId)
+		if err != nil {
+			response.InternalError(c, "Failed to get licenses", err)
+			return
+		}
+		response.Ok(c, "Licenses received", licenses)
+		return
+	}
+
+	var licenseData *storage.License
 	var err error
 
-	// Check for UserId first, then License
-	if userId != "" {
-		licenseData, err = licenseGetter.GetLicenseById(userId)
-	} else if license != "" {
+	// Check for LicenseId first, then License
+	if licenseId != "" {
+		id, parseErr := strconv.ParseInt(licenseId, 10, 64)
+		if parseErr != nil {
+			response.InvalidInputError(c, fmt.Errorf("LicenseId must be an integer"))
+			return
+		}
+		licenseData, err = licenseGetter.GetLicenseById(id)
+	} else {
 		licenseData, err = licenseGetter.GetLicenseByLicense(license)
 	}
 
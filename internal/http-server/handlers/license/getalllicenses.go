@@ -2,12 +2,12 @@ package license
 
 import (
 	"github.com/dzhisl/license-manager/internal/http-server/response"
-	"github.com/dzhisl/license-manager/internal/storage/sqlite"
+	"github.com/dzhisl/license-manager/internal/storage"
 	"github.com/gin-gonic/gin"
 )
 
 type allLicensesGetter interface {
-	GetAllLicenses() ([]sqlite.UserLicense, error)
+	GetAllLicenses() ([]storage.License, error)
 }
 
 func GetAllLicensesHandler(c *gin.Context, allLicensesGetter allLicensesGetter) {
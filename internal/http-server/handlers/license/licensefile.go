@@ -0,0 +1,89 @@
+package license
+
+import (
+	"crypto/ed25519"
+	"time"
+
+	"github.com/dzhisl/license-manager/internal/http-server/response"
+	"github.com/dzhisl/license-manager/internal/lib/fingerprint"
+	"github.com/dzhisl/license-manager/internal/lib/grace"
+	"github.com/dzhisl/license-manager/internal/lib/licensekey"
+	"github.com/dzhisl/license-manager/pkg/licensefile"
+	"github.com/gin-gonic/gin"
+)
+
+// licenseFileIssuer defines the required methods for issuing offline license files
+type licenseFileIssuer interface {
+	licenseValidator
+}
+
+// LicenseFileOutput represents the issued license file
+type LicenseFileOutput struct {
+	LicenseFile string     `json:"license_file"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"` // nil for perpetual licenses
+}
+
+// IssueLicenseFileHandler validates the license like ValidateLicenseHandler and returns
+// a signed license file the client can verify offline with pkg/licensefile
+func IssueLicenseFileHandler(c *gin.Context, issuer licenseFileIssuer, keyFormat licensekey.Format, defaultPolicy grace.Policy, fingerprintPolicy fingerprint.Policy, signingKey ed25519.PrivateKey) {
+	var input validateInputData
+
+	// Bind and validate input data
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.InvalidInputError(c, err)
+		return
+	}
+
+	licenseData, policy, verr := checkLicense(issuer, keyFormat, defaultPolicy, fingerprintPolicy, input)
+	if verr != nil {
+		writeValidationError(c, verr)
+		return
+	}
+
+	doc := licensefile.Document{
+		LicenseId: licenseData.ID,
+		KeyPrefix: licenseData.DisplayPrefix,
+		UserId:    licenseData.UserId,
+		HWID:      input.HWID,
+		Type:      licenseData.Type,
+		IssuedAt:  time.Now().UTC(),
+	}
+	if licenseData.ExpiresAt != nil {
+		expiresAt := licenseData.ExpiresAt.UTC()
+		doc.ExpiresAt = &expiresAt
+		if policy.Days > 0 {
+			graceEndsAt := policy.EndsAt(expiresAt).UTC()
+			doc.GraceEndsAt = &graceEndsAt
+		}
+	}
+	if licenseData.UpdatesUntil != nil {
+		updatesUntil := licenseData.UpdatesUntil.UTC()
+		doc.UpdatesUntil = &updatesUntil
+	}
+
+	entitlements, err := effectiveEntitlements(issuer, licenseData)
+	if err != nil {
+		response.InternalError(c, "failed to get entitlements", err)
+		return
+	}
+	for _, entitlement := range entitlements {
+		doc.Entitlements = append(doc.Entitlements, licensefile.Entitlement{Feature: entitlement.Feature, Limit: entitlement.Limit})
+	}
+
+	if licenseData.ProductId != nil {
+		product, err := issuer.GetProductById(*licenseData.ProductId)
+		if err != nil {
+			response.InternalError(c, "failed to get product", err)
+			return
+		}
+		doc.Product = product.Code
+	}
+
+	file, err := licensefile.Sign(doc, signingKey)
+	if err != nil {
+		response.InternalError(c, "failed to sign license file", err)
+		return
+	}
+
+	response.Ok(c, "license file issued", LicenseFileOutput{LicenseFile: file, ExpiresAt: doc.ExpiresAt})
+}
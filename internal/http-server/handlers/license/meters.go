@@ -0,0 +1,249 @@
+package license
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dzhisl/license-manager/internal/http-server/response"
+	"github.com/dzhisl/license-manager/internal/lib/grace"
+	"github.com/dzhisl/license-manager/internal/lib/licensekey"
+	"github.com/dzhisl/license-manager/internal/lib/usage"
+	"github.com/dzhisl/license-manager/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// meterGetter returns the meters of a license as of now
+type meterGetter interface {
+	GetMeters(licenseId int64, now time.Time) ([]storage.Meter, error)
+}
+
+type meterIncrementer interface {
+	licenseLookup
+	IncrementMeter(licenseId int64, name string, amount int64, idempotencyKey string, now time.Time) (*storage.MeterIncrement, error)
+}
+
+type usageReader interface {
+	licenseLookup
+	meterGetter
+}
+
+type meterLister interface {
+	licenseResolver
+	meterGetter
+}
+
+type meterSetter interface {
+	licenseResolver
+	SetMeter(meter *storage.Meter) error
+}
+
+type meterRemover interface {
+	licenseResolver
+	RemoveMeter(licenseId int64, name string) error
+}
+
+// IncrementUsageInputData represents usage reported by a client app.
+// Retrying with the same IdempotencyKey counts the usage once.
+type IncrementUsageInputData struct {
+	License        string `json:"license" binding:"required"`
+	Meter          string `json:"meter" binding:"required"`
+	Amount         int64  `json:"amount" binding:"omitempty,min=1,max=1000000000"` // defaults to 1
+	IdempotencyKey string `json:"idempotency_key" binding:"required,max=128"`
+}
+
+// UsageInputData identifies the license whose usage a client app asks for
+type UsageInputData struct {
+	License string `json:"license" binding:"required"`
+}
+
+// SetMeterInputData represents the quota of a meter, changing the period starts the usage over
+type SetMeterInputData struct {
+	LicenseRef
+	Meter  string       `json:"meter" binding:"required,max=64"`
+	Quota  int64        `json:"quota" binding:"min=0"`
+	Period usage.Period `json:"period" binding:"required,oneof=day month year lifetime"`
+}
+
+// RemoveMeterInputData identifies the meter to delete
+type RemoveMeterInputData struct {
+	LicenseRef
+	Meter string `json:"meter" binding:"required"`
+}
+
+// MeterOutput is the usage of a meter in its current period, ResetsAt is left out for lifetime meters
+type MeterOutput struct {
+	Meter       string       `json:"meter"`
+	Quota       int64        `json:"quota"`
+	Period      usage.Period `json:"period"`
+	Used        int64        `json:"used"`
+	Remaining   int64        `json:"remaining"`
+	PeriodStart time.Time    `json:"period_start"`
+	ResetsAt    *time.Time   `json:"resets_at,omitempty"`
+}
+
+// IncrementUsageOutput is the meter after an increment, Replayed is set when the idempotency key was used before
+type IncrementUsageOutput struct {
+	MeterOutput
+	Replayed bool `json:"replayed"`
+}
+
+// IncrementUsageHandler counts usage on a meter of the license, as long as the license is usable and the quota allows it
+func IncrementUsageHandler(c *gin.Context, incrementer meterIncrementer, keyFormat licensekey.Format, defaultPolicy grace.Policy) {
+	var input IncrementUsageInputData
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.InvalidInputError(c, err)
+		return
+	}
+	if input.Amount == 0 {
+		input.Amount = 1
+	}
+
+	licenseData, _, verr := lookupLicense(incrementer, keyFormat, defaultPolicy, input.License)
+	if verr != nil {
+		writeValidationError(c, verr)
+		return
+	}
+
+	incremented, err := incrementer.IncrementMeter(licenseData.ID, input.Meter, input.Amount, input.IdempotencyKey, time.Now())
+	if err != nil {
+		if errors.Is(err, storage.ErrMeterNotFound) {
+			response.Error(c, "License has no such meter", http.StatusNotFound, nil)
+			return
+		}
+		if errors.Is(err, storage.ErrQuotaExceeded) {
+			response.Error(c, "quota exceeded", http.StatusTooManyRequests, nil)
+			return
+		}
+		response.InternalError(c, "Failed to increment usage", err)
+		return
+	}
+
+	response.Ok(c, "Usage recorded", IncrementUsageOutput{
+		MeterOutput: meterOutput(incremented.Meter),
+		Replayed:    incremented.Replayed,
+	})
+}
+
+// UsageHandler responds with the current usage of every meter of the license, for client apps
+func UsageHandler(c *gin.Context, reader usageReader, keyFormat licensekey.Format, defaultPolicy grace.Policy) {
+	var input UsageInputData
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.InvalidInputError(c, err)
+		return
+	}
+
+	licenseData, _, verr := lookupLicense(reader, keyFormat, defaultPolicy, input.License)
+	if verr != nil {
+		writeValidationError(c, verr)
+		return
+	}
+
+	writeMeters(c, reader, licenseData.ID)
+}
+
+// GetMetersHandler responds with the meters of a license,
+// the license is given by the License or LicenseId query parameter
+func GetMetersHandler(c *gin.Context, lister meterLister) {
+	ref := LicenseRef{License: c.Query("License")}
+	if licenseId := c.Query("LicenseId"); licenseId != "" {
+		id, err := strconv.ParseInt(licenseId, 10, 64)
+		if err != nil {
+			response.InvalidInputError(c, fmt.Errorf("LicenseId must be an integer"))
+			return
+		}
+		ref.LicenseId = id
+	}
+
+	licenseData, ok := resolveLicense(c, lister, ref)
+	if !ok {
+		return
+	}
+
+	writeMeters(c, lister, licenseData.ID)
+}
+
+// SetMeterHandler adds a meter to a license or changes its quota and period
+func SetMeterHandler(c *gin.Context, setter meterSetter) {
+	var input SetMeterInputData
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.InvalidInputError(c, err)
+		return
+	}
+
+	licenseData, ok := resolveLicense(c, setter, input.LicenseRef)
+	if !ok {
+		return
+	}
+
+	meter := storage.Meter{LicenseId: licenseData.ID, Name: input.Meter, Quota: input.Quota, Period: input.Period}
+	if err := setter.SetMeter(&meter); err != nil {
+		response.InternalError(c, "Failed to set meter", err)
+		return
+	}
+
+	response.Ok(c, "Meter updated successfully", meterOutput(meter))
+}
+
+// RemoveMeterHandler deletes a meter of a license along with its usage
+func RemoveMeterHandler(c *gin.Context, remover meterRemover) {
+	var input RemoveMeterInputData
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.InvalidInputError(c, err)
+		return
+	}
+
+	licenseId, ok := resolveLicenseId(c, remover, input.LicenseRef)
+	if !ok {
+		return
+	}
+
+	if err := remover.RemoveMeter(licenseId, input.Meter); err != nil {
+		if errors.Is(err, storage.ErrMeterNotFound) {
+			response.Error(c, "License has no such meter", http.StatusNotFound, nil)
+			return
+		}
+		response.InternalError(c, "Failed to remove meter", err)
+		return
+	}
+
+	response.Ok(c, "Meter removed successfully", nil)
+}
+
+// writeMeters responds with the meters of the license as of now
+func writeMeters(c *gin.Context, getter meterGetter, licenseId int64) {
+	meters, err := getter.GetMeters(licenseId, time.Now())
+	if err != nil {
+		response.InternalError(c, "Failed to get meters", err)
+		return
+	}
+
+	output := []MeterOutput{}
+	for _, meter := range meters {
+		output = append(output, meterOutput(meter))
+	}
+
+	response.Ok(c, "Usage received", output)
+}
+
+func meterOutput(meter storage.Meter) MeterOutput {
+	output := MeterOutput{
+		Meter:       meter.Name,
+		Quota:       meter.Quota,
+		Period:      meter.Period,
+		Used:        meter.Used,
+		Remaining:   max(meter.Quota-meter.Used, 0),
+		PeriodStart: meter.PeriodStart.UTC(),
+	}
+	if resetsAt, ok := meter.Period.End(meter.PeriodStart); ok {
+		output.ResetsAt = &resetsAt
+	}
+
+	return output
+}
@@ -0,0 +1,144 @@
+package license
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/dzhisl/license-manager/internal/http-server/response"
+	"github.com/dzhisl/license-manager/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// How a caller proved they own a license, written to the transaction log
+const (
+	proofSecret          = "secret"
+	proofBoundHWID       = "bound_hwid"
+	proofFirstActivation = "first_activation" // nothing to prove yet, the license isn't activated anywhere
+)
+
+// ownershipChecker looks up what proves a caller owns a license
+type ownershipChecker interface {
+	GetActivations(licenseId int64) ([]storage.Activation, error)
+	CheckLicenseSecret(id int64, secret string) (bool, error)
+	LogOwnershipProofFailure(licenseId int64) error
+}
+
+type licenseSecretResetter interface {
+	licenseResolver
+	ResetLicenseSecret(id int64, secret string) error
+}
+
+// LicenseSecretOutput is a new license secret, the only time it is returned
+type LicenseSecretOutput struct {
+	LicenseId int64  `json:"license_id"`
+	Secret    string `json:"secret"`
+}
+
+// OwnershipProof is what the public bind and unbind endpoints accept as proof that the caller owns the license
+type OwnershipProof struct {
+	// Secret is the one returned when the license was created or its secret was reset
+	Secret string `json:"secret,omitempty" binding:"max=128"`
+	// BoundHWID is an HWID the license is currently activated on
+	BoundHWID string `json:"bound_hwid,omitempty" binding:"max=255"`
+}
+
+// Why ownership of a license couldn't be proven
+var (
+	errProofRequired = errors.New("proof of ownership required")
+	errInvalidProof  = errors.New("invalid proof of ownership")
+)
+
+// checkOwnership checks proof against the license and its activations and returns how ownership was proven.
+// With allowFirst, a license that isn't activated on any machine needs no proof.
+// A failed proof is logged and fails with errProofRequired or errInvalidProof.
+func checkOwnership(checker ownershipChecker, licenseId int64, activations []storage.Activation, proof OwnershipProof, allowFirst bool) (string, error) {
+	if allowFirst && len(activations) == 0 {
+		return proofFirstActivation, nil
+	}
+
+	if proof.Secret != "" {
+		valid, err := checker.CheckLicenseSecret(licenseId, proof.Secret)
+		if err != nil {
+			return "", fmt.Errorf("failed to check license secret: %w", err)
+		}
+		if valid {
+			return proofSecret, nil
+		}
+	}
+
+	if proof.BoundHWID != "" {
+		for _, activation := range activations {
+			if activation.HWID == proof.BoundHWID {
+				return proofBoundHWID, nil
+			}
+		}
+	}
+
+	if err := checker.LogOwnershipProofFailure(licenseId); err != nil {
+		return "", fmt.Errorf("failed to log ownership proof failure: %w", err)
+	}
+
+	if proof.Secret == "" && proof.BoundHWID == "" {
+		return "", errProofRequired
+	}
+	return "", errInvalidProof
+}
+
+// proveOwnership checks proof against the license and returns how ownership was proven, see checkOwnership.
+// It writes the error response itself and returns false when the proof doesn't hold.
+func proveOwnership(c *gin.Context, checker ownershipChecker, licenseId int64, proof OwnershipProof, allowFirst bool) (string, bool) {
+	activations, err := checker.GetActivations(licenseId)
+	if err != nil {
+		response.InternalError(c, "Failed to get activations", err)
+		return "", false
+	}
+
+	method, err := checkOwnership(checker, licenseId, activations, proof, allowFirst)
+	switch {
+	case errors.Is(err, errProofRequired):
+		response.Error(c, "Proof of ownership required: send the license secret or a bound HWID", http.StatusForbidden, nil)
+		return "", false
+	case errors.Is(err, errInvalidProof):
+		response.Error(c, "Invalid proof of ownership", http.StatusForbidden, nil)
+		return "", false
+	case err != nil:
+		response.InternalError(c, "Failed to check proof of ownership", err)
+		return "", false
+	}
+
+	return method, true
+}
+
+// ResetLicenseSecretHandler issues a new ownership secret for a license, the old one stops working.
+// Licenses created before secrets existed get their first one this way.
+func ResetLicenseSecretHandler(c *gin.Context, resetter licenseSecretResetter) {
+	var input LicenseRef
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.InvalidInputError(c, err)
+		return
+	}
+
+	licenseId, ok := resolveLicenseId(c, resetter, input)
+	if !ok {
+		return
+	}
+
+	secret, err := newToken()
+	if err != nil {
+		response.InternalError(c, "Failed to generate license secret", err)
+		return
+	}
+
+	if err := resetter.ResetLicenseSecret(licenseId, secret); err != nil {
+		if errors.Is(err, storage.ErrLicenseNotFound) {
+			response.Error(c, "License not found", http.StatusNotFound, nil)
+			return
+		}
+		response.InternalError(c, "Failed to reset license secret", err)
+		return
+	}
+
+	response.Ok(c, "License secret reset! Store it now, it cannot be retrieved again", LicenseSecretOutput{LicenseId: licenseId, Secret: secret})
+}
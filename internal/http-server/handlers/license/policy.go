@@ -0,0 +1,38 @@
+package license
+
+import (
+	"time"
+
+	"github.com/dzhisl/license-manager/internal/lib/grace"
+	"github.com/dzhisl/license-manager/internal/storage"
+)
+
+// productGetter looks up the product a license was issued for
+type productGetter interface {
+	GetProductById(id int64) (*storage.Product, error)
+}
+
+// expiryPolicy returns the grace policy of the license's product, falling back to defaultPolicy
+func expiryPolicy(getter productGetter, licenseData *storage.License, defaultPolicy grace.Policy) (grace.Policy, error) {
+	if licenseData.ProductId == nil {
+		return defaultPolicy, nil
+	}
+
+	product, err := getter.GetProductById(*licenseData.ProductId)
+	if err != nil {
+		return grace.Policy{}, err
+	}
+	if product.GraceDays == nil {
+		return defaultPolicy, nil
+	}
+
+	return grace.Policy{Days: *product.GraceDays}, nil
+}
+
+// licenseState returns the state of the license at now, licenses without an expiry date are always active
+func licenseState(licenseData *storage.License, policy grace.Policy, now time.Time) grace.State {
+	if licenseData.ExpiresAt == nil {
+		return grace.Active
+	}
+	return policy.State(*licenseData.ExpiresAt, now)
+}
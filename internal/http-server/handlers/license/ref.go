@@ -0,0 +1,59 @@
+package license
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/dzhisl/license-manager/internal/http-server/response"
+	"github.com/dzhisl/license-manager/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// LicenseRef addresses a single license either by its key or by its ID
+type LicenseRef struct {
+	License   string `json:"license,omitempty"`
+	LicenseId int64  `json:"license_id,omitempty"`
+}
+
+// licenseResolver looks up a license by key or by ID
+type licenseResolver interface {
+	GetLicenseByLicense(license string) (*storage.License, error)
+	GetLicenseById(id int64) (*storage.License, error)
+}
+
+// resolveLicenseId returns the ID of the license ref points to, making sure it exists when given by ID.
+// It writes the error response itself and returns false when the license can't be resolved.
+func resolveLicenseId(c *gin.Context, resolver licenseResolver, ref LicenseRef) (int64, bool) {
+	licenseData, ok := resolveLicense(c, resolver, ref)
+	if !ok {
+		return 0, false
+	}
+	return licenseData.ID, true
+}
+
+// resolveLicense returns the license ref points to.
+// It writes the error response itself and returns false when the license can't be resolved.
+func resolveLicense(c *gin.Context, resolver licenseResolver, ref LicenseRef) (*storage.License, bool) {
+	var licenseData *storage.License
+	var err error
+	switch {
+	case ref.LicenseId != 0:
+		licenseData, err = resolver.GetLicenseById(ref.LicenseId)
+	case ref.License != "":
+		licenseData, err = resolver.GetLicenseByLicense(ref.License)
+	default:
+		response.InvalidInputError(c, fmt.Errorf("either license or license_id is required"))
+		return nil, false
+	}
+	if err != nil {
+		if errors.Is(err, storage.ErrLicenseNotFound) {
+			response.Error(c, "License not found", http.StatusNotFound, nil)
+			return nil, false
+		}
+		response.InternalError(c, "Failed to get license", err)
+		return nil, false
+	}
+
+	return licenseData, true
+}
@@ -1,22 +1,49 @@
 package license
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/dzhisl/license-manager/internal/http-server/response"
+	"github.com/dzhisl/license-manager/internal/lib/renewal"
+	"github.com/dzhisl/license-manager/internal/storage"
 	"github.com/gin-gonic/gin"
 )
 
 type licenseRenewer interface {
-	RenewLicenseById(UserId string, days int) (expirationTime time.Time, err error)
+	licenseResolver
+	RenewLicenseById(id int64, plan renewal.Plan) (*storage.Renewal, error)
 }
 
+type renewalLister interface {
+	licenseResolver
+	GetRenewals(licenseId int64) ([]storage.Renewal, error)
+}
+
+// RenewInputData represents a renewal, the mode defaults to extend_from_expiry.
+// The extend modes add Years, Months and Days, set_absolute_date uses ExpiresAt.
 type RenewInputData struct {
-	UserId string `json:"user_id" binding:"required"`
-	Days   int    `json:"days" binding:"required"`
+	LicenseRef
+	Mode      renewal.Mode `json:"mode" binding:"omitempty,oneof=extend_from_expiry extend_from_now set_absolute_date"`
+	Years     int          `json:"years" binding:"min=0"`
+	Months    int          `json:"months" binding:"min=0"`
+	Days      int          `json:"days" binding:"min=0"`
+	ExpiresAt *time.Time   `json:"expires_at"`
+}
+
+// RenewOutput is the expiry date of a license before and after the renewal
+type RenewOutput struct {
+	LicenseId    int64        `json:"license_id"`
+	Mode         renewal.Mode `json:"mode"`
+	OldExpiresAt time.Time    `json:"old_expires_at"`
+	NewExpiresAt time.Time    `json:"new_expires_at"`
 }
 
-func RenewLicenseHandler(c *gin.Context, licelicenseRenewer licenseRenewer) {
+// RenewLicenseHandler moves the expiry date of a license
+func RenewLicenseHandler(c *gin.Context, renewer licenseRenewer) {
 	var input RenewInputData
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -24,11 +51,71 @@ func RenewLicenseHandler(c *gin.Context, licelicenseRenewer licenseRenewer) {
 		return
 	}
 
-	expirationTime, err := licelicenseRenewer.RenewLicenseById(input.UserId, input.Days)
+	plan := renewal.Plan{
+		Mode: input.Mode,
+		Term: renewal.Term{Years: input.Years, Months: input.Months, Days: input.Days},
+	}
+	if plan.Mode == "" {
+		plan.Mode = renewal.FromExpiry
+	}
+	if input.ExpiresAt != nil {
+		plan.Date = *input.ExpiresAt
+	}
+	if err := plan.Validate(time.Now()); err != nil {
+		response.InvalidInputError(c, err)
+		return
+	}
+
+	licenseId, ok := resolveLicenseId(c, renewer, input.LicenseRef)
+	if !ok {
+		return
+	}
+
+	renewed, err := renewer.RenewLicenseById(licenseId, plan)
 	if err != nil {
+		if errors.Is(err, storage.ErrLicenseNotFound) {
+			response.Error(c, "License not found", http.StatusNotFound, nil)
+			return
+		}
+		if errors.Is(err, storage.ErrNotRenewable) {
+			response.Error(c, "Only subscription licenses can be renewed", http.StatusConflict, nil)
+			return
+		}
 		response.InternalError(c, "Failed to renew license", err)
 		return
 	}
 
-	response.Ok(c, "License renewed successfully", expirationTime)
+	response.Ok(c, "License renewed successfully", RenewOutput{
+		LicenseId:    renewed.LicenseId,
+		Mode:         renewed.Mode,
+		OldExpiresAt: renewed.OldExpiresAt,
+		NewExpiresAt: renewed.NewExpiresAt,
+	})
+}
+
+// GetRenewalsHandler responds with the renewal history of a license,
+// the license is given by the License or LicenseId query parameter
+func GetRenewalsHandler(c *gin.Context, lister renewalLister) {
+	ref := LicenseRef{License: c.Query("License")}
+	if licenseId := c.Query("LicenseId"); licenseId != "" {
+		id, err := strconv.ParseInt(licenseId, 10, 64)
+		if err != nil {
+			response.InvalidInputError(c, fmt.Errorf("LicenseId must be an integer"))
+			return
+		}
+		ref.LicenseId = id
+	}
+
+	licenseId, ok := resolveLicenseId(c, lister, ref)
+	if !ok {
+		return
+	}
+
+	renewals, err := lister.GetRenewals(licenseId)
+	if err != nil {
+		response.InternalError(c, "Failed to get renewals", err)
+		return
+	}
+
+	response.Ok(c, "Renewals received", renewals)
 }
@@ -0,0 +1,249 @@
+package license
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dzhisl/license-manager/internal/http-server/response"
+	"github.com/dzhisl/license-manager/internal/lib/grace"
+	"github.com/dzhisl/license-manager/internal/lib/licensekey"
+	"github.com/dzhisl/license-manager/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+type sessionOpener interface {
+	licenseLookup
+	OpenSession(session *storage.Session, token string) (int64, error)
+}
+
+type sessionHeartbeater interface {
+	GetSessionByToken(token string) (*storage.Session, error)
+	GetLicenseById(id int64) (*storage.License, error)
+	productGetter
+	HeartbeatSession(token string, expiresAt time.Time) (*storage.Session, error)
+	CloseSession(token string) error
+}
+
+type sessionCloser interface {
+	CloseSession(token string) error
+}
+
+type sessionLister interface {
+	licenseResolver
+	GetSessions(licenseId int64) ([]storage.Session, error)
+}
+
+type maxSessionsSetter interface {
+	licenseResolver
+	SetMaxSessions(id int64, max int) error
+}
+
+// CheckoutInputData represents a request for a floating seat
+type CheckoutInputData struct {
+	License string `json:"license" binding:"required"`
+	HWID    string `json:"hwid" binding:"required,max=255"`
+}
+
+// SessionInputData identifies a checked out session
+type SessionInputData struct {
+	SessionToken string `json:"session_token" binding:"required"`
+}
+
+// MaxSessionsInputData represents the new session limit of a license
+type MaxSessionsInputData struct {
+	LicenseRef
+	MaxSessions int `json:"max_sessions" binding:"required,min=1"`
+}
+
+// SessionOutput is returned on checkout and on every heartbeat
+type SessionOutput struct {
+	SessionId    int64     `json:"session_id"`
+	SessionToken string    `json:"session_token,omitempty"` // only returned on checkout
+	ExpiresAt    time.Time `json:"expires_at"`
+	// HeartbeatTimeout is how long the session lives without a heartbeat, in seconds
+	HeartbeatTimeout int `json:"heartbeat_timeout"`
+}
+
+// CheckoutLicenseHandler opens a floating session on the license if it has a free seat
+func CheckoutLicenseHandler(c *gin.Context, opener sessionOpener, keyFormat licensekey.Format, defaultPolicy grace.Policy, heartbeatTimeout time.Duration) {
+	var input CheckoutInputData
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.InvalidInputError(c, err)
+		return
+	}
+
+	licenseData, _, verr := lookupLicense(opener, keyFormat, defaultPolicy, input.License)
+	if verr != nil {
+		writeValidationError(c, verr)
+		return
+	}
+
+	token, err := newToken()
+	if err != nil {
+		response.InternalError(c, "Failed to generate session token", err)
+		return
+	}
+
+	session := storage.Session{
+		LicenseId: licenseData.ID,
+		HWID:      input.HWID,
+		ExpiresAt: time.Now().Add(heartbeatTimeout),
+	}
+	if _, err := opener.OpenSession(&session, token); err != nil {
+		if errors.Is(err, storage.ErrSessionLimit) {
+			response.Error(c, "All seats of this license are in use", http.StatusConflict, nil)
+			return
+		}
+		response.InternalError(c, "Failed to open session", err)
+		return
+	}
+
+	response.Ok(c, "Session opened", SessionOutput{
+		SessionId:        session.ID,
+		SessionToken:     token,
+		ExpiresAt:        session.ExpiresAt,
+		HeartbeatTimeout: int(heartbeatTimeout.Seconds()),
+	})
+}
+
+// HeartbeatLicenseHandler keeps a session alive, as long as its license is still usable
+func HeartbeatLicenseHandler(c *gin.Context, heartbeater sessionHeartbeater, defaultPolicy grace.Policy, heartbeatTimeout time.Duration) {
+	var input SessionInputData
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.InvalidInputError(c, err)
+		return
+	}
+
+	session, err := heartbeater.GetSessionByToken(input.SessionToken)
+	if err != nil {
+		writeSessionError(c, err)
+		return
+	}
+
+	// A license frozen or expired while in use loses its sessions on the next heartbeat
+	licenseData, err := heartbeater.GetLicenseById(session.LicenseId)
+	if err != nil {
+		response.InternalError(c, "Failed to get license", err)
+		return
+	}
+	policy, err := expiryPolicy(heartbeater, licenseData, defaultPolicy)
+	if err != nil {
+		response.InternalError(c, "Failed to get product", err)
+		return
+	}
+	if verr := checkLicenseUsable(licenseData, policy); verr != nil {
+		if err := heartbeater.CloseSession(input.SessionToken); err != nil && !errors.Is(err, storage.ErrSessionNotFound) {
+			response.InternalError(c, "Failed to close session", err)
+			return
+		}
+		writeValidationError(c, verr)
+		return
+	}
+
+	session, err = heartbeater.HeartbeatSession(input.SessionToken, time.Now().Add(heartbeatTimeout))
+	if err != nil {
+		writeSessionError(c, err)
+		return
+	}
+
+	response.Ok(c, "Session extended", SessionOutput{
+		SessionId:        session.ID,
+		ExpiresAt:        session.ExpiresAt,
+		HeartbeatTimeout: int(heartbeatTimeout.Seconds()),
+	})
+}
+
+// CheckinLicenseHandler closes a session and frees its seat
+func CheckinLicenseHandler(c *gin.Context, closer sessionCloser) {
+	var input SessionInputData
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.InvalidInputError(c, err)
+		return
+	}
+
+	if err := closer.CloseSession(input.SessionToken); err != nil {
+		writeSessionError(c, err)
+		return
+	}
+
+	response.Ok(c, "Session closed", nil)
+}
+
+// GetSessionsHandler responds with the open sessions of a license,
+// the license is given by the License or LicenseId query parameter
+func GetSessionsHandler(c *gin.Context, lister sessionLister) {
+	ref := LicenseRef{License: c.Query("License")}
+	if licenseId := c.Query("LicenseId"); licenseId != "" {
+		id, err := strconv.ParseInt(licenseId, 10, 64)
+		if err != nil {
+			response.InvalidInputError(c, fmt.Errorf("LicenseId must be an integer"))
+			return
+		}
+		ref.LicenseId = id
+	}
+
+	licenseId, ok := resolveLicenseId(c, lister, ref)
+	if !ok {
+		return
+	}
+
+	sessions, err := lister.GetSessions(licenseId)
+	if err != nil {
+		response.InternalError(c, "Failed to get sessions", err)
+		return
+	}
+
+	response.Ok(c, "Sessions received", sessions)
+}
+
+// SetMaxSessionsHandler changes how many floating sessions a license may have at once
+func SetMaxSessionsHandler(c *gin.Context, setter maxSessionsSetter) {
+	var input MaxSessionsInputData
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.InvalidInputError(c, err)
+		return
+	}
+
+	licenseId, ok := resolveLicenseId(c, setter, input.LicenseRef)
+	if !ok {
+		return
+	}
+
+	if err := setter.SetMaxSessions(licenseId, input.MaxSessions); err != nil {
+		if errors.Is(err, storage.ErrLicenseNotFound) {
+			response.Error(c, "License not found", http.StatusNotFound, nil)
+			return
+		}
+		response.InternalError(c, "Failed to set max sessions", err)
+		return
+	}
+
+	response.Ok(c, "Max sessions updated successfully", nil)
+}
+
+// writeSessionError tells the client to check out again when its session is gone
+func writeSessionError(c *gin.Context, err error) {
+	if errors.Is(err, storage.ErrSessionNotFound) {
+		response.Error(c, "Session not found or expired", http.StatusNotFound, nil)
+		return
+	}
+	response.InternalError(c, "Session operation failed", err)
+}
+
+// newToken returns a random bearer token, used for sessions and license secrets
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -1,29 +1,76 @@
 package license
 
 import (
+	"crypto/ed25519"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/dzhisl/license-manager/internal/http-server/response"
-	"github.com/dzhisl/license-manager/internal/storage/sqlite"
+	"github.com/dzhisl/license-manager/internal/lib/fingerprint"
+	"github.com/dzhisl/license-manager/internal/lib/grace"
+	"github.com/dzhisl/license-manager/internal/lib/licensekey"
+	"github.com/dzhisl/license-manager/internal/storage"
+	"github.com/dzhisl/license-manager/pkg/lease"
+	"github.com/dzhisl/license-manager/pkg/validation"
 
 	"github.com/gin-gonic/gin"
 )
 
 // licenseValidator defines the required methods for validating a license
 type licenseValidator interface {
-	GetLicenseByLicense(license string) (*sqlite.UserLicense, error)
-	BindHwidToLicenseByLicense(license, hwid string) error
+	licenseLookup
+	entitlementGetter
+	ownershipChecker
+	ActivateMachine(licenseId int64, hwid, label string, fp fingerprint.Fingerprint, policy fingerprint.Policy, proof string) (*storage.Activation, error)
+}
+
+// licenseLookup defines the methods needed to find a license and its expiry policy
+type licenseLookup interface {
+	licenseResolver
+	productGetter
 }
 
 // validateInputData represents the incoming data for validation
 type validateInputData struct {
 	License string `json:"license" binding:"required"`
-	HWID    string `json:"hwid" binding:"required"`
+	HWID    string `json:"hwid" binding:"required,max=255"`
+	Label   string `json:"label,omitempty" binding:"max=100"` // human readable machine name, shown in the activation list
+	// Fingerprint lets the machine be recognized after its HWID changed, see lib/fingerprint
+	Fingerprint fingerprint.Fingerprint `json:"fingerprint,omitempty" binding:"omitempty,max=16,dive,keys,required,max=32,endkeys,required,max=128"`
+	Nonce       string                  `json:"nonce,omitempty" binding:"max=128"` // echoed in the signed result
+	Lease       bool                    `json:"lease,omitempty"`                   // ask for an offline lease, see pkg/lease
+	// OwnershipProof is needed to activate a new machine once the license is activated anywhere, like binding it
+	OwnershipProof
+}
+
+// validateOutput is the license data of a successful validation, with the lease if one was requested
+type validateOutput struct {
+	*storage.License
+	// State is "active", or "grace" for a license past its expiry date that still works until GraceEndsAt
+	State          grace.State         `json:"state"`
+	GraceEndsAt    *time.Time          `json:"grace_ends_at,omitempty"`
+	GraceRemaining int64               `json:"grace_remaining,omitempty"` // seconds
+	Entitlements   []EntitlementOutput `json:"entitlements"`
+	Lease          *leaseOutput        `json:"lease,omitempty"`
+}
+
+type leaseOutput struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// validationError describes why a license failed validation
+type validationError struct {
+	httpStatus int
+	code       string // machine readable reason, part of the signed result
+	message    string
+	err        error // set for internal errors only
 }
 
-// ValidateLicenseHandler handles license validation requests
-func ValidateLicenseHandler(c *gin.Context, licenseValidator licenseValidator) {
+// ValidateLicenseHandler handles license validation requests.
+// Every outcome except malformed input and internal errors is signed, see pkg/validation.
+func ValidateLicenseHandler(c *gin.Context, licenseValidator licenseValidator, keyFormat licensekey.Format, defaultPolicy grace.Policy, fingerprintPolicy fingerprint.Policy, signingKey ed25519.PrivateKey, offlineWindow time.Duration) {
 	var input validateInputData
 
 	// Bind and validate input data
@@ -32,38 +79,211 @@ func ValidateLicenseHandler(c *gin.Context, licenseValidator licenseValidator) {
 		return
 	}
 
-	// Retrieve license information by license ID
-	licenseData, err := licenseValidator.GetLicenseByLicense(input.License)
-	if err != nil {
-		response.InternalError(c, "failed to get license", err)
+	licenseData, policy, verr := checkLicense(licenseValidator, keyFormat, defaultPolicy, fingerprintPolicy, input)
+	if verr != nil && verr.err != nil {
+		writeValidationError(c, verr)
 		return
 	}
 
-	// Validate if the license is active
-	if licenseData.Status != "active" {
-		response.Error(c, "license is not active", http.StatusForbidden, nil)
+	now := time.Now().UTC()
+	result := validation.Result{
+		License:   input.License,
+		HWID:      input.HWID,
+		Nonce:     input.Nonce,
+		Timestamp: now,
+	}
+	var output validateOutput
+	if verr != nil {
+		result.Status = verr.code
+	} else {
+		result.Valid = true
+		result.Status = "valid"
+		result.Type = licenseData.Type
+		if licenseData.ExpiresAt != nil {
+			expiresAt := licenseData.ExpiresAt.UTC()
+			result.ExpiresAt = &expiresAt
+		}
+		if licenseData.UpdatesUntil != nil {
+			updatesUntil := licenseData.UpdatesUntil.UTC()
+			result.UpdatesUntil = &updatesUntil
+		}
+
+		output = validateOutput{License: licenseData, State: licenseState(licenseData, policy, now)}
+		entitlements, err := effectiveEntitlements(licenseValidator, licenseData)
+		if err != nil {
+			response.InternalError(c, "failed to get entitlements", err)
+			return
+		}
+		output.Entitlements = entitlements
+		for _, entitlement := range entitlements {
+			result.Entitlements = append(result.Entitlements, validation.Entitlement{Feature: entitlement.Feature, Limit: entitlement.Limit})
+		}
+		if output.State == grace.Grace {
+			graceEndsAt := policy.EndsAt(*licenseData.ExpiresAt).UTC()
+			result.Status = string(grace.Grace)
+			result.GraceEndsAt = &graceEndsAt
+			output.GraceEndsAt = &graceEndsAt
+			output.GraceRemaining = int64(graceEndsAt.Sub(now).Seconds())
+		}
+	}
+
+	signed, err := validation.Sign(result, signingKey)
+	if err != nil {
+		response.InternalError(c, "failed to sign validation result", err)
 		return
 	}
 
-	// Validate if the license has expired
-	if time.Now().After(licenseData.ExpiresAt) {
-		response.Error(c, "license has expired", http.StatusForbidden, nil)
+	if verr != nil {
+		response.Signed(c, verr.httpStatus, verr.message, nil, signed)
 		return
 	}
 
-	// Validate HWID and bind if necessary
-	if licenseData.HWID == nil || *licenseData.HWID == "" {
-		// HWID is empty, bind it to the license
-		if err := licenseValidator.BindHwidToLicenseByLicense(input.License, input.HWID); err != nil {
-			response.InternalError(c, "failed to bind HWID to license", err)
+	if input.Lease {
+		output.Lease, err = issueLease(licenseData, policy, input, now, offlineWindow, signingKey)
+		if err != nil {
+			response.InternalError(c, "failed to issue lease", err)
 			return
 		}
-	} else if *licenseData.HWID != input.HWID {
-		// HWID mismatch
-		response.Error(c, "HWID does not match", http.StatusForbidden, nil)
-		return
 	}
 
 	// License is valid, respond with success
-	response.Ok(c, "license is valid!", licenseData)
+	if output.State == grace.Grace {
+		response.Signed(c, http.StatusOK, "license has expired and is in its grace period", output, signed)
+		return
+	}
+	response.Signed(c, http.StatusOK, "license is valid!", output, signed)
+}
+
+// issueLease signs a lease for the validated license that lasts offlineWindow,
+// but never past the point the license stops working
+func issueLease(licenseData *storage.License, policy grace.Policy, input validateInputData, now time.Time, offlineWindow time.Duration, signingKey ed25519.PrivateKey) (*leaseOutput, error) {
+	expiresAt := now.Add(offlineWindow)
+	if licenseData.ExpiresAt != nil {
+		if usableUntil := policy.EndsAt(*licenseData.ExpiresAt); usableUntil.Before(expiresAt) {
+			expiresAt = usableUntil.UTC()
+		}
+	}
+
+	token, err := lease.Issue(lease.Claims{
+		KeyHash:   lease.KeyHash(input.License),
+		LicenseId: licenseData.ID,
+		HWID:      input.HWID,
+		IssuedAt:  now,
+		ExpiresAt: expiresAt,
+	}, signingKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &leaseOutput{Token: token, ExpiresAt: expiresAt}, nil
+}
+
+// checkLicense runs every validation step for the key and HWID in input, activating the machine on first use.
+// A machine the license isn't activated on yet needs proof of ownership, unless it is the first one.
+func checkLicense(licenseValidator licenseValidator, keyFormat licensekey.Format, defaultPolicy grace.Policy, fingerprintPolicy fingerprint.Policy, input validateInputData) (*storage.License, grace.Policy, *validationError) {
+	licenseData, policy, verr := lookupLicense(licenseValidator, keyFormat, defaultPolicy, input.License)
+	if verr != nil {
+		return nil, policy, verr
+	}
+
+	activations, err := licenseValidator.GetActivations(licenseData.ID)
+	if err != nil {
+		return nil, policy, &validationError{http.StatusInternalServerError, "internal_error", "failed to get activations", err}
+	}
+	var proof string
+	if !knownMachine(activations, input.HWID, input.Fingerprint, fingerprintPolicy) {
+		proof, err = checkOwnership(licenseValidator, licenseData.ID, activations, input.OwnershipProof, true)
+		switch {
+		case errors.Is(err, errProofRequired):
+			return nil, policy, &validationError{http.StatusForbidden, "ownership_required", "proof of ownership required to activate a new machine: send the license secret or a bound HWID", nil}
+		case errors.Is(err, errInvalidProof):
+			return nil, policy, &validationError{http.StatusForbidden, "invalid_ownership_proof", "invalid proof of ownership", nil}
+		case err != nil:
+			return nil, policy, &validationError{http.StatusInternalServerError, "internal_error", "failed to check proof of ownership", err}
+		}
+	}
+
+	// Activate the machine, new machines take a free seat until the license runs out of them
+	if _, err := licenseValidator.ActivateMachine(licenseData.ID, input.HWID, input.Label, input.Fingerprint, fingerprintPolicy, proof); err != nil {
+		if errors.Is(err, storage.ErrActivationLimit) {
+			return nil, policy, &validationError{http.StatusForbidden, "activation_limit", "license is activated on the maximum number of machines", nil}
+		}
+		if errors.Is(err, storage.ErrTrialUsed) {
+			return nil, policy, &validationError{http.StatusForbidden, "trial_used", "a trial has already been used on this machine", nil}
+		}
+		return nil, policy, &validationError{http.StatusInternalServerError, "internal_error", "failed to activate machine", err}
+	}
+
+	return licenseData, policy, nil
+}
+
+// knownMachine reports whether the license is activated on the machine, by its HWID or, when that changed, its fingerprint
+func knownMachine(activations []storage.Activation, hwid string, fp fingerprint.Fingerprint, policy fingerprint.Policy) bool {
+	for _, activation := range activations {
+		if activation.HWID == hwid {
+			return true
+		}
+		if len(fp) > 0 && policy.Matches(activation.Fingerprint, fp) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupLicense finds the license for key and its expiry policy, and checks that it can be used
+func lookupLicense(lookup licenseLookup, keyFormat licensekey.Format, defaultPolicy grace.Policy, key string) (*storage.License, grace.Policy, *validationError) {
+	// Reject mistyped or made up keys before hitting the database
+	if err := keyFormat.Check(key); err != nil {
+		return nil, defaultPolicy, &validationError{http.StatusBadRequest, "malformed_key", err.Error(), nil}
+	}
+
+	// Retrieve license information by license key
+	licenseData, err := lookup.GetLicenseByLicense(key)
+	if err != nil {
+		if errors.Is(err, storage.ErrLicenseNotFound) {
+			return nil, defaultPolicy, &validationError{http.StatusNotFound, "not_found", "license not found", nil}
+		}
+		return nil, defaultPolicy, &validationError{http.StatusInternalServerError, "internal_error", "failed to get license", err}
+	}
+
+	policy, err := expiryPolicy(lookup, licenseData, defaultPolicy)
+	if err != nil {
+		return nil, defaultPolicy, &validationError{http.StatusInternalServerError, "internal_error", "failed to get product", err}
+	}
+
+	if verr := checkLicenseUsable(licenseData, policy); verr != nil {
+		return nil, policy, verr
+	}
+
+	return licenseData, policy, nil
+}
+
+// checkLicenseUsable reports why the license can't be used right now, if it can't.
+// A license past its expiry date is usable until the end of its grace period.
+func checkLicenseUsable(licenseData *storage.License, policy grace.Policy) *validationError {
+	// The expiry sweeper marks licenses past their expiry date as expired
+	if licenseData.Status == "expired" {
+		return &validationError{http.StatusForbidden, "expired", "license has expired", nil}
+	}
+
+	// Validate if the license is active
+	if licenseData.Status != "active" {
+		return &validationError{http.StatusForbidden, "not_active", "license is not active", nil}
+	}
+
+	// Validate if the license has expired, including the grace period
+	if licenseState(licenseData, policy, time.Now()) == grace.Expired {
+		return &validationError{http.StatusForbidden, "expired", "license has expired", nil}
+	}
+
+	return nil
+}
+
+// writeValidationError writes an unsigned response for a failed validation
+func writeValidationError(c *gin.Context, verr *validationError) {
+	if verr.err != nil {
+		response.InternalError(c, verr.message, verr.err)
+		return
+	}
+	response.Error(c, verr.message, verr.httpStatus, nil)
 }
@@ -0,0 +1,66 @@
+package product
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/dzhisl/license-manager/internal/http-server/response"
+	"github.com/dzhisl/license-manager/internal/lib/licensekey"
+	"github.com/dzhisl/license-manager/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// productAdder defines an interface for adding a product
+type productAdder interface {
+	AddProduct(product *storage.Product) (int64, error)
+}
+
+// AddInputData represents the incoming data structure
+type AddInputData struct {
+	Code      string `json:"code" binding:"required,max=50"`
+	Name      string `json:"name" binding:"required"`
+	KeyPrefix string `json:"key_prefix,omitempty"` // e.g. "PROD", defaults to license_key.prefix
+	// GraceDays is how long licenses keep working after they expire, defaults to expiry.default_grace_days
+	GraceDays *int `json:"grace_days,omitempty" binding:"omitempty,min=0"`
+}
+
+// AddProductHandler creates a product that licenses can be issued for
+func AddProductHandler(c *gin.Context, productAdder productAdder) {
+	var input AddInputData
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.InvalidInputError(c, err)
+		return
+	}
+
+	if err := licensekey.ValidatePrefix(input.KeyPrefix); err != nil {
+		response.InvalidInputError(c, err)
+		return
+	}
+
+	product := storage.Product{
+		Code:      input.Code,
+		Name:      input.Name,
+		KeyPrefix: input.KeyPrefix,
+		GraceDays: input.GraceDays,
+	}
+	id, err := productAdder.AddProduct(&product)
+	if err != nil {
+		if errors.Is(err, storage.ErrProductExists) {
+			response.Error(c, "Product already exists", http.StatusConflict, nil)
+			return
+		}
+		response.InternalError(c, "Failed to add product", err)
+		return
+	}
+
+	output := map[string]any{
+		"product_id": id,
+		"code":       input.Code,
+		"name":       input.Name,
+		"key_prefix": input.KeyPrefix,
+		"grace_days": input.GraceDays,
+	}
+
+	response.Ok(c, "Product added!", output)
+}
@@ -0,0 +1,141 @@
+package product
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/dzhisl/license-manager/internal/http-server/response"
+	"github.com/dzhisl/license-manager/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// productFinder looks up a product by its code
+type productFinder interface {
+	GetProductByCode(code string) (*storage.Product, error)
+}
+
+type productEntitlementLister interface {
+	productFinder
+	GetProductEntitlements(productId int64) ([]storage.Entitlement, error)
+}
+
+type productEntitlementSetter interface {
+	productFinder
+	SetProductEntitlement(productId int64, entitlement storage.Entitlement) error
+}
+
+type productEntitlementRemover interface {
+	productFinder
+	RemoveProductEntitlement(productId int64, feature string) error
+}
+
+// EntitlementInputData represents a feature the licenses of a product get
+type EntitlementInputData struct {
+	Code    string `json:"code" binding:"required"`
+	Feature string `json:"feature" binding:"required,max=64"`
+	Limit   *int64 `json:"limit" binding:"omitempty,min=0"` // null means unlimited
+}
+
+// RemoveEntitlementInputData identifies the feature to take away from a product
+type RemoveEntitlementInputData struct {
+	Code    string `json:"code" binding:"required"`
+	Feature string `json:"feature" binding:"required"`
+}
+
+// EntitlementOutput is a feature of a product, Limit is left out when it is unlimited
+type EntitlementOutput struct {
+	Feature string `json:"feature"`
+	Limit   *int64 `json:"limit,omitempty"`
+}
+
+// GetProductEntitlementsHandler responds with the features of the product given by the Code query parameter
+func GetProductEntitlementsHandler(c *gin.Context, lister productEntitlementLister) {
+	code := c.Query("Code")
+	if code == "" {
+		response.InvalidInputError(c, fmt.Errorf("Code parameter is required"))
+		return
+	}
+
+	product, ok := getProduct(c, lister, code)
+	if !ok {
+		return
+	}
+
+	entitlements, err := lister.GetProductEntitlements(product.ID)
+	if err != nil {
+		response.InternalError(c, "Failed to get entitlements", err)
+		return
+	}
+
+	output := []EntitlementOutput{}
+	for _, entitlement := range entitlements {
+		output = append(output, EntitlementOutput{Feature: entitlement.Feature, Limit: entitlement.Limit})
+	}
+
+	response.Ok(c, "Entitlements received", output)
+}
+
+// SetProductEntitlementHandler grants a feature to every license of the product or changes its limit
+func SetProductEntitlementHandler(c *gin.Context, setter productEntitlementSetter) {
+	var input EntitlementInputData
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.InvalidInputError(c, err)
+		return
+	}
+
+	product, ok := getProduct(c, setter, input.Code)
+	if !ok {
+		return
+	}
+
+	if err := setter.SetProductEntitlement(product.ID, storage.Entitlement{Feature: input.Feature, Limit: input.Limit}); err != nil {
+		response.InternalError(c, "Failed to set entitlement", err)
+		return
+	}
+
+	response.Ok(c, "Entitlement updated successfully", nil)
+}
+
+// RemoveProductEntitlementHandler takes a feature away from the product
+func RemoveProductEntitlementHandler(c *gin.Context, remover productEntitlementRemover) {
+	var input RemoveEntitlementInputData
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.InvalidInputError(c, err)
+		return
+	}
+
+	product, ok := getProduct(c, remover, input.Code)
+	if !ok {
+		return
+	}
+
+	if err := remover.RemoveProductEntitlement(product.ID, input.Feature); err != nil {
+		if errors.Is(err, storage.ErrEntitlementNotFound) {
+			response.Error(c, "Product has no such entitlement", http.StatusNotFound, nil)
+			return
+		}
+		response.InternalError(c, "Failed to remove entitlement", err)
+		return
+	}
+
+	response.Ok(c, "Entitlement removed successfully", nil)
+}
+
+// getProduct looks up the product by code.
+// It writes the error response itself and returns false when the product can't be found.
+func getProduct(c *gin.Context, finder productFinder, code string) (*storage.Product, bool) {
+	product, err := finder.GetProductByCode(code)
+	if err != nil {
+		if errors.Is(err, storage.ErrProductNotFound) {
+			response.Error(c, "Product not found", http.StatusNotFound, nil)
+			return nil, false
+		}
+		response.InternalError(c, "Failed to get product", err)
+		return nil, false
+	}
+
+	return product, true
+}
@@ -0,0 +1,20 @@
+package product
+
+import (
+	"github.com/dzhisl/license-manager/internal/http-server/response"
+	"github.com/dzhisl/license-manager/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+type allProductsGetter interface {
+	GetAllProducts() ([]storage.Product, error)
+}
+
+func GetAllProductsHandler(c *gin.Context, allProductsGetter allProductsGetter) {
+	products, err := allProductsGetter.GetAllProducts()
+	if err != nil {
+		response.InternalError(c, "Failed to get products", err)
+		return
+	}
+	response.Ok(c, "success", products)
+}
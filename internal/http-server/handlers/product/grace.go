@@ -0,0 +1,50 @@
+package product
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/dzhisl/license-manager/internal/http-server/response"
+	"github.com/dzhisl/license-manager/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// productGraceSetter defines an interface for changing the grace period of a product
+type productGraceSetter interface {
+	GetProductByCode(code string) (*storage.Product, error)
+	SetProductGraceDays(id int64, days *int) error
+}
+
+// GraceInputData represents the new grace period of a product
+type GraceInputData struct {
+	Code string `json:"code" binding:"required"`
+	// GraceDays is how long licenses keep working after they expire, null reverts to expiry.default_grace_days
+	GraceDays *int `json:"grace_days" binding:"omitempty,min=0"`
+}
+
+// SetProductGraceHandler changes how long the product's licenses keep working after they expire
+func SetProductGraceHandler(c *gin.Context, setter productGraceSetter) {
+	var input GraceInputData
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.InvalidInputError(c, err)
+		return
+	}
+
+	product, err := setter.GetProductByCode(input.Code)
+	if err != nil {
+		if errors.Is(err, storage.ErrProductNotFound) {
+			response.Error(c, "Product not found", http.StatusNotFound, nil)
+			return
+		}
+		response.InternalError(c, "Failed to get product", err)
+		return
+	}
+
+	if err := setter.SetProductGraceDays(product.ID, input.GraceDays); err != nil {
+		response.InternalError(c, "Failed to set grace period", err)
+		return
+	}
+
+	response.Ok(c, "Grace period updated successfully", nil)
+}
@@ -0,0 +1,135 @@
+package tenant
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/dzhisl/license-manager/internal/http-server/response"
+	"github.com/dzhisl/license-manager/internal/lib/apikey"
+	"github.com/dzhisl/license-manager/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+type tenantAdder interface {
+	AddTenant(tenant *storage.Tenant) (int64, error)
+	ForTenant(tenantId int64) storage.LicenseStore
+}
+
+type tenantLister interface {
+	GetTenants() ([]storage.Tenant, error)
+}
+
+type tenantStatusSetter interface {
+	SetTenantStatus(id int64, status string) error
+}
+
+// AddInputData represents a new tenant
+type AddInputData struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// TenantRef identifies a tenant
+type TenantRef struct {
+	TenantId int64 `json:"tenant_id" binding:"required"`
+}
+
+// TenantOutput describes a tenant, AdminKey is only set when the tenant was just created
+type TenantOutput struct {
+	TenantId   int64     `json:"tenant_id"`
+	Name       string    `json:"name"`
+	Status     string    `json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+	AdminKeyId int64     `json:"admin_key_id,omitempty"`
+	AdminKey   string    `json:"admin_key,omitempty"` // an admin API key of the tenant to create its other keys with
+}
+
+// AddTenantHandler creates a tenant together with its first admin API key, the key is only returned here
+func AddTenantHandler(c *gin.Context, adder tenantAdder) {
+	var input AddInputData
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.InvalidInputError(c, err)
+		return
+	}
+
+	key, err := apikey.Generate()
+	if err != nil {
+		response.InternalError(c, "Failed to generate API key", err)
+		return
+	}
+
+	tenant := storage.Tenant{Name: input.Name}
+	id, err := adder.AddTenant(&tenant)
+	if err != nil {
+		response.InternalError(c, "Failed to add tenant", err)
+		return
+	}
+
+	adminKey := storage.ApiKey{Name: "admin", Role: apikey.Admin, Scopes: []string{}}
+	if _, err := adder.ForTenant(id).AddApiKey(&adminKey, key); err != nil {
+		response.InternalError(c, "Failed to add the admin API key of the tenant", err)
+		return
+	}
+
+	output := tenantOutput(tenant)
+	output.AdminKeyId = adminKey.ID
+	output.AdminKey = key
+
+	response.Ok(c, "Tenant added! Store the admin key now, it cannot be retrieved again", output)
+}
+
+// GetTenantsHandler responds with every tenant, suspended ones included
+func GetTenantsHandler(c *gin.Context, lister tenantLister) {
+	tenants, err := lister.GetTenants()
+	if err != nil {
+		response.InternalError(c, "Failed to get tenants", err)
+		return
+	}
+
+	output := make([]TenantOutput, 0, len(tenants))
+	for _, tenant := range tenants {
+		output = append(output, tenantOutput(tenant))
+	}
+
+	response.Ok(c, "success", output)
+}
+
+// SuspendTenantHandler stops the API keys of the tenant from working, its licenses keep working
+func SuspendTenantHandler(c *gin.Context, setter tenantStatusSetter) {
+	setTenantStatus(c, setter, storage.TenantSuspended, "Tenant suspended successfully")
+}
+
+// ResumeTenantHandler lets the API keys of a suspended tenant work again
+func ResumeTenantHandler(c *gin.Context, setter tenantStatusSetter) {
+	setTenantStatus(c, setter, storage.TenantActive, "Tenant resumed successfully")
+}
+
+func setTenantStatus(c *gin.Context, setter tenantStatusSetter, status, message string) {
+	var input TenantRef
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.InvalidInputError(c, err)
+		return
+	}
+
+	if err := setter.SetTenantStatus(input.TenantId, status); err != nil {
+		if errors.Is(err, storage.ErrTenantNotFound) {
+			response.Error(c, "Tenant not found", http.StatusNotFound, nil)
+			return
+		}
+		response.InternalError(c, "Failed to change tenant status", err)
+		return
+	}
+
+	response.Ok(c, message, nil)
+}
+
+func tenantOutput(tenant storage.Tenant) TenantOutput {
+	return TenantOutput{
+		TenantId:  tenant.ID,
+		Name:      tenant.Name,
+		Status:    tenant.Status,
+		CreatedAt: tenant.CreatedAt,
+	}
+}
@@ -0,0 +1,25 @@
+package wellknown
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SigningKeyOutput describes the key validation results and license files are signed with
+type SigningKeyOutput struct {
+	Algorithm string `json:"algorithm"`
+	PublicKey string `json:"public_key"` // standard base64
+}
+
+// SigningKeyHandler publishes the server's public signing key
+func SigningKeyHandler(c *gin.Context, publicKey ed25519.PublicKey) {
+	// The key rarely changes, let clients and proxies cache it
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.JSON(http.StatusOK, SigningKeyOutput{
+		Algorithm: "Ed25519",
+		PublicKey: base64.StdEncoding.EncodeToString(publicKey),
+	})
+}
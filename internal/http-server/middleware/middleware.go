@@ -2,23 +2,283 @@ package middleware
 
 import (
 	"bytes"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
 
 	"golang.org/x/exp/slog"
 
 	"github.com/dzhisl/license-manager/internal/http-server/response"
+	"github.com/dzhisl/license-manager/internal/lib/apikey"
+	"github.com/dzhisl/license-manager/internal/lib/secretbox"
+	"github.com/dzhisl/license-manager/internal/storage"
+	"github.com/dzhisl/license-manager/pkg/reqsign"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
-// APIKeyAuthMiddleware checks for a valid API key in the request headers.
-func APIKeyAuthMiddleware(apiKey string) gin.HandlerFunc {
+// principalKey is the gin context key the authenticated Principal is stored under
+const principalKey = "principal"
+
+// redactedFields are the request body fields RequestLogger never writes out: keys and secrets the
+// database itself only keeps hashed, and bound_hwid, which proves ownership of a license
+var redactedFields = []string{"license", "key", "secret", "signing_secret", "token", "bound_hwid"}
+
+// requestIdKey is the gin context key the ID RequestLogger gave the request is stored under
+const requestIdKey = "request_id"
+
+// Principal is who made an authenticated request
+type Principal struct {
+	ApiKeyId int64 // 0 for the root key from the config
+	Name     string
+	Role     apikey.Role
+	Scopes   []string // the scopes of the role and of the key itself
+	TenantId int64    // the tenant whose data the request sees
+}
+
+// String identifies the principal in logs
+func (p *Principal) String() string {
+	if p.ApiKeyId == 0 {
+		return fmt.Sprintf("%s (tenant %d)", p.Name, p.TenantId)
+	}
+	return fmt.Sprintf("%s (api key %d, tenant %d)", p.Name, p.ApiKeyId, p.TenantId)
+}
+
+// PrincipalFrom returns who made the request, nil before APIKeyAuthMiddleware ran or on public routes
+func PrincipalFrom(c *gin.Context) *Principal {
+	if principal, ok := c.Get(principalKey); ok {
+		return principal.(*Principal)
+	}
+	return nil
+}
+
+// ActorFrom returns who the transaction log records as making the changes of the request
+func ActorFrom(c *gin.Context) storage.Actor {
+	actor := storage.Actor{Kind: storage.ActorPublic, IP: c.ClientIP(), RequestId: c.GetString(requestIdKey)}
+
+	if principal := PrincipalFrom(c); principal != nil {
+		actor.Kind = storage.ActorRoot
+		if principal.ApiKeyId != 0 {
+			actor.Kind = storage.ActorApiKey
+			actor.ApiKeyId = principal.ApiKeyId
+		}
+	}
+
+	return actor
+}
+
+// apiKeyLookup finds the API keys stored in the database
+type apiKeyLookup interface {
+	GetApiKeyByKey(key string) (*storage.ApiKey, error)
+	GetApiKeyById(id int64) (*storage.ApiKey, error)
+	TouchApiKey(id int64, now time.Time) error
+	UseNonce(apiKeyId int64, nonce string, expiresAt time.Time) error
+	GetTenantById(id int64) (*storage.Tenant, error)
+}
+
+// RequestSigning is what APIKeyAuthMiddleware needs to check signed requests, see pkg/reqsign
+type RequestSigning struct {
+	Secrets *secretbox.Box // opens the sealed signing secrets of API keys
+	MaxSkew time.Duration
+}
+
+// APIKeyAuthMiddleware checks for a valid API key or request signature in the request headers
+// and attaches the Principal of the key to the context. rootKey, the key from the config,
+// has every scope and works in the default tenant or the one named by the X-Tenant-Id header.
+// API keys with a signing secret only accept signed requests.
+func APIKeyAuthMiddleware(rootKey string, lookup apiKeyLookup, signing RequestSigning) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if c.GetHeader(reqsign.HeaderSignature) != "" {
+			apiKey, ok := verifySignedRequest(c, lookup, signing)
+			if !ok {
+				c.Abort()
+				return
+			}
+			authorizeApiKey(c, lookup, apiKey)
+			return
+		}
+
 		key := c.GetHeader("X-API-Key")
-		if key != apiKey {
-			response.Error(c, "Unauthorized", 401, nil)
+		if key == "" {
+			response.Error(c, "Unauthorized", http.StatusUnauthorized, nil)
+			c.Abort()
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(key), []byte(rootKey)) == 1 {
+			tenantId, ok := rootTenant(c, lookup)
+			if !ok {
+				c.Abort()
+				return
+			}
+			c.Set(principalKey, &Principal{Name: "root", Role: apikey.Admin, Scopes: apikey.RootScopes, TenantId: tenantId})
+			c.Next()
+			return
+		}
+
+		apiKey, err := lookup.GetApiKeyByKey(key)
+		if err != nil {
+			if errors.Is(err, storage.ErrApiKeyNotFound) {
+				response.Error(c, "Unauthorized", http.StatusUnauthorized, nil)
+			} else {
+				response.InternalError(c, "Failed to check API key", err)
+			}
+			c.Abort()
+			return
+		}
+
+		if apiKey.SigningSecret != "" {
+			response.Error(c, "API key requires signed requests", http.StatusUnauthorized, nil)
+			c.Abort()
+			return
+		}
+
+		authorizeApiKey(c, lookup, apiKey)
+	}
+}
+
+// rootTenant returns the tenant the root key works in, the default one unless the X-Tenant-Id header names another.
+// Suspended tenants stay reachable so the root key can clean them up.
+// It writes the error response itself and returns false when the tenant doesn't exist.
+func rootTenant(c *gin.Context, lookup apiKeyLookup) (int64, bool) {
+	header := c.GetHeader("X-Tenant-Id")
+	if header == "" {
+		return storage.DefaultTenantId, true
+	}
+
+	tenantId, err := strconv.ParseInt(header, 10, 64)
+	if err != nil {
+		response.Error(c, "X-Tenant-Id must be an integer", http.StatusBadRequest, err)
+		return 0, false
+	}
+
+	if _, err := lookup.GetTenantById(tenantId); err != nil {
+		if errors.Is(err, storage.ErrTenantNotFound) {
+			response.Error(c, "Tenant not found", http.StatusNotFound, nil)
+		} else {
+			response.InternalError(c, "Failed to check tenant", err)
+		}
+		return 0, false
+	}
+
+	return tenantId, true
+}
+
+// verifySignedRequest checks the signature, timestamp and nonce of a signed request and returns its API key.
+// It writes the error response itself and returns false when the request can't be trusted.
+func verifySignedRequest(c *gin.Context, lookup apiKeyLookup, signing RequestSigning) (*storage.ApiKey, bool) {
+	keyId, errId := strconv.ParseInt(c.GetHeader(reqsign.HeaderKeyId), 10, 64)
+	timestamp, errTimestamp := strconv.ParseInt(c.GetHeader(reqsign.HeaderTimestamp), 10, 64)
+	nonce := c.GetHeader(reqsign.HeaderNonce)
+	if errId != nil || errTimestamp != nil || len(nonce) < 16 || len(nonce) > 64 {
+		response.Error(c, "Malformed request signature", http.StatusUnauthorized,
+			fmt.Errorf("%s and %s must be integers, %s 16-64 characters", reqsign.HeaderKeyId, reqsign.HeaderTimestamp, reqsign.HeaderNonce))
+		return nil, false
+	}
+
+	apiKey, err := lookup.GetApiKeyById(keyId)
+	if err != nil {
+		if errors.Is(err, storage.ErrApiKeyNotFound) {
+			response.Error(c, "Unauthorized", http.StatusUnauthorized, nil)
+		} else {
+			response.InternalError(c, "Failed to check API key", err)
+		}
+		return nil, false
+	}
+	if apiKey.SigningSecret == "" {
+		response.Error(c, "API key doesn't sign requests", http.StatusUnauthorized, nil)
+		return nil, false
+	}
+
+	now := time.Now()
+	if err := reqsign.CheckTimestamp(timestamp, now, signing.MaxSkew); err != nil {
+		response.Error(c, "Request timestamp outside the allowed clock skew", http.StatusUnauthorized, nil)
+		return nil, false
+	}
+
+	secret, err := signing.Secrets.Open(apiKey.SigningSecret)
+	if err != nil {
+		response.InternalError(c, "Failed to check request signature", err)
+		return nil, false
+	}
+
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		response.InternalError(c, "Failed to read request body", err)
+		return nil, false
+	}
+	c.Request.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+
+	signature := c.GetHeader(reqsign.HeaderSignature)
+	if err := reqsign.Verify(secret, c.Request.Method, c.Request.URL.RequestURI(), body, timestamp, nonce, signature); err != nil {
+		response.Error(c, "Invalid request signature", http.StatusUnauthorized, nil)
+		return nil, false
+	}
+
+	// The nonce only has to be remembered while the timestamp is still accepted
+	expiresAt := time.Unix(timestamp, 0).Add(signing.MaxSkew)
+	if err := lookup.UseNonce(apiKey.ID, nonce, expiresAt); err != nil {
+		if errors.Is(err, storage.ErrNonceUsed) {
+			response.Error(c, "Request replayed", http.StatusUnauthorized, nil)
+		} else {
+			response.InternalError(c, "Failed to check request signature", err)
+		}
+		return nil, false
+	}
+
+	return apiKey, true
+}
+
+// authorizeApiKey refuses revoked and expired keys and the keys of suspended tenants, otherwise it records the use of the key
+// and attaches its Principal before handing over to the next handler
+func authorizeApiKey(c *gin.Context, lookup apiKeyLookup, apiKey *storage.ApiKey) {
+	now := time.Now()
+	if apiKey.RevokedAt != nil {
+		response.Error(c, "API key revoked", http.StatusUnauthorized, nil)
+		c.Abort()
+		return
+	}
+	if apiKey.ExpiresAt != nil && !now.Before(*apiKey.ExpiresAt) {
+		response.Error(c, "API key expired", http.StatusUnauthorized, nil)
+		c.Abort()
+		return
+	}
+
+	tenant, err := lookup.GetTenantById(apiKey.TenantId)
+	if err != nil {
+		response.InternalError(c, "Failed to check API key", err)
+		c.Abort()
+		return
+	}
+	if tenant.Status == storage.TenantSuspended {
+		response.Error(c, "Tenant suspended", http.StatusForbidden, nil)
+		c.Abort()
+		return
+	}
+
+	if err := lookup.TouchApiKey(apiKey.ID, now); err != nil {
+		response.InternalError(c, "Failed to check API key", err)
+		c.Abort()
+		return
+	}
+
+	c.Set(principalKey, &Principal{ApiKeyId: apiKey.ID, Name: apiKey.Name, Role: apiKey.Role, Scopes: apikey.Grant(apiKey.Role, apiKey.Scopes), TenantId: apiKey.TenantId})
+	c.Next()
+}
+
+// RequireScope lets the request through only if its principal has scope, through its role or its own scopes.
+// It runs after APIKeyAuthMiddleware.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := PrincipalFrom(c)
+		if principal == nil || !slices.Contains(principal.Scopes, scope) {
+			response.Forbidden(c, scope)
 			c.Abort()
 			return
 		}
@@ -31,6 +291,8 @@ func RequestLogger(logger *slog.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		reqUUID := uuid.New().String()
+		c.Set(requestIdKey, reqUUID)
+		c.Header("X-Request-Id", reqUUID)
 
 		reqIP := c.ClientIP()
 
@@ -39,8 +301,10 @@ func RequestLogger(logger *slog.Logger) gin.HandlerFunc {
 
 		var requestBody interface{}
 		if err := json.Unmarshal(bodyBytes, &requestBody); err != nil {
-			requestBody = string(bodyBytes)
+			// Not JSON, so there is no telling which part is a secret
+			requestBody = fmt.Sprintf("%d bytes", len(bodyBytes))
 		}
+		redact(requestBody)
 
 		requestBodyJSON, err := json.Marshal(requestBody)
 		if err != nil {
@@ -50,11 +314,33 @@ func RequestLogger(logger *slog.Logger) gin.HandlerFunc {
 		c.Next()
 
 		statusCode := c.Writer.Status()
+		principal := "-"
+		if p := PrincipalFrom(c); p != nil {
+			principal = p.String()
+		}
 		logMessage := fmt.Sprintf(
-			"Request UUID: %s | IP: %s | Method: %s | Path: %s | Status: %d | Body: %s",
-			reqUUID, reqIP, c.Request.Method, c.Request.URL.Path, statusCode, string(requestBodyJSON),
+			"Request UUID: %s | IP: %s | Principal: %s | Method: %s | Path: %s | Status: %d | Body: %s",
+			reqUUID, reqIP, principal, c.Request.Method, c.Request.URL.Path, statusCode, string(requestBodyJSON),
 		)
 		logger.Info(logMessage)
 		fmt.Fprintln(gin.DefaultWriter, logMessage)
 	}
 }
+
+// redact replaces the redactedFields of a decoded JSON body, at any depth
+func redact(body any) {
+	switch body := body.(type) {
+	case map[string]any:
+		for field, value := range body {
+			if slices.Contains(redactedFields, field) {
+				body[field] = "[redacted]"
+				continue
+			}
+			redact(value)
+		}
+	case []any:
+		for _, value := range body {
+			redact(value)
+		}
+	}
+}
@@ -1,7 +1,11 @@
 package response
 
 import (
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -49,3 +53,42 @@ func Error(c *gin.Context, errorMessage string, status int, err error) {
 
 	c.JSON(status, response)
 }
+
+// 429 error response wrapper, tells the client when to try again in the body and in Retry-After
+func TooManyRequests(c *gin.Context, errorMessage string, retryAt time.Time) {
+	retryAfter := int64(math.Ceil(time.Until(retryAt).Seconds()))
+	c.Header("Retry-After", strconv.FormatInt(max(retryAfter, 0), 10))
+
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":    errorMessage,
+		"retry_at": retryAt.UTC(),
+	})
+}
+
+// 403 error response wrapper, names the permission the caller is missing
+func Forbidden(c *gin.Context, permission string) {
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":              fmt.Sprintf("Missing the %s permission", permission),
+		"missing_permission": permission,
+	})
+}
+
+// signed response wrapper, the signature is returned next to the usual message/error
+func Signed(c *gin.Context, status int, message string, output interface{}, signed interface{}) {
+
+	response := gin.H{
+		"signed": signed,
+	}
+
+	if status >= http.StatusBadRequest {
+		response["error"] = message
+	} else {
+		response["message"] = message
+	}
+
+	if output != nil {
+		response["data"] = output
+	}
+
+	c.JSON(status, response)
+}
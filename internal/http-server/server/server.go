@@ -1,6 +1,7 @@
 package server
 
 import (
+	"crypto/ed25519"
 	"log"
 
 	"golang.org/x/exp/slog"
@@ -8,26 +9,52 @@ import (
 	"os"
 
 	"github.com/dzhisl/license-manager/internal/config"
+	"github.com/dzhisl/license-manager/internal/http-server/handlers/apikey"
+	"github.com/dzhisl/license-manager/internal/http-server/handlers/expiry"
 	"github.com/dzhisl/license-manager/internal/http-server/handlers/license"
 	"github.com/dzhisl/license-manager/internal/http-server/handlers/ping"
+	"github.com/dzhisl/license-manager/internal/http-server/handlers/product"
+	"github.com/dzhisl/license-manager/internal/http-server/handlers/tenant"
+	"github.com/dzhisl/license-manager/internal/http-server/handlers/wellknown"
 	"github.com/dzhisl/license-manager/internal/http-server/middleware"
-	"github.com/dzhisl/license-manager/internal/storage/sqlite"
+	"github.com/dzhisl/license-manager/internal/jobs"
+	keyscope "github.com/dzhisl/license-manager/internal/lib/apikey"
+	"github.com/dzhisl/license-manager/internal/lib/fingerprint"
+	"github.com/dzhisl/license-manager/internal/lib/grace"
+	"github.com/dzhisl/license-manager/internal/lib/hwidreset"
+	"github.com/dzhisl/license-manager/internal/lib/licensekey"
+	"github.com/dzhisl/license-manager/internal/lib/secretbox"
+	"github.com/dzhisl/license-manager/internal/storage"
 	"github.com/gin-gonic/gin"
 )
 
 // SetupRouter sets up the Gin router
-func SetupRouter(storage *sqlite.Storage, AuthData *config.AuthData, sllogger *slog.Logger) *gin.Engine {
+func SetupRouter(store storage.LicenseStore, cfg *config.Config, signingKey ed25519.PrivateKey, sweeper *jobs.ExpirySweeper, sllogger *slog.Logger) *gin.Engine {
 	gin.SetMode(gin.ReleaseMode)
 	setupGinLogs()
 	r := gin.Default()
 	r.Use(middleware.RequestLogger(sllogger))
-	registerPublicRoutes(r, storage)
+	keyFormat := cfg.LicenseKey.Format()
 
-	// Using the API key for authentication
+	defaultPolicy := grace.Policy{Days: cfg.Expiry.DefaultGraceDays}
+	fingerprintPolicy := fingerprint.Policy{Threshold: cfg.Fingerprint.Threshold}
+	resetPolicy := hwidreset.Policy{Limit: cfg.HwidReset.Limit, Window: cfg.HwidReset.Window, Cooldown: cfg.HwidReset.Cooldown}
+
+	registerPublicRoutes(r, store, cfg, keyFormat, defaultPolicy, fingerprintPolicy, resetPolicy, signingKey)
+
+	signingSecrets, err := secretbox.New(cfg.LicenseKey.HashSecret, "api key signing secrets")
+	if err != nil {
+		log.Fatalf("Failed to set up request signing: %v", err)
+	}
+	requestSigning := middleware.RequestSigning{Secrets: signingSecrets, MaxSkew: cfg.Signatures.MaxSkew}
+
+	// Using the API key or a request signature for authentication
 	protected := r.Group("/")
-	protected.Use(middleware.APIKeyAuthMiddleware(AuthData.ApiKey)) // Use API key middleware
+	protected.Use(middleware.APIKeyAuthMiddleware(cfg.AuthData.ApiKey, store, requestSigning)) // Use API key middleware
+
+	trialLimits := license.TrialLimits{DefaultDays: cfg.Trial.DefaultDays, MaxDays: cfg.Trial.MaxDays}
 
-	registerProtectedRoutes(protected, storage)
+	registerProtectedRoutes(protected, store, keyFormat, trialLimits, resetPolicy, signingSecrets, sweeper)
 
 	return r
 }
@@ -44,20 +71,84 @@ func setupGinLogs() {
 }
 
 // registerPublicRoutes registers the routes that do not require authentication.
-func registerPublicRoutes(r *gin.Engine, storage *sqlite.Storage) {
+func registerPublicRoutes(r *gin.Engine, store storage.LicenseStore, cfg *config.Config, keyFormat licensekey.Format, defaultPolicy grace.Policy, fingerprintPolicy fingerprint.Policy, resetPolicy hwidreset.Policy, signingKey ed25519.PrivateKey) {
+	// The transaction log records the client making the changes by its IP
+	acting := func(c *gin.Context) storage.LicenseStore {
+		return store.As(middleware.ActorFrom(c))
+	}
+
 	r.GET("/ping", ping.PingHandler)
-	r.POST("/bind-license", func(c *gin.Context) { license.BindLicenseHandler(c, storage) })
-	r.POST("/unbind-license", func(c *gin.Context) { license.UnbindLicenseHandler(c, storage) })
-	r.POST("/validate-license", func(c *gin.Context) { license.ValidateLicenseHandler(c, storage) })
+	r.GET("/.well-known/license-signing-key", func(c *gin.Context) {
+		wellknown.SigningKeyHandler(c, signingKey.Public().(ed25519.PublicKey))
+	})
+	r.POST("/bind-license", func(c *gin.Context) { license.BindLicenseHandler(c, acting(c), fingerprintPolicy) })
+	r.POST("/unbind-license", func(c *gin.Context) { license.UnbindLicenseHandler(c, acting(c), resetPolicy) })
+	r.POST("/validate-license", func(c *gin.Context) {
+		license.ValidateLicenseHandler(c, acting(c), keyFormat, defaultPolicy, fingerprintPolicy, signingKey, cfg.Lease.OfflineWindow)
+	})
+	r.POST("/license-file", func(c *gin.Context) {
+		license.IssueLicenseFileHandler(c, acting(c), keyFormat, defaultPolicy, fingerprintPolicy, signingKey)
+	})
+	r.POST("/checkout-license", func(c *gin.Context) {
+		license.CheckoutLicenseHandler(c, acting(c), keyFormat, defaultPolicy, cfg.Sessions.HeartbeatTimeout)
+	})
+	r.POST("/heartbeat-license", func(c *gin.Context) {
+		license.HeartbeatLicenseHandler(c, acting(c), defaultPolicy, cfg.Sessions.HeartbeatTimeout)
+	})
+	r.POST("/checkin-license", func(c *gin.Context) { license.CheckinLicenseHandler(c, acting(c)) })
+	r.POST("/increment-usage", func(c *gin.Context) { license.IncrementUsageHandler(c, acting(c), keyFormat, defaultPolicy) })
+	r.POST("/usage", func(c *gin.Context) { license.UsageHandler(c, acting(c), keyFormat, defaultPolicy) })
 }
 
 // registerProtectedRoutes registers the routes that require authentication.
-func registerProtectedRoutes(authorized *gin.RouterGroup, storage *sqlite.Storage) {
-	authorized.GET("/get", func(c *gin.Context) { license.GetLicenseHandler(c, storage) })
-	authorized.GET("/all-licenses", func(c *gin.Context) { license.GetAllLicensesHandler(c, storage) })
-	authorized.POST("/add-license", func(c *gin.Context) { license.AddLicenseHandler(c, storage) })
-	authorized.POST("/del-license", func(c *gin.Context) { license.DeletelicenseHandler(c, storage) })
-	authorized.POST("/freeze-license", func(c *gin.Context) { license.FreezeLicenseHandler(c, storage) })
-	authorized.POST("/unfreeze-license", func(c *gin.Context) { license.UnfreezeLicenseHandler(c, storage) })
-	authorized.POST("/renew-license", func(c *gin.Context) { license.RenewLicenseHandler(c, storage) })
+func registerProtectedRoutes(authorized *gin.RouterGroup, store storage.LicenseStore, keyFormat licensekey.Format, trialLimits license.TrialLimits, resetPolicy hwidreset.Policy, signingSecrets *secretbox.Box, sweeper *jobs.ExpirySweeper) {
+	// Handlers only see the data of the tenant of the principal, the transaction log records the principal
+	// as making their changes
+	scoped := func(c *gin.Context) storage.LicenseStore {
+		return store.ForTenant(middleware.PrincipalFrom(c).TenantId).As(middleware.ActorFrom(c))
+	}
+	acting := func(c *gin.Context) storage.LicenseStore {
+		return store.As(middleware.ActorFrom(c))
+	}
+
+	authorized.GET("/get", middleware.RequireScope(keyscope.LicensesRead), func(c *gin.Context) { license.GetLicenseHandler(c, scoped(c)) })
+	authorized.GET("/all-licenses", middleware.RequireScope(keyscope.LicensesRead), func(c *gin.Context) { license.GetAllLicensesHandler(c, scoped(c)) })
+	authorized.POST("/add-license", middleware.RequireScope(keyscope.LicensesWrite), func(c *gin.Context) { license.AddLicenseHandler(c, scoped(c), keyFormat, trialLimits) })
+	authorized.POST("/del-license", middleware.RequireScope(keyscope.LicensesDelete), func(c *gin.Context) { license.DeletelicenseHandler(c, scoped(c)) })
+	authorized.POST("/freeze-license", middleware.RequireScope(keyscope.LicensesFreeze), func(c *gin.Context) { license.FreezeLicenseHandler(c, scoped(c)) })
+	authorized.POST("/unfreeze-license", middleware.RequireScope(keyscope.LicensesFreeze), func(c *gin.Context) { license.UnfreezeLicenseHandler(c, scoped(c)) })
+	authorized.POST("/reset-license-secret", middleware.RequireScope(keyscope.MachinesManage), func(c *gin.Context) { license.ResetLicenseSecretHandler(c, scoped(c)) })
+	authorized.POST("/renew-license", middleware.RequireScope(keyscope.LicensesRenew), func(c *gin.Context) { license.RenewLicenseHandler(c, scoped(c)) })
+	authorized.GET("/renewals", middleware.RequireScope(keyscope.LicensesRead), func(c *gin.Context) { license.GetRenewalsHandler(c, scoped(c)) })
+	authorized.GET("/activations", middleware.RequireScope(keyscope.LicensesRead), func(c *gin.Context) { license.GetActivationsHandler(c, scoped(c)) })
+	authorized.GET("/hwid-resets", middleware.RequireScope(keyscope.LicensesRead), func(c *gin.Context) { license.GetHwidResetsHandler(c, scoped(c), resetPolicy) })
+	authorized.POST("/deactivate-machine", middleware.RequireScope(keyscope.MachinesManage), func(c *gin.Context) { license.DeactivateMachineHandler(c, scoped(c)) })
+	authorized.POST("/set-max-activations", middleware.RequireScope(keyscope.LicensesWrite), func(c *gin.Context) { license.SetMaxActivationsHandler(c, scoped(c)) })
+	authorized.GET("/sessions", middleware.RequireScope(keyscope.LicensesRead), func(c *gin.Context) { license.GetSessionsHandler(c, scoped(c)) })
+	authorized.POST("/set-max-sessions", middleware.RequireScope(keyscope.LicensesWrite), func(c *gin.Context) { license.SetMaxSessionsHandler(c, scoped(c)) })
+	authorized.GET("/license-entitlements", middleware.RequireScope(keyscope.LicensesRead), func(c *gin.Context) { license.GetLicenseEntitlementsHandler(c, scoped(c)) })
+	authorized.POST("/set-license-entitlement", middleware.RequireScope(keyscope.LicensesWrite), func(c *gin.Context) { license.SetLicenseEntitlementHandler(c, scoped(c)) })
+	authorized.POST("/remove-license-entitlement", middleware.RequireScope(keyscope.LicensesWrite), func(c *gin.Context) { license.RemoveLicenseEntitlementHandler(c, scoped(c)) })
+	authorized.GET("/meters", middleware.RequireScope(keyscope.LicensesRead), func(c *gin.Context) { license.GetMetersHandler(c, scoped(c)) })
+	authorized.POST("/set-meter", middleware.RequireScope(keyscope.LicensesWrite), func(c *gin.Context) { license.SetMeterHandler(c, scoped(c)) })
+	authorized.POST("/remove-meter", middleware.RequireScope(keyscope.LicensesWrite), func(c *gin.Context) { license.RemoveMeterHandler(c, scoped(c)) })
+	authorized.GET("/all-products", middleware.RequireScope(keyscope.ProductsRead), func(c *gin.Context) { product.GetAllProductsHandler(c, scoped(c)) })
+	authorized.POST("/add-product", middleware.RequireScope(keyscope.ProductsWrite), func(c *gin.Context) { product.AddProductHandler(c, scoped(c)) })
+	authorized.POST("/set-product-grace", middleware.RequireScope(keyscope.ProductsWrite), func(c *gin.Context) { product.SetProductGraceHandler(c, scoped(c)) })
+	authorized.GET("/product-entitlements", middleware.RequireScope(keyscope.ProductsRead), func(c *gin.Context) { product.GetProductEntitlementsHandler(c, scoped(c)) })
+	authorized.POST("/set-product-entitlement", middleware.RequireScope(keyscope.ProductsWrite), func(c *gin.Context) { product.SetProductEntitlementHandler(c, scoped(c)) })
+	authorized.POST("/remove-product-entitlement", middleware.RequireScope(keyscope.ProductsWrite), func(c *gin.Context) { product.RemoveProductEntitlementHandler(c, scoped(c)) })
+	authorized.GET("/expiry-sweeper", middleware.RequireScope(keyscope.TenantsManage), func(c *gin.Context) { expiry.SweeperStatusHandler(c, sweeper) })
+	authorized.POST("/run-expiry-sweeper", middleware.RequireScope(keyscope.TenantsManage), func(c *gin.Context) { expiry.RunSweeperHandler(c, sweeper) })
+	authorized.GET("/api-keys", middleware.RequireScope(keyscope.ApiKeysManage), func(c *gin.Context) { apikey.GetApiKeysHandler(c, scoped(c)) })
+	authorized.POST("/add-api-key", middleware.RequireScope(keyscope.ApiKeysManage), func(c *gin.Context) {
+		apikey.AddApiKeyHandler(c, scoped(c), signingSecrets, middleware.PrincipalFrom(c).Scopes)
+	})
+	authorized.POST("/set-api-key-role", middleware.RequireScope(keyscope.ApiKeysManage), func(c *gin.Context) { apikey.SetApiKeyRoleHandler(c, scoped(c), middleware.PrincipalFrom(c).Scopes) })
+	authorized.POST("/rotate-signing-secret", middleware.RequireScope(keyscope.ApiKeysManage), func(c *gin.Context) { apikey.RotateSigningSecretHandler(c, scoped(c), signingSecrets) })
+	authorized.POST("/revoke-api-key", middleware.RequireScope(keyscope.ApiKeysManage), func(c *gin.Context) { apikey.RevokeApiKeyHandler(c, scoped(c)) })
+	authorized.GET("/tenants", middleware.RequireScope(keyscope.TenantsManage), func(c *gin.Context) { tenant.GetTenantsHandler(c, store) })
+	authorized.POST("/add-tenant", middleware.RequireScope(keyscope.TenantsManage), func(c *gin.Context) { tenant.AddTenantHandler(c, acting(c)) })
+	authorized.POST("/suspend-tenant", middleware.RequireScope(keyscope.TenantsManage), func(c *gin.Context) { tenant.SuspendTenantHandler(c, acting(c)) })
+	authorized.POST("/resume-tenant", middleware.RequireScope(keyscope.TenantsManage), func(c *gin.Context) { tenant.ResumeTenantHandler(c, acting(c)) })
 }
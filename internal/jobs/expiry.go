@@ -0,0 +1,88 @@
+package jobs
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+
+	"github.com/dzhisl/license-manager/internal/lib/grace"
+)
+
+type licenseExpirer interface {
+	ExpireLicenses(now time.Time, defaultGraceDays int) ([]int64, error)
+}
+
+// SweepResult describes one run of the expiry sweeper
+type SweepResult struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Expired    []int64   `json:"expired"` // IDs of the licenses moved to "expired"
+	Error      string    `json:"error,omitempty"`
+}
+
+// ExpirySweeper moves licenses past their grace period to the "expired" status,
+// so the status column can be trusted without checking ExpiresAt
+type ExpirySweeper struct {
+	store         licenseExpirer
+	defaultPolicy grace.Policy // for licenses whose product has no grace period of its own
+	logger        *slog.Logger
+	clock         func() time.Time
+
+	mu      sync.Mutex
+	lastRun *SweepResult
+}
+
+// NewExpirySweeper creates a sweeper that reads the time from clock, time.Now when clock is nil
+func NewExpirySweeper(store licenseExpirer, defaultPolicy grace.Policy, logger *slog.Logger, clock func() time.Time) *ExpirySweeper {
+	if clock == nil {
+		clock = time.Now
+	}
+	return &ExpirySweeper{store: store, defaultPolicy: defaultPolicy, logger: logger, clock: clock}
+}
+
+// Sweep runs the sweeper once, it is safe to call while the scheduled job is running.
+// The result is recorded for LastRun whether or not the sweep failed.
+func (s *ExpirySweeper) Sweep() (SweepResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock()
+	result := SweepResult{StartedAt: now}
+
+	expired, err := s.store.ExpireLicenses(now, s.defaultPolicy.Days)
+	result.Expired = expired
+	result.FinishedAt = s.clock()
+	if err != nil {
+		result.Error = err.Error()
+	}
+	if len(expired) > 0 {
+		s.logger.Info("expired licenses", slog.Int("count", len(expired)))
+	}
+
+	s.lastRun = &result
+	return result, err
+}
+
+// LastRun returns the result of the latest sweep, false if there was none yet
+func (s *ExpirySweeper) LastRun() (SweepResult, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lastRun == nil {
+		return SweepResult{}, false
+	}
+	return *s.lastRun, true
+}
+
+// Job returns the scheduled job running the sweeper every interval
+func (s *ExpirySweeper) Job(interval time.Duration) Job {
+	return Job{
+		Name:     "expire_licenses",
+		Interval: interval,
+		Run: func(time.Time) error {
+			_, err := s.Sweep()
+			return err
+		},
+	}
+}
@@ -0,0 +1,84 @@
+package jobs
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/slog"
+
+	"github.com/dzhisl/license-manager/internal/lib/grace"
+	"github.com/dzhisl/license-manager/internal/lib/licensekey"
+	"github.com/dzhisl/license-manager/internal/storage"
+	"github.com/dzhisl/license-manager/internal/storage/sqlite"
+)
+
+func TestExpirySweeperUsesClock(t *testing.T) {
+	store, err := sqlite.New(filepath.Join(t.TempDir(), "storage.db"), licensekey.NewHasher("test", licensekey.Format{Prefix: "LIC", Groups: 3, GroupSize: 5}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	migrator, err := store.Migrator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Far from the real time, so a sweep that reads the wall clock gives itself away
+	expiresAt := time.Date(2040, time.March, 10, 12, 0, 0, 0, time.UTC)
+	id, err := store.AddLicense(&storage.License{
+		UserId:         "user",
+		Type:           storage.TypeSubscription,
+		Status:         "active",
+		ExpiresAt:      &expiresAt,
+		MaxActivations: 1,
+		MaxSessions:    1,
+	}, "LIC-TEST", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := expiresAt.AddDate(0, 0, 2)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	sweeper := NewExpirySweeper(store, grace.Policy{Days: 3}, logger, func() time.Time { return now })
+
+	result, err := sweeper.Sweep()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Expired) != 0 {
+		t.Fatalf("expired %v during the grace period", result.Expired)
+	}
+
+	now = expiresAt.AddDate(0, 0, 4)
+	result, err = sweeper.Sweep()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Expired) != 1 || result.Expired[0] != id {
+		t.Fatalf("expired %v, want [%d]", result.Expired, id)
+	}
+	if !result.StartedAt.Equal(now) {
+		t.Errorf("sweep started at %v, want %v", result.StartedAt, now)
+	}
+
+	license, err := store.GetLicenseById(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if license.Status != "expired" {
+		t.Errorf("status %q, want expired", license.Status)
+	}
+	if !license.UpdatedAt.Equal(now) {
+		t.Errorf("updated at %v, want %v", license.UpdatedAt, now)
+	}
+
+	last, ok := sweeper.LastRun()
+	if !ok || len(last.Expired) != 1 {
+		t.Errorf("last run %+v, want the second sweep", last)
+	}
+}
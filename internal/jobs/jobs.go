@@ -0,0 +1,41 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/exp/slog"
+
+	"github.com/dzhisl/license-manager/internal/lib/logger/sl"
+)
+
+// Job is a task that runs periodically in the background
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(now time.Time) error
+}
+
+// Start runs job right away and then every Interval in its own goroutine until ctx is cancelled
+func Start(ctx context.Context, logger *slog.Logger, job Job) {
+	run := func(now time.Time) {
+		if err := job.Run(now); err != nil {
+			logger.Error("background job failed", slog.String("job", job.Name), sl.Err(err))
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(job.Interval)
+		defer ticker.Stop()
+
+		run(time.Now())
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				run(now)
+			}
+		}
+	}()
+}
@@ -0,0 +1,29 @@
+package jobs
+
+import (
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+type noncePruner interface {
+	PruneNonces(now time.Time) (int, error)
+}
+
+// PruneNonces returns a job that deletes the nonces of signed requests too old to be replayed
+func PruneNonces(store noncePruner, interval time.Duration, logger *slog.Logger) Job {
+	return Job{
+		Name:     "prune_nonces",
+		Interval: interval,
+		Run: func(now time.Time) error {
+			pruned, err := store.PruneNonces(now)
+			if err != nil {
+				return err
+			}
+			if pruned > 0 {
+				logger.Debug("pruned request nonces", slog.Int("count", pruned))
+			}
+			return nil
+		},
+	}
+}
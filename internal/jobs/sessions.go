@@ -0,0 +1,29 @@
+package jobs
+
+import (
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+type sessionReaper interface {
+	ReapSessions(now time.Time) (int, error)
+}
+
+// ReapSessions returns a job that frees the seats held by sessions that missed their heartbeats
+func ReapSessions(store sessionReaper, interval time.Duration, logger *slog.Logger) Job {
+	return Job{
+		Name:     "reap_sessions",
+		Interval: interval,
+		Run: func(now time.Time) error {
+			reaped, err := store.ReapSessions(now)
+			if err != nil {
+				return err
+			}
+			if reaped > 0 {
+				logger.Info("reaped expired sessions", slog.Int("count", reaped))
+			}
+			return nil
+		},
+	}
+}
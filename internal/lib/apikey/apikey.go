@@ -0,0 +1,130 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+)
+
+// Scopes an API key can be granted, each protected route requires one of them
+const (
+	LicensesRead   = "licenses:read"
+	LicensesWrite  = "licenses:write"
+	LicensesDelete = "licenses:delete"
+	LicensesFreeze = "licenses:freeze"
+	LicensesRenew  = "licenses:renew"
+	MachinesManage = "machines:manage"
+	ProductsRead   = "products:read"
+	ProductsWrite  = "products:write"
+	ApiKeysManage  = "apikeys:manage"
+)
+
+// TenantsManage lets the root key from the config create and suspend tenants.
+// API keys belong to a tenant, so it can't be granted to them.
+const TenantsManage = "tenants:manage"
+
+// Scopes lists every scope an API key can be granted
+var Scopes = []string{
+	LicensesRead, LicensesWrite, LicensesDelete, LicensesFreeze, LicensesRenew,
+	MachinesManage, ProductsRead, ProductsWrite, ApiKeysManage,
+}
+
+// RootScopes are the scopes of the root key from the config
+var RootScopes = append(slices.Clone(Scopes), TenantsManage)
+
+// Role is a named set of scopes given to an API key on top of its own scopes
+type Role string
+
+const (
+	Viewer  Role = "viewer"  // reads licenses and products
+	Support Role = "support" // helps customers: freezes licenses and frees their machines
+	Billing Role = "billing" // sells: creates, changes and renews licenses, manages products
+	Admin   Role = "admin"   // everything
+)
+
+// roleScopes is the permission matrix, which scopes each role grants
+var roleScopes = map[Role][]string{
+	Viewer:  {LicensesRead, ProductsRead},
+	Support: {LicensesRead, ProductsRead, LicensesFreeze, MachinesManage},
+	Billing: {LicensesRead, ProductsRead, LicensesWrite, LicensesRenew, ProductsWrite},
+	Admin:   Scopes,
+}
+
+// Valid reports whether r is a known role
+func (r Role) Valid() bool {
+	_, ok := roleScopes[r]
+	return ok
+}
+
+// Scopes returns the scopes the role grants, none for unknown roles
+func (r Role) Scopes() []string {
+	return roleScopes[r]
+}
+
+// Grant returns the scopes of the role together with the extra scopes, without duplicates
+func Grant(role Role, scopes []string) []string {
+	granted := slices.Clone(role.Scopes())
+	for _, scope := range scopes {
+		if !slices.Contains(granted, scope) {
+			granted = append(granted, scope)
+		}
+	}
+	return granted
+}
+
+// Missing returns the first of wanted that held lacks, empty when held has them all.
+// A key can only hand out the scopes it has itself.
+func Missing(held, wanted []string) string {
+	for _, scope := range wanted {
+		if !slices.Contains(held, scope) {
+			return scope
+		}
+	}
+	return ""
+}
+
+// prefix marks API keys so they are easy to tell apart from license keys and to spot in leaked text
+const prefix = "lmk_"
+
+// signingSecretPrefix marks the secrets API keys sign their requests with, see pkg/reqsign
+const signingSecretPrefix = "lms_"
+
+// displayLength is how many characters of a key are kept for display, prefix included
+const displayLength = len(prefix) + 8
+
+// Generate returns a new random API key
+func Generate() (string, error) {
+	return random(prefix, 24)
+}
+
+// GenerateSigningSecret returns a new random request signing secret
+func GenerateSigningSecret() (string, error) {
+	return random(signingSecretPrefix, 32)
+}
+
+func random(prefix string, size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
+
+// DisplayPrefix returns the part of key that is safe to show in listings and logs
+func DisplayPrefix(key string) string {
+	if len(key) > displayLength {
+		return key[:displayLength]
+	}
+	return key
+}
+
+// ValidateScopes returns an error naming the first unknown scope
+func ValidateScopes(scopes []string) error {
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package fingerprint
+
+// Fingerprint describes a machine by its hardware components, component name (e.g. "cpu", "board",
+// "disk", "mac") to a hash of its value. Clients hash the values, the server only compares them.
+type Fingerprint map[string]string
+
+// Policy decides how much of a known fingerprint has to match to still be the same machine
+type Policy struct {
+	// Threshold is the share of the known components that must match, between 0 and 1
+	Threshold float64
+}
+
+// Matched returns how many components of known are the same in fp
+func Matched(known, fp Fingerprint) int {
+	matched := 0
+	for component, hash := range known {
+		if hash != "" && fp[component] == hash {
+			matched++
+		}
+	}
+	return matched
+}
+
+// Matches reports whether fp is still the machine known by the fingerprint known.
+// At least one component has to match, so an empty fingerprint never matches.
+func (p Policy) Matches(known, fp Fingerprint) bool {
+	matched := Matched(known, fp)
+	return matched > 0 && float64(matched) >= p.Threshold*float64(len(known))
+}
@@ -0,0 +1,34 @@
+package grace
+
+import "time"
+
+// State is how a license can be used at a given moment
+type State string
+
+const (
+	Active  State = "active"  // before the expiry date
+	Grace   State = "grace"   // past the expiry date, but still usable
+	Expired State = "expired" // past the end of the grace period
+)
+
+// Policy decides how long a license keeps working after its expiry date
+type Policy struct {
+	Days int
+}
+
+// EndsAt returns when a license expiring at expiresAt stops working
+func (p Policy) EndsAt(expiresAt time.Time) time.Time {
+	return expiresAt.AddDate(0, 0, p.Days)
+}
+
+// State returns the state at now of a license expiring at expiresAt
+func (p Policy) State(expiresAt, now time.Time) State {
+	switch {
+	case !now.After(expiresAt):
+		return Active
+	case now.Before(p.EndsAt(expiresAt)):
+		return Grace
+	default:
+		return Expired
+	}
+}
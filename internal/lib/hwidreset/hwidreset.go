@@ -0,0 +1,35 @@
+package hwidreset
+
+import "time"
+
+// Policy limits how often the owner of a license can move it to another machine
+type Policy struct {
+	Limit    int           // resets allowed within Window
+	Window   time.Duration // rolling window Limit applies to
+	Cooldown time.Duration // minimum time between two resets
+}
+
+// NextAllowed returns when the next reset is allowed after the earlier resets, given oldest first.
+// The zero time means right away.
+func (p Policy) NextAllowed(resets []time.Time) time.Time {
+	var next time.Time
+	if len(resets) == 0 {
+		return next
+	}
+
+	next = resets[len(resets)-1].Add(p.Cooldown)
+
+	// Once Limit resets fall within the window, the oldest of them has to leave it first
+	if len(resets) >= p.Limit {
+		if windowFree := resets[len(resets)-p.Limit].Add(p.Window); windowFree.After(next) {
+			next = windowFree
+		}
+	}
+
+	return next
+}
+
+// Allowed reports whether a reset is allowed at now after the earlier resets, given oldest first
+func (p Policy) Allowed(resets []time.Time, now time.Time) bool {
+	return !now.Before(p.NextAllowed(resets))
+}
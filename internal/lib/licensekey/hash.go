@@ -0,0 +1,85 @@
+package licensekey
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// legacyDisplayLength is how many characters of a legacy key are kept for display
+const legacyDisplayLength = 4
+
+// displayLength is how many characters of the first group of a formatted key are kept for display at most
+const displayLength = 4
+
+// Hasher turns license keys into what is stored at rest: a keyed hash and a display prefix
+type Hasher struct {
+	secret []byte
+	format Format
+}
+
+// NewHasher returns a Hasher keyed with the server secret for keys of format
+func NewHasher(secret string, format Format) *Hasher {
+	return &Hasher{secret: []byte(secret), format: format}
+}
+
+// Hash returns the hex encoded HMAC-SHA256 of key
+func (h *Hasher) Hash(key string) string {
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write([]byte(key))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// DisplayPrefix returns the part of key that is safe to show in listings and logs: the product prefix
+// and the first few characters of a formatted key, never more than a quarter of its groups,
+// or the first few characters of a legacy one
+func (h *Hasher) DisplayPrefix(key string) string {
+	parts := strings.Split(key, separator)
+
+	var prefix string
+	switch len(parts) {
+	case h.format.Groups + 2:
+		prefix, parts = parts[0]+separator, parts[1:]
+	case h.format.Groups + 1:
+	default:
+		if len(key) > legacyDisplayLength {
+			return key[:legacyDisplayLength]
+		}
+		return key
+	}
+
+	return prefix + parts[0][:h.shown(parts[0])]
+}
+
+// ShortenDisplayPrefix cuts a display prefix stored when it was the first two parts of the key down to
+// what DisplayPrefix keeps. A first part that looks like a group is taken for one, so the result never
+// shows more of the key than DisplayPrefix would.
+func (h *Hasher) ShortenDisplayPrefix(displayPrefix string) string {
+	first, rest, found := strings.Cut(displayPrefix, separator)
+	if h.isGroup(first) {
+		return first[:h.shown(first)]
+	}
+	if !found {
+		return displayPrefix
+	}
+	return first + separator + rest[:h.shown(rest)]
+}
+
+// shown returns how many characters of group are kept for display
+func (h *Hasher) shown(group string) int {
+	return min(displayLength, h.format.Groups*h.format.GroupSize/4, len(group))
+}
+
+// isGroup reports whether s could be a group of a formatted key
+func (h *Hasher) isGroup(s string) bool {
+	if len(s) != h.format.GroupSize {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(Alphabet, s[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
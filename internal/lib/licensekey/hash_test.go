@@ -0,0 +1,61 @@
+package licensekey
+
+import "testing"
+
+func TestDisplayPrefix(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		key    string
+		want   string
+	}{
+		{"prefixed", testFormat, "LIC-ABCDE-FGHJK-LMNPQ-5", "LIC-ABC"},
+		{"without prefix", testFormat, "ABCDE-FGHJK-LMNPQ-5", "ABC"},
+		{"long groups", Format{Groups: 4, GroupSize: 8}, "ABCDEFGH-JKLMNPQR-STUVWXYZ-23456789-5", "ABCD"},
+		{"one group", Format{Prefix: "LIC", Groups: 1, GroupSize: 5}, "LIC-ABCDE-5", "LIC-A"},
+		{"one short group", Format{Groups: 1, GroupSize: 3}, "ABC-5", ""},
+		{"legacy", testFormat, "abcDEF1234", "abcD"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewHasher("test", tt.format).DisplayPrefix(tt.key); got != tt.want {
+				t.Errorf("DisplayPrefix(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShortenDisplayPrefix(t *testing.T) {
+	tests := []struct {
+		name          string
+		displayPrefix string
+		want          string
+	}{
+		{"prefixed", "LIC-ABCDE", "LIC-ABC"},
+		{"without prefix", "ABCDE-FGHJK", "ABC"},
+		{"prefix that looks like a group", "APPXY-ABCDE", "APP"},
+		{"already short", "LIC-ABC", "LIC-ABC"},
+		{"already short without prefix", "ABC", "ABC"},
+		{"legacy", "abcD", "abcD"},
+	}
+
+	hasher := NewHasher("test", testFormat)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasher.ShortenDisplayPrefix(tt.displayPrefix); got != tt.want {
+				t.Errorf("ShortenDisplayPrefix(%q) = %q, want %q", tt.displayPrefix, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShortenDisplayPrefixKeepsCurrentOnes(t *testing.T) {
+	hasher := NewHasher("test", testFormat)
+	for _, key := range []string{"LIC-ABCDE-FGHJK-LMNPQ-5", "ABCDE-FGHJK-LMNPQ-5"} {
+		want := hasher.DisplayPrefix(key)
+		if got := hasher.ShortenDisplayPrefix(want); got != want {
+			t.Errorf("ShortenDisplayPrefix(%q) = %q, want it unchanged", want, got)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package licensekey
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Alphabet contains no characters that are easy to confuse when read or typed (0/O, 1/I).
+// It has exactly 32 symbols so a random byte maps onto it without modulo bias.
+const Alphabet = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+
+const separator = "-"
+
+var (
+	ErrMalformed   = errors.New("malformed license key")
+	ErrBadChecksum = errors.New("license key checksum mismatch")
+)
+
+var (
+	prefixRe = regexp.MustCompile(`^[A-Z0-9]{1,10}$`)
+	legacyRe = regexp.MustCompile(`^[A-Za-z0-9]{10}$`)
+)
+
+// Format describes the shape of generated keys: PREFIX-XXXXX-XXXXX-XXXXX-C
+type Format struct {
+	Prefix    string
+	Groups    int
+	GroupSize int
+	// AcceptLegacy lets Check pass the 10 character keys issued before this format existed
+	AcceptLegacy bool
+}
+
+// ValidatePrefix reports whether p can be used as a key prefix
+func ValidatePrefix(p string) error {
+	if p != "" && !prefixRe.MatchString(p) {
+		return fmt.Errorf("key prefix must be 1-10 characters of A-Z and 0-9")
+	}
+	return nil
+}
+
+// WithPrefix returns a copy of the format using prefix p, keeping the default when p is empty
+func (f Format) WithPrefix(p string) Format {
+	if p != "" {
+		f.Prefix = p
+	}
+	return f
+}
+
+// Generate returns a new random key using crypto/rand
+func (f Format) Generate() (string, error) {
+	body := make([]byte, f.Groups*f.GroupSize)
+	if _, err := rand.Read(body); err != nil {
+		return "", fmt.Errorf("licensekey.Generate: %w", err)
+	}
+	for i, b := range body {
+		body[i] = Alphabet[int(b)%len(Alphabet)]
+	}
+
+	parts := make([]string, 0, f.Groups+2)
+	if f.Prefix != "" {
+		parts = append(parts, f.Prefix)
+	}
+	for i := 0; i < f.Groups; i++ {
+		parts = append(parts, string(body[i*f.GroupSize:(i+1)*f.GroupSize]))
+	}
+	parts = append(parts, string(checkChar(string(body))))
+
+	return strings.Join(parts, separator), nil
+}
+
+// Check verifies the structure and check character of key without touching the database
+func (f Format) Check(key string) error {
+	if f.AcceptLegacy && legacyRe.MatchString(key) {
+		return nil
+	}
+
+	parts := strings.Split(key, separator)
+
+	// The prefix is per product, so any valid prefix is accepted
+	switch len(parts) {
+	case f.Groups + 2:
+		if !prefixRe.MatchString(parts[0]) {
+			return ErrMalformed
+		}
+		parts = parts[1:]
+	case f.Groups + 1:
+	default:
+		return ErrMalformed
+	}
+
+	groups, check := parts[:f.Groups], parts[f.Groups]
+	if len(check) != 1 || strings.IndexByte(Alphabet, check[0]) < 0 {
+		return ErrMalformed
+	}
+
+	var body strings.Builder
+	for _, group := range groups {
+		if len(group) != f.GroupSize {
+			return ErrMalformed
+		}
+		for i := 0; i < len(group); i++ {
+			if strings.IndexByte(Alphabet, group[i]) < 0 {
+				return ErrMalformed
+			}
+		}
+		body.WriteString(group)
+	}
+
+	if checkChar(body.String()) != check[0] {
+		return ErrBadChecksum
+	}
+
+	return nil
+}
+
+// checkChar computes a Luhn mod 32 check character over body, which catches
+// every single-character typo and most transpositions of adjacent characters
+func checkChar(body string) byte {
+	n := len(Alphabet)
+	factor := 2
+	sum := 0
+
+	for i := len(body) - 1; i >= 0; i-- {
+		addend := factor * strings.IndexByte(Alphabet, body[i])
+		addend = addend/n + addend%n
+		sum += addend
+
+		if factor == 2 {
+			factor = 1
+		} else {
+			factor = 2
+		}
+	}
+
+	return Alphabet[(n-sum%n)%n]
+}
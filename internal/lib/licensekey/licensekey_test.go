@@ -0,0 +1,108 @@
+package licensekey
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var testFormat = Format{Prefix: "LIC", Groups: 3, GroupSize: 5}
+
+func TestCheck(t *testing.T) {
+	legacy := testFormat
+	legacy.AcceptLegacy = true
+
+	tests := []struct {
+		name   string
+		format Format
+		key    string
+		want   error
+	}{
+		{"valid", testFormat, "LIC-ABCDE-FGHJK-LMNPQ-5", nil},
+		{"valid without prefix", testFormat, "ABCDE-FGHJK-LMNPQ-5", nil},
+		{"valid with another product's prefix", testFormat, "APP2-ABCDE-FGHJK-LMNPQ-5", nil},
+		{"valid with repeated characters", testFormat, "LIC-23456-23456-Z2Z2Z-7", nil},
+		{"legacy key accepted", legacy, "abcDEF1234", nil},
+		{"legacy key rejected", testFormat, "abcDEF1234", ErrMalformed},
+		{"typo", testFormat, "LIC-ABCDE-FGHJK-LMNPR-5", ErrBadChecksum},
+		{"wrong check character", testFormat, "LIC-ABCDE-FGHJK-LMNPQ-6", ErrBadChecksum},
+		{"adjacent transposition", testFormat, "LIC-BACDE-FGHJK-LMNPQ-5", ErrBadChecksum},
+		{"zero", testFormat, "LIC-ABCD0-FGHJK-LMNPQ-5", ErrMalformed},
+		{"letter O", testFormat, "LIC-ABCDO-FGHJK-LMNPQ-5", ErrMalformed},
+		{"one", testFormat, "LIC-ABCD1-FGHJK-LMNPQ-5", ErrMalformed},
+		{"letter I", testFormat, "LIC-ABCDI-FGHJK-LMNPQ-5", ErrMalformed},
+		{"lower case", testFormat, "LIC-abcde-FGHJK-LMNPQ-5", ErrMalformed},
+		{"check character outside the alphabet", testFormat, "LIC-ABCDE-FGHJK-LMNPQ-0", ErrMalformed},
+		{"short group", testFormat, "LIC-ABCD-FGHJK-LMNPQ-5", ErrMalformed},
+		{"missing group", testFormat, "LIC-ABCDE-FGHJK-5", ErrMalformed},
+		{"long check character", testFormat, "LIC-ABCDE-FGHJK-LMNPQ-55", ErrMalformed},
+		{"bad prefix", testFormat, "lic-ABCDE-FGHJK-LMNPQ-5", ErrMalformed},
+		{"empty", testFormat, "", ErrMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.format.Check(tt.key); !errors.Is(err, tt.want) {
+				t.Errorf("Check(%q) = %v, want %v", tt.key, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckCatchesSingleCharacterTypos(t *testing.T) {
+	const body = "ABCDEFGHJKLMNPQ"
+	check := checkChar(body)
+
+	for pos := 0; pos < len(body); pos++ {
+		for i := 0; i < len(Alphabet); i++ {
+			if Alphabet[i] == body[pos] {
+				continue
+			}
+			typo := body[:pos] + string(Alphabet[i]) + body[pos+1:]
+			if checkChar(typo) == check {
+				t.Errorf("typo %q of %q has the same check character", typo, body)
+			}
+		}
+	}
+}
+
+func TestCheckCatchesAdjacentTranspositions(t *testing.T) {
+	// Luhn mod N can't tell the first and the last symbol of the alphabet apart when they swap places
+	undetected := string(Alphabet[0]) + string(Alphabet[len(Alphabet)-1])
+
+	for i := 0; i < len(Alphabet); i++ {
+		for j := 0; j < len(Alphabet); j++ {
+			if i == j {
+				continue
+			}
+			pair := string(Alphabet[i]) + string(Alphabet[j])
+			swapped := string(Alphabet[j]) + string(Alphabet[i])
+
+			for pos := 0; pos < 14; pos++ {
+				body := strings.Repeat("A", pos) + pair + strings.Repeat("A", 13-pos)
+				transposed := strings.Repeat("A", pos) + swapped + strings.Repeat("A", 13-pos)
+
+				detected := checkChar(body) != checkChar(transposed)
+				wantDetected := pair != undetected && swapped != undetected
+				if detected != wantDetected {
+					t.Errorf("transposing %q at %d: detected %t, want %t", pair, pos, detected, wantDetected)
+				}
+			}
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		key, err := testFormat.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(key, "LIC-") || len(key) != len("LIC-ABCDE-FGHJK-LMNPQ-5") {
+			t.Fatalf("generated %q", key)
+		}
+		if err := testFormat.Check(key); err != nil {
+			t.Fatalf("Check(%q) = %v for a generated key", key, err)
+		}
+	}
+}
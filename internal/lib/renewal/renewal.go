@@ -0,0 +1,99 @@
+package renewal
+
+import (
+	"errors"
+	"time"
+)
+
+// Mode decides where a renewal starts counting from
+type Mode string
+
+const (
+	// FromExpiry extends from the current expiry date, so an early renewal keeps the days left.
+	// A license that has already expired is extended from now instead.
+	FromExpiry Mode = "extend_from_expiry"
+	// FromNow extends from the moment of the renewal
+	FromNow Mode = "extend_from_now"
+	// SetDate replaces the expiry date with Plan.Date
+	SetDate Mode = "set_absolute_date"
+)
+
+var (
+	ErrEmptyTerm = errors.New("renewal term is empty")
+	ErrPastDate  = errors.New("set_absolute_date needs a date in the future")
+)
+
+// Term is a length of time in calendar units
+type Term struct {
+	Years  int
+	Months int
+	Days   int
+}
+
+// IsZero reports whether the term adds no time at all
+func (t Term) IsZero() bool {
+	return t.Years == 0 && t.Months == 0 && t.Days == 0
+}
+
+// AddTo adds the term to t. Years and months keep the day of the month when the target
+// month has it and end on its last day otherwise, so Jan 31 plus one month is Feb 28 (or 29).
+func (t Term) AddTo(from time.Time) time.Time {
+	months := t.Years*12 + t.Months
+	if months != 0 {
+		year, month, day := from.Date()
+		firstOfTarget := time.Date(year, month+time.Month(months), 1, 0, 0, 0, 0, from.Location())
+		if last := daysIn(firstOfTarget); day > last {
+			day = last
+		}
+		hour, min, sec := from.Clock()
+		from = time.Date(firstOfTarget.Year(), firstOfTarget.Month(), day, hour, min, sec, from.Nanosecond(), from.Location())
+	}
+	return from.AddDate(0, 0, t.Days)
+}
+
+// Plan describes a single renewal
+type Plan struct {
+	Mode Mode
+	Term Term      // used by FromExpiry and FromNow
+	Date time.Time // used by SetDate
+}
+
+// Validate checks that the plan has what its mode needs, a date it sets must be after now
+func (p Plan) Validate(now time.Time) error {
+	switch p.Mode {
+	case FromExpiry, FromNow:
+		if p.Term.IsZero() {
+			return ErrEmptyTerm
+		}
+		return nil
+	case SetDate:
+		if p.Date.IsZero() {
+			return errors.New("set_absolute_date needs a date")
+		}
+		if !p.Date.After(now) {
+			return ErrPastDate
+		}
+		return nil
+	default:
+		return errors.New("unknown renewal mode " + string(p.Mode))
+	}
+}
+
+// NewExpiry returns the expiry date of a license currently expiring at expiresAt
+// after it is renewed at now
+func (p Plan) NewExpiry(expiresAt, now time.Time) time.Time {
+	switch p.Mode {
+	case SetDate:
+		return p.Date
+	case FromExpiry:
+		if expiresAt.After(now) {
+			return p.Term.AddTo(expiresAt)
+		}
+	}
+	return p.Term.AddTo(now)
+}
+
+// daysIn returns the number of days in the month of t
+func daysIn(t time.Time) int {
+	return time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location()).Day()
+}
@@ -0,0 +1,98 @@
+package renewal
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 12, 30, 0, 0, time.UTC)
+}
+
+func TestTermAddTo(t *testing.T) {
+	tests := []struct {
+		name string
+		term Term
+		from time.Time
+		want time.Time
+	}{
+		{"one month", Term{Months: 1}, date(2025, time.March, 15), date(2025, time.April, 15)},
+		{"Jan 31 plus one month", Term{Months: 1}, date(2025, time.January, 31), date(2025, time.February, 28)},
+		{"Jan 31 plus one month in a leap year", Term{Months: 1}, date(2024, time.January, 31), date(2024, time.February, 29)},
+		{"Mar 31 plus one month", Term{Months: 1}, date(2025, time.March, 31), date(2025, time.April, 30)},
+		{"Aug 31 plus six months", Term{Months: 6}, date(2025, time.August, 31), date(2026, time.February, 28)},
+		{"Dec 31 plus two months", Term{Months: 2}, date(2025, time.December, 31), date(2026, time.February, 28)},
+		{"Feb 29 plus one year", Term{Years: 1}, date(2024, time.February, 29), date(2025, time.February, 28)},
+		{"Feb 29 plus four years", Term{Years: 4}, date(2024, time.February, 29), date(2028, time.February, 29)},
+		{"Feb 28 plus one month keeps the day", Term{Months: 1}, date(2025, time.February, 28), date(2025, time.March, 28)},
+		{"thirteen months", Term{Months: 13}, date(2025, time.January, 31), date(2026, time.February, 28)},
+		{"days are added after the months", Term{Months: 1, Days: 1}, date(2025, time.January, 31), date(2025, time.March, 1)},
+		{"days only", Term{Days: 30}, date(2025, time.January, 31), date(2025, time.March, 2)},
+		{"zero term", Term{}, date(2025, time.January, 31), date(2025, time.January, 31)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.term.AddTo(tt.from); !got.Equal(tt.want) {
+				t.Errorf("%+v.AddTo(%v) = %v, want %v", tt.term, tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanValidate(t *testing.T) {
+	now := date(2025, time.June, 1)
+
+	tests := []struct {
+		name    string
+		plan    Plan
+		wantErr error
+		ok      bool
+	}{
+		{"extend", Plan{Mode: FromExpiry, Term: Term{Months: 1}}, nil, true},
+		{"extend by nothing", Plan{Mode: FromNow}, ErrEmptyTerm, false},
+		{"future date", Plan{Mode: SetDate, Date: now.Add(time.Second)}, nil, true},
+		{"now", Plan{Mode: SetDate, Date: now}, ErrPastDate, false},
+		{"past date", Plan{Mode: SetDate, Date: now.AddDate(0, 0, -1)}, ErrPastDate, false},
+		{"no date", Plan{Mode: SetDate}, nil, false},
+		{"unknown mode", Plan{Mode: "extend_forever", Term: Term{Days: 1}}, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.plan.Validate(now)
+			if (err == nil) != tt.ok {
+				t.Fatalf("Validate() = %v, want ok %t", err, tt.ok)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPlanNewExpiry(t *testing.T) {
+	now := date(2025, time.June, 1)
+	month := Term{Months: 1}
+
+	tests := []struct {
+		name      string
+		plan      Plan
+		expiresAt time.Time
+		want      time.Time
+	}{
+		{"early renewal keeps the days left", Plan{Mode: FromExpiry, Term: month}, date(2025, time.June, 20), date(2025, time.July, 20)},
+		{"expired license extends from now", Plan{Mode: FromExpiry, Term: month}, date(2025, time.May, 1), date(2025, time.July, 1)},
+		{"from now", Plan{Mode: FromNow, Term: month}, date(2025, time.June, 20), date(2025, time.July, 1)},
+		{"set date", Plan{Mode: SetDate, Date: date(2030, time.January, 1)}, date(2025, time.June, 20), date(2030, time.January, 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.plan.NewExpiry(tt.expiresAt, now); !got.Equal(tt.want) {
+				t.Errorf("NewExpiry(%v) = %v, want %v", tt.expiresAt, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package secretbox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// ErrMalformed is returned for sealed values that weren't sealed with the same server secret
+var ErrMalformed = errors.New("secretbox: malformed or tampered sealed value")
+
+// Box encrypts secrets the server has to read back later, unlike keys that are only ever hashed
+type Box struct {
+	aead cipher.AEAD
+}
+
+// New returns a Box keyed with a key derived from the server secret for purpose,
+// so the same server secret never directly keys two different things
+func New(serverSecret, purpose string) (*Box, error) {
+	mac := hmac.New(sha256.New, []byte(serverSecret))
+	mac.Write([]byte(purpose))
+
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, fmt.Errorf("secretbox: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("secretbox: %w", err)
+	}
+
+	return &Box{aead: aead}, nil
+}
+
+// Seal encrypts plaintext and returns it base64 encoded with its nonce
+func (b *Box) Seal(plaintext string) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("secretbox: %w", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(b.aead.Seal(nonce, nonce, []byte(plaintext), nil)), nil
+}
+
+// Open decrypts a value returned by Seal
+func (b *Box) Open(sealed string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < b.aead.NonceSize() {
+		return "", ErrMalformed
+	}
+
+	nonce, ciphertext := data[:b.aead.NonceSize()], data[b.aead.NonceSize():]
+	plaintext, err := b.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", ErrMalformed
+	}
+
+	return string(plaintext), nil
+}
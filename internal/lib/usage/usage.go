@@ -0,0 +1,59 @@
+package usage
+
+import "time"
+
+// Period is how often the usage of a meter starts over, periods follow the calendar in UTC
+type Period string
+
+const (
+	Day      Period = "day"
+	Month    Period = "month"
+	Year     Period = "year"
+	Lifetime Period = "lifetime" // never resets
+)
+
+// Valid reports whether p is a known period
+func (p Period) Valid() bool {
+	switch p {
+	case Day, Month, Year, Lifetime:
+		return true
+	}
+	return false
+}
+
+// Start returns the start of the period that contains now.
+// A lifetime period starts whenever it is first asked for.
+func (p Period) Start(now time.Time) time.Time {
+	now = now.UTC()
+	switch p {
+	case Day:
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	case Month:
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case Year:
+		return time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return now
+	}
+}
+
+// End returns when the period starting at start is over, false for lifetime periods
+func (p Period) End(start time.Time) (time.Time, bool) {
+	start = start.UTC()
+	switch p {
+	case Day:
+		return start.AddDate(0, 0, 1), true
+	case Month:
+		return start.AddDate(0, 1, 0), true
+	case Year:
+		return start.AddDate(1, 0, 0), true
+	default:
+		return time.Time{}, false
+	}
+}
+
+// Ended reports whether the period starting at start is over at now
+func (p Period) Ended(start, now time.Time) bool {
+	end, ok := p.End(start)
+	return ok && !now.Before(end)
+}
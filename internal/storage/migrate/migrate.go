@@ -0,0 +1,253 @@
+package migrate
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Placeholder renders the n-th (1-based) bind parameter for a SQL dialect
+type Placeholder func(n int) string
+
+// Question renders "?" placeholders (SQLite)
+func Question(int) string { return "?" }
+
+// Dollar renders "$n" placeholders (PostgreSQL)
+func Dollar(n int) string { return "$" + strconv.Itoa(n) }
+
+// Migration is a single numbered schema change with its rollback
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status describes whether a known migration has been applied
+type Status struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// Migrator applies and rolls back migrations, tracking them in the schema_version table
+type Migrator struct {
+	db          *sql.DB
+	migrations  []Migration
+	placeholder Placeholder
+}
+
+// fileNameRe matches migration files such as 0001_init.up.sql
+var fileNameRe = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+const createSchemaVersionTable = `
+CREATE TABLE IF NOT EXISTS schema_version (
+    version INTEGER PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    applied_at TIMESTAMP NOT NULL
+);`
+
+// New loads every *.up.sql / *.down.sql pair from the root of fsys
+func New(db *sql.DB, fsys fs.FS, placeholder Placeholder) (*Migrator, error) {
+	const op = "storage.migrate.New"
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		match := fileNameRe.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid version in %s: %w", op, entry.Name(), err)
+		}
+
+		body, err := fs.ReadFile(fsys, path.Clean(entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("%s: conflicting names for version %d: %s and %s", op, version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("%s: migration %d_%s has no up script", op, m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return &Migrator{db: db, migrations: migrations, placeholder: placeholder}, nil
+}
+
+// Up applies every pending migration in order and returns the ones it applied
+func (m *Migrator) Up() ([]Migration, error) {
+	const op = "storage.migrate.Up"
+
+	current, err := m.Version()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var applied []Migration
+	for _, migration := range m.migrations {
+		if migration.Version <= current {
+			continue
+		}
+
+		insert := fmt.Sprintf(`INSERT INTO schema_version (version, name, applied_at) VALUES (%s, %s, %s)`,
+			m.placeholder(1), m.placeholder(2), m.placeholder(3))
+
+		err := m.inTx(migration.Up, insert, migration.Version, migration.Name, time.Now().UTC())
+		if err != nil {
+			return applied, fmt.Errorf("%s: migration %d_%s: %w", op, migration.Version, migration.Name, err)
+		}
+
+		applied = append(applied, migration)
+	}
+
+	return applied, nil
+}
+
+// Down rolls back the given number of most recently applied migrations
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	const op = "storage.migrate.Down"
+
+	current, err := m.Version()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var rolledBack []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(rolledBack) < steps; i-- {
+		migration := m.migrations[i]
+		if migration.Version > current {
+			continue
+		}
+		if migration.Down == "" {
+			return rolledBack, fmt.Errorf("%s: migration %d_%s has no down script", op, migration.Version, migration.Name)
+		}
+
+		remove := fmt.Sprintf(`DELETE FROM schema_version WHERE version = %s`, m.placeholder(1))
+
+		if err := m.inTx(migration.Down, remove, migration.Version); err != nil {
+			return rolledBack, fmt.Errorf("%s: migration %d_%s: %w", op, migration.Version, migration.Name, err)
+		}
+
+		rolledBack = append(rolledBack, migration)
+	}
+
+	return rolledBack, nil
+}
+
+// Status lists every known migration together with its applied state
+func (m *Migrator) Status() ([]Status, error) {
+	const op = "storage.migrate.Status"
+
+	if err := m.ensureVersionTable(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := m.db.Query(`SELECT version, applied_at FROM schema_version`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	appliedAt := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		appliedAt[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if at, ok := appliedAt[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = &at
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// Version returns the highest applied migration version, 0 for an empty database
+func (m *Migrator) Version() (int, error) {
+	if err := m.ensureVersionTable(); err != nil {
+		return 0, err
+	}
+
+	var version sql.NullInt64
+	if err := m.db.QueryRow(`SELECT MAX(version) FROM schema_version`).Scan(&version); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	return int(version.Int64), nil
+}
+
+func (m *Migrator) ensureVersionTable() error {
+	_, err := m.db.Exec(createSchemaVersionTable)
+	return err
+}
+
+// inTx runs a migration script and its schema_version bookkeeping atomically
+func (m *Migrator) inTx(script, bookkeeping string, args ...any) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(script); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(bookkeeping, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,180 @@
+package migrate_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dzhisl/license-manager/internal/lib/apikey"
+	"github.com/dzhisl/license-manager/internal/lib/fingerprint"
+	"github.com/dzhisl/license-manager/internal/lib/hwidreset"
+	"github.com/dzhisl/license-manager/internal/lib/licensekey"
+	"github.com/dzhisl/license-manager/internal/lib/renewal"
+	"github.com/dzhisl/license-manager/internal/lib/usage"
+	"github.com/dzhisl/license-manager/internal/storage"
+	"github.com/dzhisl/license-manager/internal/storage/migrate"
+	"github.com/dzhisl/license-manager/internal/storage/sqlite"
+)
+
+var keyFormat = licensekey.Format{Prefix: "LIC", Groups: 3, GroupSize: 5}
+
+// openSQLite returns a store on a new SQLite database and its migrator, nothing applied yet
+func openSQLite(t *testing.T) (*sqlite.Storage, *migrate.Migrator) {
+	t.Helper()
+
+	s, err := sqlite.New(filepath.Join(t.TempDir(), "storage.db"), licensekey.NewHasher("test", keyFormat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	migrator, err := s.Migrator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, migrator
+}
+
+// seed fills every table with rows through the store, including the kinds rollbacks have to
+// carry over: licenses whose keys share a display prefix, perpetual licenses, trials and tenants.
+// Every user owns one license and product codes stay unique across tenants, the first
+// migrations can only be rolled back like that.
+func seed(t *testing.T, s storage.Store) {
+	t.Helper()
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now()
+	expiresAt := now.AddDate(1, 0, 0)
+	limit := int64(3)
+
+	productId, err := s.AddProduct(&storage.Product{Code: "APP", Name: "App", KeyPrefix: "APP"})
+	must(err)
+	must(s.SetProductEntitlement(productId, storage.Entitlement{Feature: "seats", Limit: &limit}))
+
+	subscription, err := s.AddLicense(&storage.License{UserId: "alice", ProductId: &productId, Type: storage.TypeSubscription, Status: "active", ExpiresAt: &expiresAt, MaxActivations: 2, MaxSessions: 1}, "LIC-AAAAA-BBBBB-CCCCC-2", "secret")
+	must(err)
+	_, err = s.AddLicense(&storage.License{UserId: "erin", Type: storage.TypeSubscription, Status: "frozen", ExpiresAt: &expiresAt, MaxActivations: 1, MaxSessions: 1}, "LIC-AAAAA-DDDDD-EEEEE-3", "")
+	must(err)
+	_, err = s.AddLicense(&storage.License{UserId: "bob", Type: storage.TypePerpetual, Status: "active", UpdatesUntil: &expiresAt, MaxActivations: 1, MaxSessions: 1}, "LIC-FFFFF-GGGGG-HHHHH-4", "")
+	must(err)
+	trial, err := s.AddLicense(&storage.License{UserId: "carol", Type: storage.TypeTrial, Status: "active", ExpiresAt: &expiresAt, MaxActivations: 1, MaxSessions: 1}, "LIC-JJJJJ-KKKKK-LLLLL-5", "")
+	must(err)
+
+	_, err = s.ActivateMachine(subscription, "machine-1", "Laptop", fingerprint.Fingerprint{"cpu": "a1", "disk": "b2"}, fingerprint.Policy{Threshold: 0.6}, "")
+	must(err)
+	_, err = s.ActivateMachine(subscription, "machine-2", "", nil, fingerprint.Policy{}, "")
+	must(err)
+	_, err = s.ResetMachine(subscription, "machine-2", hwidreset.Policy{Limit: 3, Window: 30 * 24 * time.Hour}, now, "secret")
+	must(err)
+	_, err = s.ActivateMachine(trial, "machine-3", "", nil, fingerprint.Policy{}, "")
+	must(err)
+
+	_, err = s.OpenSession(&storage.Session{LicenseId: subscription, HWID: "machine-1", ExpiresAt: now.Add(time.Hour)}, "session-token")
+	must(err)
+	_, err = s.RenewLicenseById(subscription, renewal.Plan{Mode: renewal.FromExpiry, Term: renewal.Term{Months: 1}})
+	must(err)
+	must(s.SetLicenseEntitlement(subscription, storage.EntitlementOverride{Feature: "export", Enabled: true}))
+	must(s.SetMeter(&storage.Meter{LicenseId: subscription, Name: "api", Quota: 10, Period: usage.Month}))
+	_, err = s.IncrementMeter(subscription, "api", 1, "first", now)
+	must(err)
+
+	keyId, err := s.AddApiKey(&storage.ApiKey{Name: "billing", Role: apikey.Billing}, "api-key")
+	must(err)
+	must(s.UseNonce(keyId, "nonce", now.Add(time.Minute)))
+
+	tenantId, err := s.AddTenant(&storage.Tenant{Name: "Acme"})
+	must(err)
+	acme := s.ForTenant(tenantId)
+	_, err = acme.AddProduct(&storage.Product{Code: "ACME", Name: "Acme App"})
+	must(err)
+	_, err = acme.AddLicense(&storage.License{UserId: "dave", Type: storage.TypeSubscription, Status: "active", ExpiresAt: &expiresAt, MaxActivations: 1, MaxSessions: 1}, "LIC-MMMMM-NNNNN-PPPPP-6", "")
+	must(err)
+}
+
+// wantVersion fails the test unless the migrator is at version
+func wantVersion(t *testing.T, migrator *migrate.Migrator, version int) {
+	t.Helper()
+
+	got, err := migrator.Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != version {
+		t.Fatalf("at version %d, want %d", got, version)
+	}
+}
+
+func TestSQLiteRoundTrip(t *testing.T) {
+	s, migrator := openSQLite(t)
+
+	applied, err := migrator.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := applied[len(applied)-1].Version
+	seed(t, s)
+
+	// Roll back one migration at a time, so a failure names the one that broke
+	for version := latest; version > 0; version-- {
+		if _, err := migrator.Down(1); err != nil {
+			t.Fatalf("rolling back %d: %v", version, err)
+		}
+		wantVersion(t, migrator, version-1)
+	}
+
+	if _, err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+	wantVersion(t, migrator, latest)
+	seed(t, s)
+}
+
+func TestSQLiteRollbackKeepsLicenses(t *testing.T) {
+	s, migrator := openSQLite(t)
+
+	applied, err := migrator.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := applied[len(applied)-1].Version
+	seed(t, s)
+
+	// Back to just after keys were hashed: every license survives and its key still works
+	if _, err := migrator.Down(latest - 4); err != nil {
+		t.Fatal(err)
+	}
+	wantVersion(t, migrator, 4)
+	if _, err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.HashPlaintextKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"LIC-AAAAA-BBBBB-CCCCC-2", "LIC-AAAAA-DDDDD-EEEEE-3", "LIC-FFFFF-GGGGG-HHHHH-4", "LIC-JJJJJ-KKKKK-LLLLL-5", "LIC-MMMMM-NNNNN-PPPPP-6"} {
+		if _, err := s.GetLicenseByLicense(key); err != nil {
+			t.Errorf("GetLicenseByLicense(%q) after the round trip: %v", key, err)
+		}
+	}
+
+	// Before hashing the keys can't be recovered, but every license comes back under a unique value
+	if _, err := migrator.Down(latest - 3); err != nil {
+		t.Fatal(err)
+	}
+	wantVersion(t, migrator, 3)
+	if _, err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+	hashed, err := s.HashPlaintextKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hashed != 5 {
+		t.Errorf("hashed %d keys restored by the rollback, want 5", hashed)
+	}
+}
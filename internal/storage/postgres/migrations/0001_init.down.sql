@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS TransactionLogs;
+DROP TABLE IF EXISTS UserLicense;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS UserLicense (
+    id BIGSERIAL PRIMARY KEY,
+    license VARCHAR(25) NOT NULL UNIQUE,
+    UserId VARCHAR(50) NOT NULL UNIQUE,
+    createdAt TIMESTAMPTZ NOT NULL,
+    updatedAt TIMESTAMPTZ NOT NULL,
+    expiresAt TIMESTAMPTZ NOT NULL,
+    hwid VARCHAR(50),
+    status VARCHAR(10) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS TransactionLogs (
+    id BIGSERIAL PRIMARY KEY,
+    timestamp TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    description TEXT NOT NULL
+);
@@ -0,0 +1,8 @@
+-- Fails if a user owns more than one license, resolve those before rolling back
+DROP INDEX IF EXISTS idx_userlicense_productid;
+DROP INDEX IF EXISTS idx_userlicense_userid;
+
+ALTER TABLE UserLicense DROP COLUMN productId;
+ALTER TABLE UserLicense ADD CONSTRAINT userlicense_userid_key UNIQUE (UserId);
+
+DROP TABLE Products;
@@ -0,0 +1,12 @@
+CREATE TABLE Products (
+    id BIGSERIAL PRIMARY KEY,
+    code VARCHAR(50) NOT NULL UNIQUE,
+    name VARCHAR(255) NOT NULL,
+    createdAt TIMESTAMPTZ NOT NULL
+);
+
+ALTER TABLE UserLicense DROP CONSTRAINT IF EXISTS userlicense_userid_key;
+ALTER TABLE UserLicense ADD COLUMN productId BIGINT REFERENCES Products(id);
+
+CREATE INDEX idx_userlicense_userid ON UserLicense (UserId);
+CREATE INDEX idx_userlicense_productid ON UserLicense (productId);
@@ -0,0 +1,3 @@
+ALTER TABLE Products DROP COLUMN keyPrefix;
+-- Fails while formatted keys longer than 25 characters exist
+ALTER TABLE UserLicense ALTER COLUMN license TYPE VARCHAR(25);
@@ -0,0 +1,3 @@
+-- Formatted keys (PREFIX-XXXXX-XXXXX-XXXXX-C) no longer fit in 25 characters
+ALTER TABLE UserLicense ALTER COLUMN license TYPE VARCHAR(100);
+ALTER TABLE Products ADD COLUMN keyPrefix VARCHAR(10) NOT NULL DEFAULT '';
@@ -0,0 +1,7 @@
+-- Lossy: hashed keys cannot be recovered, so those licenses get their display prefix
+-- followed by their ID as license, which keeps it unique but no longer validates.
+-- Keys not hashed yet are still in displayPrefix and come back as they were.
+UPDATE UserLicense SET displayPrefix = displayPrefix || '-' || id WHERE keyHash IS NOT NULL;
+ALTER TABLE UserLicense DROP COLUMN keyHash;
+ALTER TABLE UserLicense RENAME COLUMN displayPrefix TO license;
+ALTER TABLE UserLicense ADD CONSTRAINT userlicense_license_key UNIQUE (license);
@@ -0,0 +1,6 @@
+-- License keys are stored as an HMAC (keyHash) plus a short displayPrefix.
+-- Existing plaintext keys stay in displayPrefix until the application hashes
+-- them on startup, see Storage.HashPlaintextKeys.
+ALTER TABLE UserLicense DROP CONSTRAINT IF EXISTS userlicense_license_key;
+ALTER TABLE UserLicense RENAME COLUMN license TO displayPrefix;
+ALTER TABLE UserLicense ADD COLUMN keyHash VARCHAR(64) UNIQUE;
@@ -0,0 +1,11 @@
+-- Only the most recently seen machine of each license can be kept
+ALTER TABLE UserLicense ADD COLUMN hwid VARCHAR(50);
+
+UPDATE UserLicense SET hwid = (
+    SELECT LEFT(hwid, 50) FROM Activations
+    WHERE Activations.licenseId = UserLicense.id
+    ORDER BY lastSeen DESC LIMIT 1
+);
+
+ALTER TABLE UserLicense DROP COLUMN maxActivations;
+DROP TABLE Activations;
@@ -0,0 +1 @@
+ALTER TABLE Products DROP COLUMN graceDays;
@@ -0,0 +1,2 @@
+-- Days licenses of the product keep working after they expire, NULL uses expiry.default_grace_days
+ALTER TABLE Products ADD COLUMN graceDays INTEGER;
@@ -0,0 +1,11 @@
+-- Every renewal of a license with its expiry date before and after
+CREATE TABLE RenewalHistory (
+    id BIGSERIAL PRIMARY KEY,
+    licenseId BIGINT NOT NULL REFERENCES UserLicense(id) ON DELETE CASCADE,
+    mode VARCHAR(32) NOT NULL,
+    oldExpiresAt TIMESTAMPTZ NOT NULL,
+    newExpiresAt TIMESTAMPTZ NOT NULL,
+    createdAt TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_renewalhistory_licenseid ON RenewalHistory (licenseId);
@@ -0,0 +1,7 @@
+DROP TABLE TrialMachines;
+
+-- Perpetual licenses get an expiry date far in the future
+UPDATE UserLicense SET expiresAt = '9999-12-31 23:59:59+00' WHERE expiresAt IS NULL;
+ALTER TABLE UserLicense ALTER COLUMN expiresAt SET NOT NULL;
+ALTER TABLE UserLicense DROP COLUMN updatesUntil;
+ALTER TABLE UserLicense DROP COLUMN licenseType;
@@ -0,0 +1,16 @@
+-- Licenses are a subscription, a trial or perpetual. Perpetual licenses have no expiry date.
+ALTER TABLE UserLicense ADD COLUMN licenseType VARCHAR(16) NOT NULL DEFAULT 'subscription';
+ALTER TABLE UserLicense ADD COLUMN updatesUntil TIMESTAMPTZ;
+ALTER TABLE UserLicense ALTER COLUMN expiresAt DROP NOT NULL;
+
+-- Machines that have used a trial, a machine gets one trial per product.
+-- licenseId has no foreign key, deleting the trial doesn't make the machine eligible again.
+CREATE TABLE TrialMachines (
+    id BIGSERIAL PRIMARY KEY,
+    productId BIGINT REFERENCES Products(id),
+    hwid VARCHAR(255) NOT NULL,
+    licenseId BIGINT NOT NULL,
+    createdAt TIMESTAMPTZ NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_trialmachines_product_hwid ON TrialMachines (COALESCE(productId, 0), hwid);
@@ -0,0 +1,18 @@
+-- Features the licenses of a product get, a NULL limitValue means unlimited
+CREATE TABLE ProductEntitlements (
+    id BIGSERIAL PRIMARY KEY,
+    productId BIGINT NOT NULL REFERENCES Products(id) ON DELETE CASCADE,
+    feature VARCHAR(64) NOT NULL,
+    limitValue BIGINT,
+    UNIQUE (productId, feature)
+);
+
+-- Per license changes to the entitlements of its product, enabled = FALSE takes a feature away
+CREATE TABLE LicenseEntitlements (
+    id BIGSERIAL PRIMARY KEY,
+    licenseId BIGINT NOT NULL REFERENCES UserLicense(id) ON DELETE CASCADE,
+    feature VARCHAR(64) NOT NULL,
+    limitValue BIGINT,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    UNIQUE (licenseId, feature)
+);
@@ -0,0 +1,21 @@
+-- Usage meters count what a license used in the current period, up to a quota
+CREATE TABLE Meters (
+    id BIGSERIAL PRIMARY KEY,
+    licenseId BIGINT NOT NULL REFERENCES UserLicense(id) ON DELETE CASCADE,
+    name VARCHAR(64) NOT NULL,
+    quota BIGINT NOT NULL,
+    period VARCHAR(16) NOT NULL,
+    used BIGINT NOT NULL DEFAULT 0,
+    periodStart TIMESTAMPTZ NOT NULL,
+    UNIQUE (licenseId, name)
+);
+
+-- Every increment, the idempotency key makes retried increments count once
+CREATE TABLE MeterEvents (
+    id BIGSERIAL PRIMARY KEY,
+    meterId BIGINT NOT NULL REFERENCES Meters(id) ON DELETE CASCADE,
+    idempotencyKey VARCHAR(128) NOT NULL,
+    amount BIGINT NOT NULL,
+    createdAt TIMESTAMPTZ NOT NULL,
+    UNIQUE (meterId, idempotencyKey)
+);
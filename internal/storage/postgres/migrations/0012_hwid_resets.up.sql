@@ -0,0 +1,9 @@
+-- Machines owners unbound themselves, counted against the hwid_reset limits
+CREATE TABLE HwidResets (
+    id BIGSERIAL PRIMARY KEY,
+    licenseId BIGINT NOT NULL REFERENCES UserLicense(id) ON DELETE CASCADE,
+    hwid VARCHAR(255) NOT NULL,
+    createdAt TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_hwidresets_licenseid ON HwidResets (licenseId);
@@ -0,0 +1 @@
+ALTER TABLE UserLicense DROP COLUMN secretHash;
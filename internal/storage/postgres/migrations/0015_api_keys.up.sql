@@ -0,0 +1,13 @@
+-- API keys for the admin API, stored as an HMAC like license keys.
+-- The key from the config keeps working as the root key with every scope.
+CREATE TABLE ApiKeys (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    displayPrefix VARCHAR(20) NOT NULL,
+    keyHash VARCHAR(64) NOT NULL UNIQUE,
+    scopes TEXT NOT NULL,
+    createdAt TIMESTAMPTZ NOT NULL,
+    expiresAt TIMESTAMPTZ,
+    lastUsedAt TIMESTAMPTZ,
+    revokedAt TIMESTAMPTZ
+);
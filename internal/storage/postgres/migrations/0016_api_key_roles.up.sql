@@ -0,0 +1,6 @@
+-- The role of an API key grants the scopes of its permission matrix on top of the key's own scopes
+ALTER TABLE ApiKeys ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT '';
+
+-- licenses:write used to cover freezing, renewals and machines, keys that had it keep those
+UPDATE ApiKeys SET scopes = scopes || ' licenses:freeze licenses:renew machines:manage'
+WHERE ' ' || scopes || ' ' LIKE '% licenses:write %';
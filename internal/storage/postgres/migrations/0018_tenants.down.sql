@@ -0,0 +1,19 @@
+-- Fails if two tenants have products with the same code, or a machine used trials without a
+-- product in two tenants, resolve those before rolling back
+DROP INDEX idx_trialmachines_tenant_product_hwid;
+ALTER TABLE TrialMachines DROP COLUMN tenantId;
+CREATE UNIQUE INDEX idx_trialmachines_product_hwid ON TrialMachines (COALESCE(productId, 0), hwid);
+
+ALTER TABLE Products DROP CONSTRAINT products_tenantid_code_key;
+ALTER TABLE Products ADD CONSTRAINT products_code_key UNIQUE (code);
+
+DROP INDEX idx_transactionlogs_tenantid;
+DROP INDEX idx_apikeys_tenantid;
+DROP INDEX idx_userlicense_tenantid;
+
+ALTER TABLE TransactionLogs DROP COLUMN tenantId;
+ALTER TABLE Products DROP COLUMN tenantId;
+ALTER TABLE ApiKeys DROP COLUMN tenantId;
+ALTER TABLE UserLicense DROP COLUMN tenantId;
+
+DROP TABLE Tenants;
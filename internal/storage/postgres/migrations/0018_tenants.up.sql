@@ -0,0 +1,31 @@
+-- Vendors the service runs for. Everything created before tenants existed belongs to the default tenant.
+CREATE TABLE Tenants (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'active',
+    createdAt TIMESTAMPTZ NOT NULL
+);
+
+INSERT INTO Tenants (id, name, status, createdAt) VALUES (1, 'default', 'active', CURRENT_TIMESTAMP);
+SELECT setval(pg_get_serial_sequence('Tenants', 'id'), 1);
+
+ALTER TABLE UserLicense ADD COLUMN tenantId BIGINT NOT NULL DEFAULT 1 REFERENCES Tenants(id);
+ALTER TABLE ApiKeys ADD COLUMN tenantId BIGINT NOT NULL DEFAULT 1 REFERENCES Tenants(id);
+ALTER TABLE Products ADD COLUMN tenantId BIGINT NOT NULL DEFAULT 1 REFERENCES Tenants(id);
+
+-- A machine gets one trial per product of every tenant
+ALTER TABLE TrialMachines ADD COLUMN tenantId BIGINT NOT NULL DEFAULT 1 REFERENCES Tenants(id);
+DROP INDEX idx_trialmachines_product_hwid;
+CREATE UNIQUE INDEX idx_trialmachines_tenant_product_hwid ON TrialMachines (tenantId, COALESCE(productId, 0), hwid);
+
+-- NULL for entries about no tenant in particular, like sweeps of the background jobs
+ALTER TABLE TransactionLogs ADD COLUMN tenantId BIGINT REFERENCES Tenants(id);
+UPDATE TransactionLogs SET tenantId = 1;
+
+-- Product codes are unique per tenant
+ALTER TABLE Products DROP CONSTRAINT products_code_key;
+ALTER TABLE Products ADD CONSTRAINT products_tenantid_code_key UNIQUE (tenantId, code);
+
+CREATE INDEX idx_userlicense_tenantid ON UserLicense (tenantId);
+CREATE INDEX idx_apikeys_tenantid ON ApiKeys (tenantId);
+CREATE INDEX idx_transactionlogs_tenantid ON TransactionLogs (tenantId);
@@ -0,0 +1,13 @@
+DROP INDEX idx_transactionlogs_target;
+DROP INDEX idx_transactionlogs_licenseid;
+
+ALTER TABLE TransactionLogs DROP COLUMN afterValues;
+ALTER TABLE TransactionLogs DROP COLUMN beforeValues;
+ALTER TABLE TransactionLogs DROP COLUMN targetId;
+ALTER TABLE TransactionLogs DROP COLUMN targetType;
+ALTER TABLE TransactionLogs DROP COLUMN licenseId;
+ALTER TABLE TransactionLogs DROP COLUMN action;
+ALTER TABLE TransactionLogs DROP COLUMN requestId;
+ALTER TABLE TransactionLogs DROP COLUMN ip;
+ALTER TABLE TransactionLogs DROP COLUMN apiKeyId;
+ALTER TABLE TransactionLogs DROP COLUMN actor;
@@ -0,0 +1,28 @@
+-- Structured audit records: who made each change, from where, and what it changed.
+-- Entries written before these columns existed have no actor, their action, license and target come from the description.
+ALTER TABLE TransactionLogs ADD COLUMN actor VARCHAR(20);
+ALTER TABLE TransactionLogs ADD COLUMN apiKeyId BIGINT;
+ALTER TABLE TransactionLogs ADD COLUMN ip VARCHAR(45);
+ALTER TABLE TransactionLogs ADD COLUMN requestId VARCHAR(36);
+ALTER TABLE TransactionLogs ADD COLUMN action VARCHAR(50) NOT NULL DEFAULT '';
+ALTER TABLE TransactionLogs ADD COLUMN licenseId BIGINT;
+ALTER TABLE TransactionLogs ADD COLUMN targetType VARCHAR(20);
+ALTER TABLE TransactionLogs ADD COLUMN targetId BIGINT;
+ALTER TABLE TransactionLogs ADD COLUMN beforeValues JSONB;
+ALTER TABLE TransactionLogs ADD COLUMN afterValues JSONB;
+
+UPDATE TransactionLogs SET action = substring(description from '^action=(\S+)') WHERE description LIKE 'action=%';
+-- The ID of the record an entry is about always directly follows the action, an ID further on is
+-- part of a value like a product code
+UPDATE TransactionLogs SET licenseId = substring(description from '^action=\S+ license_id=(\d+)')::BIGINT
+WHERE description ~ '^action=\S+ license_id=\d';
+UPDATE TransactionLogs SET targetType = 'license', targetId = licenseId WHERE licenseId IS NOT NULL;
+UPDATE TransactionLogs SET targetType = 'product', targetId = substring(description from '^action=\S+ product_id=(\d+)')::BIGINT
+WHERE description ~ '^action=\S+ product_id=\d';
+UPDATE TransactionLogs SET targetType = 'api_key', targetId = substring(description from '^action=\S+ api_key_id=(\d+)')::BIGINT
+WHERE description ~ '^action=\S+ api_key_id=\d';
+UPDATE TransactionLogs SET targetType = 'tenant', targetId = substring(description from '^action=\S+ tenant_id=(\d+)')::BIGINT
+WHERE description ~ '^action=\S+ tenant_id=\d';
+
+CREATE INDEX idx_transactionlogs_licenseid ON TransactionLogs (licenseId);
+CREATE INDEX idx_transactionlogs_target ON TransactionLogs (targetType, targetId);
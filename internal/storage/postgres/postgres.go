@@ -0,0 +1,251 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dzhisl/license-manager/internal/storage"
+	"github.com/lib/pq"
+)
+
+// uniqueViolation is the SQLSTATE postgres returns for UNIQUE constraint failures
+const uniqueViolation = "23505"
+
+// licenseColumns is the column list every license query selects, in scanLicense order
+const licenseColumns = `id, tenantId, displayPrefix, UserId, productId, licenseType, createdAt, updatedAt, expiresAt, updatesUntil, status, maxActivations, maxSessions`
+
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// DeleteLicenseById deletes a license by its ID
+func (s *Storage) DeleteLicenseById(id int64) error {
+	const op = "storage.postgres.DeleteLicenseById"
+
+	// Start a transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	license, err := scanLicense(tx.QueryRow(`SELECT `+licenseColumns+` FROM UserLicense WHERE id = $1 AND `+s.tenantScope("tenantId")+` FOR UPDATE`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%s: %w", op, storage.ErrLicenseNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Logged first, the entry finds its tenant through the license
+	if err := s.audit(tx, entry{
+		action:      "delete_license",
+		licenseId:   id,
+		before:      licenseValues(license),
+		description: fmt.Sprintf("action=delete_license license_id=%d", id),
+	}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM UserLicense WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+
+	return nil
+}
+
+// Get all licenses
+func (s *Storage) GetAllLicenses() ([]storage.License, error) {
+	return s.listLicenses("storage.postgres.GetAllLicenses", `SELECT `+licenseColumns+` FROM UserLicense WHERE `+s.tenantScope("tenantId")+` ORDER BY id`)
+}
+
+// GetLicensesByUserId returns every license owned by the user
+func (s *Storage) GetLicensesByUserId(userId string) ([]storage.License, error) {
+	return s.listLicenses("storage.postgres.GetLicensesByUserId", `SELECT `+licenseColumns+` FROM UserLicense WHERE UserId = $1 AND `+s.tenantScope("tenantId")+` ORDER BY id`, userId)
+}
+
+// AddLicense inserts a new license stored under the hash of key and returns its ID
+func (s *Storage) AddLicense(license *storage.License, key, secret string) (int64, error) {
+	const op = "storage.postgres.AddLicense"
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	displayPrefix := s.hasher.DisplayPrefix(key)
+
+	// lib/pq does not support LastInsertId, the id is returned by the statement itself
+	var id int64
+	err = tx.QueryRow(`
+INSERT INTO UserLicense (tenantId, displayPrefix, keyHash, secretHash, UserId, productId, licenseType, createdAt, updatedAt, expiresAt, updatesUntil, status, maxActivations, maxSessions)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+RETURNING id
+`, s.tenant(), displayPrefix, s.hasher.Hash(key), s.hasher.Hash(secret), license.UserId, nullInt64(license.ProductId), license.Type, now, now, license.ExpiresAt, license.UpdatesUntil, license.Status, license.MaxActivations, license.MaxSessions).Scan(&id)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrLicenseExists)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	license.ID = id
+	license.TenantId = s.tenant()
+	license.DisplayPrefix = displayPrefix
+	license.CreatedAt = now
+	license.UpdatedAt = now
+
+	err = s.audit(tx, entry{
+		action:    "add_license",
+		licenseId: id,
+		after:     licenseValues(license),
+		description: fmt.Sprintf(
+			"action=add_license license_id=%d license=%s user_id=%s type=%s",
+			id, displayPrefix, license.UserId, license.Type,
+		),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// Common method to retrieve a license
+func (s *Storage) getLicense(query string, param any) (*storage.License, error) {
+	const op = "storage.postgres.getLicense"
+
+	license, err := scanLicense(s.db.QueryRow(query, param))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrLicenseNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return license, nil
+}
+
+// Common method to retrieve a list of licenses
+func (s *Storage) listLicenses(op, query string, args ...any) ([]storage.License, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var licenses []storage.License
+
+	for rows.Next() {
+		license, err := scanLicense(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		licenses = append(licenses, *license)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return licenses, nil
+}
+
+// scanLicense reads a row selected with licenseColumns
+func scanLicense(row scanner) (*storage.License, error) {
+	var license storage.License
+	var productId sql.NullInt64
+
+	err := row.Scan(&license.ID, &license.TenantId, &license.DisplayPrefix, &license.UserId, &productId, &license.Type, &license.CreatedAt, &license.UpdatedAt, &license.ExpiresAt, &license.UpdatesUntil, &license.Status, &license.MaxActivations, &license.MaxSessions)
+	if err != nil {
+		return nil, err
+	}
+
+	if productId.Valid {
+		license.ProductId = &productId.Int64
+	}
+
+	return &license, nil
+}
+
+// Freeze/Unfreeze license helper
+func (s *Storage) updateLicenseStatus(id int64, status string) error {
+	return s.setLicenseValue("storage.postgres.updateLicenseStatus", id, "status", "status", status,
+		status+"_license", fmt.Sprintf("action=%s_license license_id=%d", status, id))
+}
+
+// Common method to change one column of a license, the transaction log records the old
+// and the new value under key
+func (s *Storage) setLicenseValue(op string, id int64, column, key string, value any, action, description string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var old any
+	if err := tx.QueryRow(`SELECT `+column+` FROM UserLicense WHERE id = $1 AND `+s.tenantScope("tenantId")+` FOR UPDATE`, id).Scan(&old); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%s: %w", op, storage.ErrLicenseNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := tx.Exec(`UPDATE UserLicense SET `+column+` = $1, updatedAt = $2 WHERE id = $3`, value, time.Now(), id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.audit(tx, entry{
+		action:      action,
+		licenseId:   id,
+		before:      map[string]any{key: old},
+		after:       map[string]any{key: value},
+		description: description,
+	}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+
+	return nil
+}
+
+// isUniqueViolation reports whether err was caused by a UNIQUE constraint
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == uniqueViolation
+	}
+	return false
+}
+
+func nullInt(i *int) sql.NullInt64 {
+	if i == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(*i), Valid: true}
+}
+
+func nullInt64(i *int64) sql.NullInt64 {
+	if i == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: *i, Valid: true}
+}
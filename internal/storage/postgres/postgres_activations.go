@@ -0,0 +1,422 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dzhisl/license-manager/internal/lib/fingerprint"
+	"github.com/dzhisl/license-manager/internal/lib/hwidreset"
+	"github.com/dzhisl/license-manager/internal/storage"
+)
+
+// activationColumns is the column list every activation query selects, in scanActivation order
+const activationColumns = `id, licenseId, hwid, label, fingerprint, firstSeen, lastSeen`
+
+// ActivateMachine records that the license is in use on hwid, within its activation limit.
+// A machine whose hwid changed is recognized by its fingerprint.
+func (s *Storage) ActivateMachine(licenseId int64, hwid, label string, fp fingerprint.Fingerprint, policy fingerprint.Policy, proof string) (*storage.Activation, error) {
+	const op = "storage.postgres.ActivateMachine"
+
+	fpJSON, err := fingerprintJSON(fp)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	// Lock the license row so concurrent activations can't both take the last seat
+	var maxActivations int
+	var licenseType string
+	var productId sql.NullInt64
+	var tenantId int64
+	err = tx.QueryRow(`SELECT maxActivations, licenseType, productId, tenantId FROM UserLicense WHERE id = $1 AND `+s.tenantScope("tenantId")+` FOR UPDATE`, licenseId).Scan(&maxActivations, &licenseType, &productId, &tenantId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrLicenseNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	now := time.Now()
+	res, err := tx.Exec(`
+UPDATE Activations SET lastSeen = $1, label = CASE WHEN $2 = '' THEN label ELSE $2 END, fingerprint = COALESCE($3, fingerprint)
+WHERE licenseId = $4 AND hwid = $5
+`, now, label, fpJSON, licenseId, hwid)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to get affected rows: %w", op, err)
+	}
+
+	// An unknown hwid may still be a known machine whose hardware partly changed
+	var drifted *storage.Activation
+	if rowsAffected == 0 && len(fp) > 0 {
+		drifted, err = findDrifted(tx, licenseId, fp, policy)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if drifted != nil {
+		_, err = tx.Exec(`
+UPDATE Activations SET hwid = $1, fingerprint = $2, lastSeen = $3, label = CASE WHEN $4 = '' THEN label ELSE $4 END
+WHERE id = $5
+`, hwid, fpJSON, now, label, drifted.ID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	activated := rowsAffected == 0 && drifted == nil
+	if activated {
+		var activations int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM Activations WHERE licenseId = $1`, licenseId).Scan(&activations); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if activations >= maxActivations {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrActivationLimit)
+		}
+		if licenseType == storage.TypeTrial {
+			if err := claimTrial(tx, licenseId, tenantId, productId, hwid, now); err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+		}
+
+		_, err = tx.Exec(`INSERT INTO Activations (licenseId, hwid, label, fingerprint, firstSeen, lastSeen) VALUES ($1, $2, $3, $4, $5, $6)`, licenseId, hwid, label, fpJSON, now, now)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	activation, err := scanActivation(tx.QueryRow(`SELECT `+activationColumns+` FROM Activations WHERE licenseId = $1 AND hwid = $2`, licenseId, hwid))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if activated {
+		err := s.audit(tx, entry{
+			action:      "activate_machine",
+			licenseId:   licenseId,
+			after:       map[string]any{"hwid": hwid, "label": activation.Label},
+			description: withProof(fmt.Sprintf("action=activate_machine license_id=%d hwid=%s", licenseId, hwid), proof),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if drifted != nil {
+		err := s.audit(tx, entry{
+			action:    "fingerprint_drift",
+			licenseId: licenseId,
+			before:    map[string]any{"hwid": drifted.HWID},
+			after:     map[string]any{"hwid": hwid},
+			description: withProof(fmt.Sprintf("action=fingerprint_drift license_id=%d activation_id=%d old_hwid=%s hwid=%s matched=%d/%d",
+				licenseId, drifted.ID, drifted.HWID, hwid, fingerprint.Matched(drifted.Fingerprint, fp), len(drifted.Fingerprint)), proof),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+
+	return activation, nil
+}
+
+// GetActivations returns the machines the license is activated on, oldest first
+func (s *Storage) GetActivations(licenseId int64) ([]storage.Activation, error) {
+	const op = "storage.postgres.GetActivations"
+
+	rows, err := s.db.Query(`SELECT `+activationColumns+` FROM Activations WHERE licenseId = $1 AND `+s.licenseScope("licenseId")+` ORDER BY id`, licenseId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var activations []storage.Activation
+
+	for rows.Next() {
+		activation, err := scanActivation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		activations = append(activations, *activation)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return activations, nil
+}
+
+// DeactivateMachine frees the seat hwid takes on the license
+func (s *Storage) DeactivateMachine(licenseId int64, hwid string) error {
+	const op = "storage.postgres.DeactivateMachine"
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`DELETE FROM Activations WHERE licenseId = $1 AND hwid = $2 AND `+s.licenseScope("licenseId"), licenseId, hwid)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: failed to get affected rows: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrActivationNotFound)
+	}
+
+	if err := s.audit(tx, entry{
+		action:      "deactivate_machine",
+		licenseId:   licenseId,
+		before:      map[string]any{"hwid": hwid},
+		description: fmt.Sprintf("action=deactivate_machine license_id=%d hwid=%s", licenseId, hwid),
+	}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+
+	return nil
+}
+
+// SetMaxActivations changes how many machines the license may be activated on.
+// Existing activations above the new limit are kept, new machines are rejected until some are deactivated.
+func (s *Storage) SetMaxActivations(id int64, max int) error {
+	return s.setLicenseValue("storage.postgres.SetMaxActivations", id, "maxActivations", "max_activations", max,
+		"set_max_activations", fmt.Sprintf("action=set_max_activations license_id=%d max_activations=%d", id, max))
+}
+
+// claimTrial records that hwid used the trial license, a machine gets one trial per product of a tenant
+func claimTrial(tx *sql.Tx, licenseId, tenantId int64, productId sql.NullInt64, hwid string, now time.Time) error {
+	var trialLicenseId int64
+	err := tx.QueryRow(`SELECT licenseId FROM TrialMachines WHERE tenantId = $1 AND COALESCE(productId, 0) = COALESCE($2, 0) AND hwid = $3`, tenantId, productId, hwid).Scan(&trialLicenseId)
+	switch {
+	case err == nil:
+		// Reactivating the same trial after a deactivation is fine
+		if trialLicenseId != licenseId {
+			return storage.ErrTrialUsed
+		}
+		return nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO TrialMachines (tenantId, productId, hwid, licenseId, createdAt) VALUES ($1, $2, $3, $4, $5)`, tenantId, productId, hwid, licenseId, now)
+	if isUniqueViolation(err) {
+		return storage.ErrTrialUsed
+	}
+	return err
+}
+
+// scanActivation reads a row selected with activationColumns
+func scanActivation(row scanner) (*storage.Activation, error) {
+	var activation storage.Activation
+
+	var fpJSON sql.NullString
+	err := row.Scan(&activation.ID, &activation.LicenseId, &activation.HWID, &activation.Label, &fpJSON, &activation.FirstSeen, &activation.LastSeen)
+	if err != nil {
+		return nil, err
+	}
+	if fpJSON.Valid {
+		if err := json.Unmarshal([]byte(fpJSON.String), &activation.Fingerprint); err != nil {
+			return nil, err
+		}
+	}
+
+	return &activation, nil
+}
+
+// findDrifted returns the activation of the license whose fingerprint matches fp best under policy,
+// nil if none matches
+func findDrifted(tx *sql.Tx, licenseId int64, fp fingerprint.Fingerprint, policy fingerprint.Policy) (*storage.Activation, error) {
+	rows, err := tx.Query(`SELECT `+activationColumns+` FROM Activations WHERE licenseId = $1 AND fingerprint IS NOT NULL ORDER BY id`, licenseId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var best *storage.Activation
+	bestMatched := 0
+
+	for rows.Next() {
+		activation, err := scanActivation(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		matched := fingerprint.Matched(activation.Fingerprint, fp)
+		if policy.Matches(activation.Fingerprint, fp) && matched > bestMatched {
+			best, bestMatched = activation, matched
+		}
+	}
+
+	return best, rows.Err()
+}
+
+// fingerprintJSON encodes fp for the fingerprint column, NULL when there is none
+func fingerprintJSON(fp fingerprint.Fingerprint) (sql.NullString, error) {
+	if len(fp) == 0 {
+		return sql.NullString{}, nil
+	}
+
+	b, err := json.Marshal(fp)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(b), Valid: true}, nil
+}
+
+// ResetMachine frees the seat hwid takes on the license for its owner, within the reset limits of policy
+func (s *Storage) ResetMachine(licenseId int64, hwid string, policy hwidreset.Policy, now time.Time, proof string) (time.Time, error) {
+	const op = "storage.postgres.ResetMachine"
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	// Lock the license row so concurrent resets can't both pass the limit check
+	var locked int64
+	err = tx.QueryRow(`SELECT id FROM UserLicense WHERE id = $1 AND `+s.tenantScope("tenantId")+` FOR UPDATE`, licenseId).Scan(&locked)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, fmt.Errorf("%s: %w", op, storage.ErrLicenseNotFound)
+		}
+		return time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := tx.Exec(`DELETE FROM Activations WHERE licenseId = $1 AND hwid = $2`, licenseId, hwid)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: failed to get affected rows: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return time.Time{}, fmt.Errorf("%s: %w", op, storage.ErrActivationNotFound)
+	}
+
+	resets, err := resetTimes(tx, licenseId)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if !policy.Allowed(resets, now) {
+		return policy.NextAllowed(resets), fmt.Errorf("%s: %w", op, storage.ErrResetLimit)
+	}
+
+	_, err = tx.Exec(`INSERT INTO HwidResets (licenseId, hwid, createdAt) VALUES ($1, $2, $3)`, licenseId, hwid, now)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = s.audit(tx, entry{
+		action:    "reset_machine",
+		licenseId: licenseId,
+		before:    map[string]any{"hwid": hwid},
+		description: withProof(fmt.Sprintf("action=reset_machine license_id=%d hwid=%s resets_in_window=%d",
+			licenseId, hwid, countSince(resets, now.Add(-policy.Window))+1), proof),
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return time.Time{}, fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+
+	return policy.NextAllowed(append(resets, now)), nil
+}
+
+// GetHwidResets returns the machines the owner of the license unbound, oldest first
+func (s *Storage) GetHwidResets(licenseId int64) ([]storage.HwidReset, error) {
+	const op = "storage.postgres.GetHwidResets"
+
+	rows, err := s.db.Query(`SELECT id, licenseId, hwid, createdAt FROM HwidResets WHERE licenseId = $1 AND `+s.licenseScope("licenseId")+` ORDER BY id`, licenseId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var resets []storage.HwidReset
+
+	for rows.Next() {
+		var reset storage.HwidReset
+		if err := rows.Scan(&reset.ID, &reset.LicenseId, &reset.HWID, &reset.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		resets = append(resets, reset)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return resets, nil
+}
+
+// resetTimes returns when the owner of the license unbound machines, oldest first
+func resetTimes(tx *sql.Tx, licenseId int64) ([]time.Time, error) {
+	rows, err := tx.Query(`SELECT createdAt FROM HwidResets WHERE licenseId = $1 ORDER BY id`, licenseId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var resets []time.Time
+
+	for rows.Next() {
+		var createdAt time.Time
+		if err := rows.Scan(&createdAt); err != nil {
+			return nil, err
+		}
+
+		resets = append(resets, createdAt)
+	}
+
+	return resets, rows.Err()
+}
+
+// countSince returns how many of times are not before since
+func countSince(times []time.Time, since time.Time) int {
+	count := 0
+	for _, t := range times {
+		if !t.Before(since) {
+			count++
+		}
+	}
+	return count
+}
+
+// withProof adds how the owner proved they own the license to the description of a log entry
+func withProof(description, proof string) string {
+	if proof == "" {
+		return description
+	}
+	return description + " proof=" + proof
+}
@@ -0,0 +1,108 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/dzhisl/license-manager/internal/storage"
+)
+
+// entry is a transaction log entry. The description is only for display, the action, the
+// license and the target are what the entry is looked up by.
+type entry struct {
+	action    string
+	licenseId int64 // the license the change is about, 0 for none
+	// targetType and targetId are the record the change is about, the license when not set
+	targetType string
+	targetId   int64
+	// before and after hold the values the change replaced and wrote, nil when there are none
+	before, after map[string]any
+	description   string
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// As returns a store that records actor as who made its changes
+func (s *Storage) As(actor storage.Actor) storage.LicenseStore {
+	acting := *s
+	acting.actor = actor
+	return &acting
+}
+
+// audit writes the transaction log entry of a change through ex, the transaction making the change.
+// Entries go under the tenant of the store, or under the tenant of their license for the store
+// that sees every tenant.
+func (s *Storage) audit(ex execer, e entry) error {
+	var licenseId *int64
+	if e.licenseId != 0 {
+		licenseId = &e.licenseId
+	}
+	var targetId *int64
+	if e.targetType == "" && e.licenseId != 0 {
+		e.targetType, e.targetId = storage.TargetLicense, e.licenseId
+	}
+	if e.targetType != "" {
+		targetId = &e.targetId
+	}
+
+	beforeJSON, err := auditValues(e.before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := auditValues(e.after)
+	if err != nil {
+		return err
+	}
+
+	actor := s.actor
+	if actor.Kind == "" {
+		actor.Kind = storage.ActorSystem
+	}
+	var apiKeyId *int64
+	if actor.ApiKeyId != 0 {
+		apiKeyId = &actor.ApiKeyId
+	}
+
+	_, err = ex.Exec(`
+INSERT INTO TransactionLogs (tenantId, actor, apiKeyId, ip, requestId, action, licenseId, targetType, targetId, beforeValues, afterValues, description)
+VALUES (COALESCE($1::BIGINT, (SELECT tenantId FROM UserLicense WHERE id = $2)), $3, $4, $5, $6, $7, $2, $8, $9, $10, $11, $12)
+`, nullInt64(s.scopedTenant()), nullInt64(licenseId), actor.Kind, nullInt64(apiKeyId), nullString(actor.IP), nullString(actor.RequestId),
+		e.action, nullString(e.targetType), nullInt64(targetId), beforeJSON, afterJSON, e.description)
+	return err
+}
+
+// auditValues encodes the values of a transaction log entry, NULL when there are none
+func auditValues(values map[string]any) (sql.NullString, error) {
+	if values == nil {
+		return sql.NullString{}, nil
+	}
+
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+
+	return sql.NullString{String: string(encoded), Valid: true}, nil
+}
+
+// nullString stores empty strings as NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// licenseValues are the values of a license the transaction log records when it is added or deleted
+func licenseValues(license *storage.License) map[string]any {
+	return map[string]any{
+		"user_id":         license.UserId,
+		"product_id":      license.ProductId,
+		"type":            license.Type,
+		"status":          license.Status,
+		"expires_at":      license.ExpiresAt,
+		"updates_until":   license.UpdatesUntil,
+		"max_activations": license.MaxActivations,
+		"max_sessions":    license.MaxSessions,
+	}
+}
@@ -0,0 +1,278 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/dzhisl/license-manager/internal/storage"
+)
+
+// SetProductEntitlement adds the feature to the product or changes its limit
+func (s *Storage) SetProductEntitlement(productId int64, entitlement storage.Entitlement) error {
+	const op = "storage.postgres.SetProductEntitlement"
+
+	if err := s.checkProduct(productId); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	before, err := s.entitlementValues(tx, productId, entitlement.Feature)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(`
+INSERT INTO ProductEntitlements (productId, feature, limitValue) VALUES ($1, $2, $3)
+ON CONFLICT (productId, feature) DO UPDATE SET limitValue = EXCLUDED.limitValue
+`, productId, entitlement.Feature, nullInt64(entitlement.Limit))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = s.audit(tx, entry{
+		action:      "set_product_entitlement",
+		targetType:  storage.TargetProduct,
+		targetId:    productId,
+		before:      before,
+		after:       map[string]any{"limit": entitlement.Limit},
+		description: fmt.Sprintf("action=set_product_entitlement product_id=%d feature=%s limit=%s", productId, entitlement.Feature, formatLimit(entitlement.Limit)),
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+
+	return nil
+}
+
+// RemoveProductEntitlement takes the feature away from the product
+func (s *Storage) RemoveProductEntitlement(productId int64, feature string) error {
+	const op = "storage.postgres.RemoveProductEntitlement"
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	before, err := s.entitlementValues(tx, productId, feature)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if before == nil {
+		return fmt.Errorf("%s: %w", op, storage.ErrEntitlementNotFound)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM ProductEntitlements WHERE productId = $1 AND feature = $2`, productId, feature); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.audit(tx, entry{
+		action:      "remove_product_entitlement",
+		targetType:  storage.TargetProduct,
+		targetId:    productId,
+		before:      before,
+		description: fmt.Sprintf("action=remove_product_entitlement product_id=%d feature=%s", productId, feature),
+	}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+
+	return nil
+}
+
+// GetProductEntitlements returns the features of the product, sorted by name
+func (s *Storage) GetProductEntitlements(productId int64) ([]storage.Entitlement, error) {
+	const op = "storage.postgres.GetProductEntitlements"
+
+	rows, err := s.db.Query(`SELECT feature, limitValue FROM ProductEntitlements WHERE productId = $1 AND `+s.productScope("productId")+` ORDER BY feature`, productId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var entitlements []storage.Entitlement
+
+	for rows.Next() {
+		var entitlement storage.Entitlement
+		var limit sql.NullInt64
+		if err := rows.Scan(&entitlement.Feature, &limit); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if limit.Valid {
+			entitlement.Limit = &limit.Int64
+		}
+
+		entitlements = append(entitlements, entitlement)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return entitlements, nil
+}
+
+// SetLicenseEntitlement adds or replaces the override of a feature on the license
+func (s *Storage) SetLicenseEntitlement(licenseId int64, override storage.EntitlementOverride) error {
+	const op = "storage.postgres.SetLicenseEntitlement"
+
+	if err := s.checkLicense(licenseId); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	before, err := s.overrideValues(tx, licenseId, override.Feature)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(`
+INSERT INTO LicenseEntitlements (licenseId, feature, limitValue, enabled) VALUES ($1, $2, $3, $4)
+ON CONFLICT (licenseId, feature) DO UPDATE SET limitValue = EXCLUDED.limitValue, enabled = EXCLUDED.enabled
+`, licenseId, override.Feature, nullInt64(override.Limit), override.Enabled)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = s.audit(tx, entry{
+		action:    "set_license_entitlement",
+		licenseId: licenseId,
+		before:    before,
+		after:     map[string]any{"limit": override.Limit, "enabled": override.Enabled},
+		description: fmt.Sprintf("action=set_license_entitlement license_id=%d feature=%s limit=%s enabled=%t",
+			licenseId, override.Feature, formatLimit(override.Limit), override.Enabled),
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+
+	return nil
+}
+
+// RemoveLicenseEntitlement drops the override of a feature, the license falls back to its product
+func (s *Storage) RemoveLicenseEntitlement(licenseId int64, feature string) error {
+	const op = "storage.postgres.RemoveLicenseEntitlement"
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	before, err := s.overrideValues(tx, licenseId, feature)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if before == nil {
+		return fmt.Errorf("%s: %w", op, storage.ErrEntitlementNotFound)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM LicenseEntitlements WHERE licenseId = $1 AND feature = $2`, licenseId, feature); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.audit(tx, entry{
+		action:      "remove_license_entitlement",
+		licenseId:   licenseId,
+		before:      before,
+		description: fmt.Sprintf("action=remove_license_entitlement license_id=%d feature=%s", licenseId, feature),
+	}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+
+	return nil
+}
+
+// GetLicenseEntitlements returns the overrides of the license, sorted by feature
+func (s *Storage) GetLicenseEntitlements(licenseId int64) ([]storage.EntitlementOverride, error) {
+	const op = "storage.postgres.GetLicenseEntitlements"
+
+	rows, err := s.db.Query(`SELECT feature, limitValue, enabled FROM LicenseEntitlements WHERE licenseId = $1 AND `+s.licenseScope("licenseId")+` ORDER BY feature`, licenseId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var overrides []storage.EntitlementOverride
+
+	for rows.Next() {
+		var override storage.EntitlementOverride
+		var limit sql.NullInt64
+		if err := rows.Scan(&override.Feature, &limit, &override.Enabled); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if limit.Valid {
+			override.Limit = &limit.Int64
+		}
+
+		overrides = append(overrides, override)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return overrides, nil
+}
+
+// formatLimit writes an entitlement limit for the transaction log
+func formatLimit(limit *int64) string {
+	if limit == nil {
+		return "unlimited"
+	}
+	return strconv.FormatInt(*limit, 10)
+}
+
+// entitlementValues reads the limit of the feature of the product for the transaction log, nil when the product lacks it
+func (s *Storage) entitlementValues(tx *sql.Tx, productId int64, feature string) (map[string]any, error) {
+	var limit *int64
+	err := tx.QueryRow(`SELECT limitValue FROM ProductEntitlements WHERE productId = $1 AND feature = $2 AND `+s.productScope("productId")+` FOR UPDATE`, productId, feature).Scan(&limit)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return map[string]any{"limit": limit}, nil
+}
+
+// overrideValues reads the override of the feature on the license for the transaction log, nil when there is none
+func (s *Storage) overrideValues(tx *sql.Tx, licenseId int64, feature string) (map[string]any, error) {
+	var limit *int64
+	var enabled bool
+	err := tx.QueryRow(`SELECT limitValue, enabled FROM LicenseEntitlements WHERE licenseId = $1 AND feature = $2 AND `+s.licenseScope("licenseId")+` FOR UPDATE`, licenseId, feature).Scan(&limit, &enabled)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return map[string]any{"limit": limit, "enabled": enabled}, nil
+}
@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"fmt"
+	"time"
+)
+
+// ExpireLicenses moves active licenses past their grace period to the expired status
+func (s *Storage) ExpireLicenses(now time.Time, defaultGraceDays int) ([]int64, error) {
+	const op = "storage.postgres.ExpireLicenses"
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+UPDATE UserLicense SET status = 'expired', updatedAt = $1
+WHERE status = 'active' AND `+s.tenantScope("tenantId")+`
+  AND expiresAt + make_interval(days => COALESCE((SELECT graceDays FROM Products WHERE Products.id = UserLicense.productId), $2)) <= $1
+RETURNING id
+`, now, defaultGraceDays)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var expired []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		expired = append(expired, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	// The connection can't run the log inserts while the rows are open
+	rows.Close()
+
+	for _, id := range expired {
+		err := s.audit(tx, entry{
+			action:      "expire_license",
+			licenseId:   id,
+			before:      map[string]any{"status": "active"},
+			after:       map[string]any{"status": "expired"},
+			description: fmt.Sprintf("action=expire_license license_id=%d", id),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+
+	return expired, nil
+}
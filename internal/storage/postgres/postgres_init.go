@@ -0,0 +1,59 @@
+package postgres
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+
+	"github.com/dzhisl/license-manager/internal/lib/licensekey"
+	"github.com/dzhisl/license-manager/internal/storage"
+	"github.com/dzhisl/license-manager/internal/storage/migrate"
+	_ "github.com/lib/pq"
+)
+
+var _ storage.Store = (*Storage)(nil)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Storage is the PostgreSQL implementation of storage.LicenseStore
+type Storage struct {
+	db     *sql.DB
+	hasher *licensekey.Hasher
+	// tenantId is the tenant the store is scoped to, 0 for the store that sees every tenant
+	tenantId int64
+	// actor is who the transaction log records as making the changes of the store
+	actor storage.Actor
+}
+
+// New connects to PostgreSQL, the schema is managed by Migrator
+func New(dsn string, hasher *licensekey.Hasher) (*Storage, error) {
+	const op = "storage.postgres.New"
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// sql.Open does not connect, make sure the server is actually reachable
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Storage{db: db, hasher: hasher}, nil
+}
+
+// Migrator returns the schema migrator for this database
+func (s *Storage) Migrator() (*migrate.Migrator, error) {
+	sub, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("storage.postgres.Migrator: %w", err)
+	}
+	return migrate.New(s.db, sub, migrate.Dollar)
+}
+
+// Close closes the underlying database
+func (s *Storage) Close() error {
+	return s.db.Close()
+}
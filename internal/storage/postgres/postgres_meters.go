@@ -0,0 +1,272 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dzhisl/license-manager/internal/lib/usage"
+	"github.com/dzhisl/license-manager/internal/storage"
+)
+
+// meterColumns is the column list every meter query selects, in scanMeter order
+const meterColumns = `id, licenseId, name, quota, period, used, periodStart`
+
+// SetMeter creates the meter of the license or changes its quota and period
+func (s *Storage) SetMeter(meter *storage.Meter) error {
+	const op = "storage.postgres.SetMeter"
+
+	if err := s.checkLicense(meter.LicenseId); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	before, err := readMeterValues(tx.QueryRow(`SELECT `+meterColumns+` FROM Meters WHERE licenseId = $1 AND name = $2 FOR UPDATE`, meter.LicenseId, meter.Name))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Changing the period starts the usage over, changing only the quota keeps it
+	_, err = tx.Exec(`
+INSERT INTO Meters (licenseId, name, quota, period, used, periodStart) VALUES ($1, $2, $3, $4, 0, $5)
+ON CONFLICT (licenseId, name) DO UPDATE SET
+	quota = EXCLUDED.quota,
+	used = CASE WHEN Meters.period = EXCLUDED.period THEN Meters.used ELSE 0 END,
+	periodStart = CASE WHEN Meters.period = EXCLUDED.period THEN Meters.periodStart ELSE EXCLUDED.periodStart END,
+	period = EXCLUDED.period
+`, meter.LicenseId, meter.Name, meter.Quota, meter.Period, meter.Period.Start(time.Now()))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	stored, err := scanMeter(tx.QueryRow(`SELECT `+meterColumns+` FROM Meters WHERE licenseId = $1 AND name = $2`, meter.LicenseId, meter.Name))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = s.audit(tx, entry{
+		action:      "set_meter",
+		licenseId:   stored.LicenseId,
+		before:      before,
+		after:       meterValues(stored),
+		description: fmt.Sprintf("action=set_meter license_id=%d meter=%s quota=%d period=%s", stored.LicenseId, stored.Name, stored.Quota, stored.Period),
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+	*meter = *stored
+
+	return nil
+}
+
+// RemoveMeter deletes the meter of the license, its usage goes with it
+func (s *Storage) RemoveMeter(licenseId int64, name string) error {
+	const op = "storage.postgres.RemoveMeter"
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	before, err := readMeterValues(tx.QueryRow(`SELECT `+meterColumns+` FROM Meters WHERE licenseId = $1 AND name = $2 AND `+s.licenseScope("licenseId")+` FOR UPDATE`, licenseId, name))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if before == nil {
+		return fmt.Errorf("%s: %w", op, storage.ErrMeterNotFound)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM Meters WHERE licenseId = $1 AND name = $2`, licenseId, name); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.audit(tx, entry{
+		action:      "remove_meter",
+		licenseId:   licenseId,
+		before:      before,
+		description: fmt.Sprintf("action=remove_meter license_id=%d meter=%s", licenseId, name),
+	}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+
+	return nil
+}
+
+// GetMeters returns the meters of the license as of now, sorted by name
+func (s *Storage) GetMeters(licenseId int64, now time.Time) ([]storage.Meter, error) {
+	const op = "storage.postgres.GetMeters"
+
+	rows, err := s.db.Query(`SELECT `+meterColumns+` FROM Meters WHERE licenseId = $1 AND `+s.licenseScope("licenseId")+` ORDER BY name`, licenseId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var meters []storage.Meter
+
+	for rows.Next() {
+		meter, err := scanMeter(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		rollover(meter, now)
+
+		meters = append(meters, *meter)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return meters, nil
+}
+
+// IncrementMeter counts amount on the meter, once per idempotency key
+func (s *Storage) IncrementMeter(licenseId int64, name string, amount int64, idempotencyKey string, now time.Time) (*storage.MeterIncrement, error) {
+	const op = "storage.postgres.IncrementMeter"
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	// Lock the meter row so concurrent increments can't both pass the quota check
+	meter, err := scanMeter(tx.QueryRow(`SELECT `+meterColumns+` FROM Meters WHERE licenseId = $1 AND name = $2 AND `+s.licenseScope("licenseId")+` FOR UPDATE`, licenseId, name))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrMeterNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var seen int
+	err = tx.QueryRow(`SELECT 1 FROM MeterEvents WHERE meterId = $1 AND idempotencyKey = $2`, meter.ID, idempotencyKey).Scan(&seen)
+	if err == nil {
+		rollover(meter, now)
+		return &storage.MeterIncrement{Meter: *meter, Replayed: true}, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	beforeReset := meterValues(meter)
+	reset := rollover(meter, now)
+	if amount > meter.Quota-meter.Used {
+		return nil, fmt.Errorf("%s: %w", op, storage.ErrQuotaExceeded)
+	}
+	usedBefore := meter.Used
+	meter.Used += amount
+
+	_, err = tx.Exec(`UPDATE Meters SET used = $1, periodStart = $2 WHERE id = $3`, meter.Used, meter.PeriodStart, meter.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// A reset happens on the first increment of a period, so every event left is from a finished
+	// period. Their idempotency keys don't carry over, a retry from then counts in the new period.
+	var pruned int64
+	if reset {
+		res, err := tx.Exec(`DELETE FROM MeterEvents WHERE meterId = $1`, meter.ID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if pruned, err = res.RowsAffected(); err != nil {
+			return nil, fmt.Errorf("%s: failed to get affected rows: %w", op, err)
+		}
+	}
+
+	_, err = tx.Exec(`
+INSERT INTO MeterEvents (meterId, idempotencyKey, amount, createdAt) VALUES ($1, $2, $3, $4)
+`, meter.ID, idempotencyKey, amount, now)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if reset {
+		err := s.audit(tx, entry{
+			action:    "reset_meter",
+			licenseId: licenseId,
+			before:    beforeReset,
+			after:     map[string]any{"used": 0, "period_start": meter.PeriodStart},
+			description: fmt.Sprintf("action=reset_meter license_id=%d meter=%s period_start=%s pruned_events=%d",
+				licenseId, name, meter.PeriodStart.Format(time.RFC3339), pruned),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	err = s.audit(tx, entry{
+		action:    "increment_meter",
+		licenseId: licenseId,
+		before:    map[string]any{"used": usedBefore},
+		after:     map[string]any{"used": meter.Used},
+		description: fmt.Sprintf("action=increment_meter license_id=%d meter=%s amount=%d used=%d quota=%d idempotency_key=%s",
+			licenseId, name, amount, meter.Used, meter.Quota, idempotencyKey),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+
+	return &storage.MeterIncrement{Meter: *meter}, nil
+}
+
+// readMeterValues reads a meter selected with meterColumns for the transaction log, nil when there is none
+func readMeterValues(row scanner) (map[string]any, error) {
+	meter, err := scanMeter(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return meterValues(meter), nil
+}
+
+// meterValues are the values of a meter the transaction log records
+func meterValues(meter *storage.Meter) map[string]any {
+	return map[string]any{"quota": meter.Quota, "period": meter.Period, "used": meter.Used, "period_start": meter.PeriodStart}
+}
+
+// rollover starts the usage of the meter over when its period ended before now,
+// it reports whether it did
+func rollover(meter *storage.Meter, now time.Time) bool {
+	if !meter.Period.Ended(meter.PeriodStart, now) {
+		return false
+	}
+	meter.Used = 0
+	meter.PeriodStart = meter.Period.Start(now)
+	return true
+}
+
+func scanMeter(row scanner) (*storage.Meter, error) {
+	var meter storage.Meter
+	var period string
+	err := row.Scan(&meter.ID, &meter.LicenseId, &meter.Name, &meter.Quota, &period, &meter.Used, &meter.PeriodStart)
+	if err != nil {
+		return nil, err
+	}
+	meter.Period = usage.Period(period)
+
+	return &meter, nil
+}
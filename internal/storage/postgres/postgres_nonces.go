@@ -0,0 +1,48 @@
+package postgres
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dzhisl/license-manager/internal/storage"
+)
+
+// UseNonce records the nonce of a signed request, a nonce the API key sent before is refused
+func (s *Storage) UseNonce(apiKeyId int64, nonce string, expiresAt time.Time) error {
+	const op = "storage.postgres.UseNonce"
+
+	res, err := s.db.Exec(`
+INSERT INTO RequestNonces (apiKeyId, nonce, expiresAt) VALUES ($1, $2, $3)
+ON CONFLICT (apiKeyId, nonce) DO NOTHING
+`, apiKeyId, nonce, expiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: failed to get affected rows: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrNonceUsed)
+	}
+
+	return nil
+}
+
+// PruneNonces deletes the nonces whose requests are too old to be accepted anyway
+func (s *Storage) PruneNonces(now time.Time) (int, error) {
+	const op = "storage.postgres.PruneNonces"
+
+	res, err := s.db.Exec(`DELETE FROM RequestNonces WHERE expiresAt <= $1`, now)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: failed to get affected rows: %w", op, err)
+	}
+
+	return int(rowsAffected), nil
+}
@@ -0,0 +1,250 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dzhisl/license-manager/internal/storage"
+)
+
+// sessionColumns is the column list every session query selects, in scanSession order
+const sessionColumns = `id, licenseId, hwid, startedAt, lastHeartbeat, expiresAt`
+
+// OpenSession checks out a floating seat of the license, within its session limit
+func (s *Storage) OpenSession(session *storage.Session, token string) (int64, error) {
+	const op = "storage.postgres.OpenSession"
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	// Lock the license row so concurrent checkouts can't both take the last seat
+	var maxSessions int
+	err = tx.QueryRow(`SELECT maxSessions FROM UserLicense WHERE id = $1 AND `+s.tenantScope("tenantId")+` FOR UPDATE`, session.LicenseId).Scan(&maxSessions)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrLicenseNotFound)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Expired sessions don't hold a seat even if the reaper hasn't run yet
+	now := time.Now().UTC()
+	res, err := tx.Exec(`DELETE FROM Sessions WHERE licenseId = $1 AND expiresAt <= $2`, session.LicenseId, now)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	expired, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: failed to get affected rows: %w", op, err)
+	}
+	if expired > 0 {
+		err := s.audit(tx, entry{
+			action:      "reap_sessions",
+			licenseId:   session.LicenseId,
+			description: fmt.Sprintf("action=reap_sessions license_id=%d count=%d", session.LicenseId, expired),
+		})
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	var sessions int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM Sessions WHERE licenseId = $1`, session.LicenseId).Scan(&sessions); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if sessions >= maxSessions {
+		return 0, fmt.Errorf("%s: %w", op, storage.ErrSessionLimit)
+	}
+
+	var id int64
+	expiresAt := session.ExpiresAt.UTC()
+	err = tx.QueryRow(`
+INSERT INTO Sessions (tokenHash, licenseId, hwid, startedAt, lastHeartbeat, expiresAt)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id
+`, s.hasher.Hash(token), session.LicenseId, session.HWID, now, now, expiresAt).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = s.audit(tx, entry{
+		action:      "open_session",
+		licenseId:   session.LicenseId,
+		after:       map[string]any{"session_id": id, "hwid": session.HWID, "expires_at": expiresAt},
+		description: fmt.Sprintf("action=open_session license_id=%d session_id=%d hwid=%s", session.LicenseId, id, session.HWID),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+
+	session.ID = id
+	session.StartedAt = now
+	session.LastHeartbeat = now
+	session.ExpiresAt = expiresAt
+
+	return id, nil
+}
+
+// GetSessionByToken returns the unexpired session identified by token
+func (s *Storage) GetSessionByToken(token string) (*storage.Session, error) {
+	const op = "storage.postgres.GetSessionByToken"
+
+	session, err := scanSession(s.db.QueryRow(`SELECT `+sessionColumns+` FROM Sessions WHERE tokenHash = $1 AND expiresAt > $2`, s.hasher.Hash(token), time.Now().UTC()))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrSessionNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return session, nil
+}
+
+// HeartbeatSession keeps an unexpired session alive until expiresAt
+func (s *Storage) HeartbeatSession(token string, expiresAt time.Time) (*storage.Session, error) {
+	const op = "storage.postgres.HeartbeatSession"
+
+	now := time.Now().UTC()
+	res, err := s.db.Exec(`UPDATE Sessions SET lastHeartbeat = $1, expiresAt = $2 WHERE tokenHash = $3 AND expiresAt > $4`, now, expiresAt.UTC(), s.hasher.Hash(token), now)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to get affected rows: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return nil, fmt.Errorf("%s: %w", op, storage.ErrSessionNotFound)
+	}
+
+	return s.GetSessionByToken(token)
+}
+
+// CloseSession checks the seat back in
+func (s *Storage) CloseSession(token string) error {
+	const op = "storage.postgres.CloseSession"
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	session, err := scanSession(tx.QueryRow(`SELECT `+sessionColumns+` FROM Sessions WHERE tokenHash = $1 AND expiresAt > $2 FOR UPDATE`, s.hasher.Hash(token), time.Now().UTC()))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%s: %w", op, storage.ErrSessionNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM Sessions WHERE id = $1`, session.ID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = s.audit(tx, entry{
+		action:      "close_session",
+		licenseId:   session.LicenseId,
+		before:      map[string]any{"session_id": session.ID, "hwid": session.HWID},
+		description: fmt.Sprintf("action=close_session license_id=%d session_id=%d", session.LicenseId, session.ID),
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+
+	return nil
+}
+
+// GetSessions returns the unexpired sessions of the license, oldest first
+func (s *Storage) GetSessions(licenseId int64) ([]storage.Session, error) {
+	const op = "storage.postgres.GetSessions"
+
+	rows, err := s.db.Query(`SELECT `+sessionColumns+` FROM Sessions WHERE licenseId = $1 AND expiresAt > $2 AND `+s.licenseScope("licenseId")+` ORDER BY id`, licenseId, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var sessions []storage.Session
+
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		sessions = append(sessions, *session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sessions, nil
+}
+
+// ReapSessions deletes every session that missed its heartbeat
+func (s *Storage) ReapSessions(now time.Time) (int, error) {
+	const op = "storage.postgres.ReapSessions"
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`DELETE FROM Sessions WHERE expiresAt <= $1`, now.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: failed to get affected rows: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return 0, nil
+	}
+
+	if err := s.audit(tx, entry{action: "reap_sessions", description: fmt.Sprintf("action=reap_sessions count=%d", rowsAffected)}); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+
+	return int(rowsAffected), nil
+}
+
+// SetMaxSessions changes how many floating sessions the license may have at once
+func (s *Storage) SetMaxSessions(id int64, max int) error {
+	return s.setLicenseValue("storage.postgres.SetMaxSessions", id, "maxSessions", "max_sessions", max,
+		"set_max_sessions", fmt.Sprintf("action=set_max_sessions license_id=%d max_sessions=%d", id, max))
+}
+
+// scanSession reads a row selected with sessionColumns
+func scanSession(row scanner) (*storage.Session, error) {
+	var session storage.Session
+
+	err := row.Scan(&session.ID, &session.LicenseId, &session.HWID, &session.StartedAt, &session.LastHeartbeat, &session.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
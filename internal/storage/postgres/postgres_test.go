@@ -0,0 +1,65 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dzhisl/license-manager/internal/lib/licensekey"
+	"github.com/dzhisl/license-manager/internal/storage"
+	"github.com/dzhisl/license-manager/internal/storage/storagetest"
+)
+
+// TestStorage runs against the server STORAGE_TEST_DSN points to, every test in a schema of its own
+func TestStorage(t *testing.T) {
+	dsn := os.Getenv("STORAGE_TEST_DSN")
+	if dsn == "" {
+		t.Skip("STORAGE_TEST_DSN is not set")
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close()
+
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		schema := fmt.Sprintf("storagetest_%d", time.Now().UnixNano())
+		if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`) })
+
+		s, err := New(withSearchPath(dsn, schema), licensekey.NewHasher("test", storagetest.KeyFormat))
+		if err != nil {
+			t.Fatal(err)
+		}
+		migrator, err := s.Migrator()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := migrator.Up(); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
+
+// withSearchPath adds the search_path run-time parameter to a URL or key/value connection string
+func withSearchPath(dsn, schema string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return dsn
+		}
+		q := u.Query()
+		q.Set("search_path", schema)
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+	return dsn + " search_path=" + schema
+}
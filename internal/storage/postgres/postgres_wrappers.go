@@ -0,0 +1,19 @@
+package postgres
+
+import "github.com/dzhisl/license-manager/internal/storage"
+
+func (s *Storage) GetLicenseById(id int64) (*storage.License, error) {
+	return s.getLicense(`SELECT `+licenseColumns+` FROM UserLicense WHERE id = $1 AND `+s.tenantScope("tenantId"), id)
+}
+
+func (s *Storage) GetLicenseByLicense(key string) (*storage.License, error) {
+	return s.getLicense(`SELECT `+licenseColumns+` FROM UserLicense WHERE keyHash = $1 AND `+s.tenantScope("tenantId"), s.hasher.Hash(key))
+}
+
+func (s *Storage) FreezeLicenseById(id int64) error {
+	return s.updateLicenseStatus(id, "frozen")
+}
+
+func (s *Storage) UnfreezeLicenseById(id int64) error {
+	return s.updateLicenseStatus(id, "active")
+}
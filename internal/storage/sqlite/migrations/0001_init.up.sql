@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS UserLicense (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    license VARCHAR(25) NOT NULL UNIQUE,
+    UserId VARCHAR(50) NOT NULL UNIQUE,
+    createdAt TIMESTAMP NOT NULL,
+    updatedAt TIMESTAMP NOT NULL,
+    expiresAt TIMESTAMP NOT NULL,
+    hwid VARCHAR(50),
+    status VARCHAR(10) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS TransactionLogs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+    description TEXT NOT NULL
+);
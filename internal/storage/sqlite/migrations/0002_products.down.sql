@@ -0,0 +1,19 @@
+-- Fails if a user owns more than one license, resolve those before rolling back
+CREATE TABLE UserLicense_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    license VARCHAR(25) NOT NULL UNIQUE,
+    UserId VARCHAR(50) NOT NULL UNIQUE,
+    createdAt TIMESTAMP NOT NULL,
+    updatedAt TIMESTAMP NOT NULL,
+    expiresAt TIMESTAMP NOT NULL,
+    hwid VARCHAR(50),
+    status VARCHAR(10) NOT NULL
+);
+
+INSERT INTO UserLicense_old (id, license, UserId, createdAt, updatedAt, expiresAt, hwid, status)
+SELECT id, license, UserId, createdAt, updatedAt, expiresAt, hwid, status FROM UserLicense;
+
+DROP TABLE UserLicense;
+ALTER TABLE UserLicense_old RENAME TO UserLicense;
+
+DROP TABLE Products;
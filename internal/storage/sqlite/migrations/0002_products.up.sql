@@ -0,0 +1,28 @@
+CREATE TABLE Products (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    code VARCHAR(50) NOT NULL UNIQUE,
+    name VARCHAR(255) NOT NULL,
+    createdAt TIMESTAMP NOT NULL
+);
+
+-- SQLite cannot drop the UNIQUE constraint on UserId in place, rebuild the table
+CREATE TABLE UserLicense_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    license VARCHAR(25) NOT NULL UNIQUE,
+    UserId VARCHAR(50) NOT NULL,
+    productId INTEGER REFERENCES Products(id),
+    createdAt TIMESTAMP NOT NULL,
+    updatedAt TIMESTAMP NOT NULL,
+    expiresAt TIMESTAMP NOT NULL,
+    hwid VARCHAR(50),
+    status VARCHAR(10) NOT NULL
+);
+
+INSERT INTO UserLicense_new (id, license, UserId, createdAt, updatedAt, expiresAt, hwid, status)
+SELECT id, license, UserId, createdAt, updatedAt, expiresAt, hwid, status FROM UserLicense;
+
+DROP TABLE UserLicense;
+ALTER TABLE UserLicense_new RENAME TO UserLicense;
+
+CREATE INDEX idx_userlicense_userid ON UserLicense (UserId);
+CREATE INDEX idx_userlicense_productid ON UserLicense (productId);
@@ -0,0 +1 @@
+ALTER TABLE Products ADD COLUMN keyPrefix VARCHAR(10) NOT NULL DEFAULT '';
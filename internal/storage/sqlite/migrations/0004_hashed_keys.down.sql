@@ -0,0 +1,23 @@
+-- Lossy: hashed keys cannot be recovered, so those licenses get their display prefix
+-- followed by their ID as license, which keeps it unique but no longer validates.
+-- Keys not hashed yet are still in displayPrefix and come back as they were.
+CREATE TABLE UserLicense_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    license VARCHAR(25) NOT NULL UNIQUE,
+    UserId VARCHAR(50) NOT NULL,
+    productId INTEGER REFERENCES Products(id),
+    createdAt TIMESTAMP NOT NULL,
+    updatedAt TIMESTAMP NOT NULL,
+    expiresAt TIMESTAMP NOT NULL,
+    hwid VARCHAR(50),
+    status VARCHAR(10) NOT NULL
+);
+
+INSERT INTO UserLicense_old (id, license, UserId, productId, createdAt, updatedAt, expiresAt, hwid, status)
+SELECT id, CASE WHEN keyHash IS NULL THEN displayPrefix ELSE displayPrefix || '-' || id END, UserId, productId, createdAt, updatedAt, expiresAt, hwid, status FROM UserLicense;
+
+DROP TABLE UserLicense;
+ALTER TABLE UserLicense_old RENAME TO UserLicense;
+
+CREATE INDEX idx_userlicense_userid ON UserLicense (UserId);
+CREATE INDEX idx_userlicense_productid ON UserLicense (productId);
@@ -0,0 +1,24 @@
+-- License keys are stored as an HMAC (keyHash) plus a short displayPrefix.
+-- Existing plaintext keys are copied into displayPrefix and hashed by the
+-- application on startup, see Storage.HashPlaintextKeys.
+CREATE TABLE UserLicense_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    displayPrefix VARCHAR(100) NOT NULL,
+    keyHash VARCHAR(64) UNIQUE,
+    UserId VARCHAR(50) NOT NULL,
+    productId INTEGER REFERENCES Products(id),
+    createdAt TIMESTAMP NOT NULL,
+    updatedAt TIMESTAMP NOT NULL,
+    expiresAt TIMESTAMP NOT NULL,
+    hwid VARCHAR(50),
+    status VARCHAR(10) NOT NULL
+);
+
+INSERT INTO UserLicense_new (id, displayPrefix, keyHash, UserId, productId, createdAt, updatedAt, expiresAt, hwid, status)
+SELECT id, license, NULL, UserId, productId, createdAt, updatedAt, expiresAt, hwid, status FROM UserLicense;
+
+DROP TABLE UserLicense;
+ALTER TABLE UserLicense_new RENAME TO UserLicense;
+
+CREATE INDEX idx_userlicense_userid ON UserLicense (UserId);
+CREATE INDEX idx_userlicense_productid ON UserLicense (productId);
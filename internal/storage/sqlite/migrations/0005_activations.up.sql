@@ -0,0 +1,17 @@
+-- A license may be in use on several machines, each one takes a seat in Activations.
+-- Existing HWID bindings become the first activation of their license.
+CREATE TABLE Activations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    licenseId INTEGER NOT NULL REFERENCES UserLicense(id) ON DELETE CASCADE,
+    hwid VARCHAR(255) NOT NULL,
+    label VARCHAR(100) NOT NULL DEFAULT '',
+    firstSeen TIMESTAMP NOT NULL,
+    lastSeen TIMESTAMP NOT NULL,
+    UNIQUE (licenseId, hwid)
+);
+
+INSERT INTO Activations (licenseId, hwid, firstSeen, lastSeen)
+SELECT id, hwid, updatedAt, updatedAt FROM UserLicense WHERE hwid IS NOT NULL AND hwid <> '';
+
+ALTER TABLE UserLicense ADD COLUMN maxActivations INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE UserLicense DROP COLUMN hwid;
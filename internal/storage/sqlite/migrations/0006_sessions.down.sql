@@ -0,0 +1,2 @@
+ALTER TABLE UserLicense DROP COLUMN maxSessions;
+DROP TABLE Sessions;
@@ -0,0 +1,15 @@
+-- Floating licenses: a seat is held by a session for as long as the client sends heartbeats
+CREATE TABLE Sessions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tokenHash VARCHAR(64) NOT NULL UNIQUE,
+    licenseId INTEGER NOT NULL REFERENCES UserLicense(id) ON DELETE CASCADE,
+    hwid VARCHAR(255) NOT NULL,
+    startedAt TIMESTAMP NOT NULL,
+    lastHeartbeat TIMESTAMP NOT NULL,
+    expiresAt TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_sessions_licenseid ON Sessions (licenseId);
+CREATE INDEX idx_sessions_expiresat ON Sessions (expiresAt);
+
+ALTER TABLE UserLicense ADD COLUMN maxSessions INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,11 @@
+-- Every renewal of a license with its expiry date before and after
+CREATE TABLE RenewalHistory (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    licenseId INTEGER NOT NULL REFERENCES UserLicense(id) ON DELETE CASCADE,
+    mode VARCHAR(32) NOT NULL,
+    oldExpiresAt TIMESTAMP NOT NULL,
+    newExpiresAt TIMESTAMP NOT NULL,
+    createdAt TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_renewalhistory_licenseid ON RenewalHistory (licenseId);
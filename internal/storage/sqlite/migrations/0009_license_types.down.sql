@@ -0,0 +1,25 @@
+-- Perpetual licenses get an expiry date far in the future
+CREATE TABLE UserLicense_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    displayPrefix VARCHAR(100) NOT NULL,
+    keyHash VARCHAR(64) UNIQUE,
+    UserId VARCHAR(50) NOT NULL,
+    productId INTEGER REFERENCES Products(id),
+    createdAt TIMESTAMP NOT NULL,
+    updatedAt TIMESTAMP NOT NULL,
+    expiresAt TIMESTAMP NOT NULL,
+    status VARCHAR(10) NOT NULL,
+    maxActivations INTEGER NOT NULL DEFAULT 1,
+    maxSessions INTEGER NOT NULL DEFAULT 1
+);
+
+INSERT INTO UserLicense_old (id, displayPrefix, keyHash, UserId, productId, createdAt, updatedAt, expiresAt, status, maxActivations, maxSessions)
+SELECT id, displayPrefix, keyHash, UserId, productId, createdAt, updatedAt, COALESCE(expiresAt, '9999-12-31 23:59:59 +0000 UTC'), status, maxActivations, maxSessions FROM UserLicense;
+
+DROP TABLE UserLicense;
+ALTER TABLE UserLicense_old RENAME TO UserLicense;
+
+CREATE INDEX idx_userlicense_userid ON UserLicense (UserId);
+CREATE INDEX idx_userlicense_productid ON UserLicense (productId);
+
+DROP TABLE TrialMachines;
@@ -0,0 +1,38 @@
+-- Licenses are a subscription, a trial or perpetual. Perpetual licenses have no expiry date,
+-- which SQLite can only allow by rebuilding the table.
+CREATE TABLE UserLicense_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    displayPrefix VARCHAR(100) NOT NULL,
+    keyHash VARCHAR(64) UNIQUE,
+    UserId VARCHAR(50) NOT NULL,
+    productId INTEGER REFERENCES Products(id),
+    licenseType VARCHAR(16) NOT NULL DEFAULT 'subscription',
+    createdAt TIMESTAMP NOT NULL,
+    updatedAt TIMESTAMP NOT NULL,
+    expiresAt TIMESTAMP,
+    updatesUntil TIMESTAMP,
+    status VARCHAR(10) NOT NULL,
+    maxActivations INTEGER NOT NULL DEFAULT 1,
+    maxSessions INTEGER NOT NULL DEFAULT 1
+);
+
+INSERT INTO UserLicense_new (id, displayPrefix, keyHash, UserId, productId, createdAt, updatedAt, expiresAt, status, maxActivations, maxSessions)
+SELECT id, displayPrefix, keyHash, UserId, productId, createdAt, updatedAt, expiresAt, status, maxActivations, maxSessions FROM UserLicense;
+
+DROP TABLE UserLicense;
+ALTER TABLE UserLicense_new RENAME TO UserLicense;
+
+CREATE INDEX idx_userlicense_userid ON UserLicense (UserId);
+CREATE INDEX idx_userlicense_productid ON UserLicense (productId);
+
+-- Machines that have used a trial, a machine gets one trial per product.
+-- licenseId has no foreign key, deleting the trial doesn't make the machine eligible again.
+CREATE TABLE TrialMachines (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    productId INTEGER REFERENCES Products(id),
+    hwid VARCHAR(255) NOT NULL,
+    licenseId INTEGER NOT NULL,
+    createdAt TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_trialmachines_product_hwid ON TrialMachines (COALESCE(productId, 0), hwid);
@@ -0,0 +1,2 @@
+DROP TABLE LicenseEntitlements;
+DROP TABLE ProductEntitlements;
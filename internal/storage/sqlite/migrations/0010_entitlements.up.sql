@@ -0,0 +1,18 @@
+-- Features the licenses of a product get, a NULL limitValue means unlimited
+CREATE TABLE ProductEntitlements (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    productId INTEGER NOT NULL REFERENCES Products(id) ON DELETE CASCADE,
+    feature VARCHAR(64) NOT NULL,
+    limitValue INTEGER,
+    UNIQUE (productId, feature)
+);
+
+-- Per license changes to the entitlements of its product, enabled = 0 takes a feature away
+CREATE TABLE LicenseEntitlements (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    licenseId INTEGER NOT NULL REFERENCES UserLicense(id) ON DELETE CASCADE,
+    feature VARCHAR(64) NOT NULL,
+    limitValue INTEGER,
+    enabled BOOLEAN NOT NULL DEFAULT 1,
+    UNIQUE (licenseId, feature)
+);
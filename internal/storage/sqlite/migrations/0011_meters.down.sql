@@ -0,0 +1,2 @@
+DROP TABLE MeterEvents;
+DROP TABLE Meters;
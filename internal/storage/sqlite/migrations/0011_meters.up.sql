@@ -0,0 +1,21 @@
+-- Usage meters count what a license used in the current period, up to a quota
+CREATE TABLE Meters (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    licenseId INTEGER NOT NULL REFERENCES UserLicense(id) ON DELETE CASCADE,
+    name VARCHAR(64) NOT NULL,
+    quota INTEGER NOT NULL,
+    period VARCHAR(16) NOT NULL,
+    used INTEGER NOT NULL DEFAULT 0,
+    periodStart TIMESTAMP NOT NULL,
+    UNIQUE (licenseId, name)
+);
+
+-- Every increment, the idempotency key makes retried increments count once
+CREATE TABLE MeterEvents (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    meterId INTEGER NOT NULL REFERENCES Meters(id) ON DELETE CASCADE,
+    idempotencyKey VARCHAR(128) NOT NULL,
+    amount INTEGER NOT NULL,
+    createdAt TIMESTAMP NOT NULL,
+    UNIQUE (meterId, idempotencyKey)
+);
@@ -0,0 +1,9 @@
+-- Machines owners unbound themselves, counted against the hwid_reset limits
+CREATE TABLE HwidResets (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    licenseId INTEGER NOT NULL REFERENCES UserLicense(id) ON DELETE CASCADE,
+    hwid VARCHAR(255) NOT NULL,
+    createdAt TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_hwidresets_licenseid ON HwidResets (licenseId);
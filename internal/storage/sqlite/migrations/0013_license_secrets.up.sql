@@ -0,0 +1,3 @@
+-- Hash of the secret that proves ownership of a license on the public bind/unbind endpoints,
+-- licenses created before it existed get one when it is reset
+ALTER TABLE UserLicense ADD COLUMN secretHash VARCHAR(64);
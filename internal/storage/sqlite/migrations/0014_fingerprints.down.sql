@@ -0,0 +1 @@
+ALTER TABLE Activations DROP COLUMN fingerprint;
@@ -0,0 +1,2 @@
+-- Hardware fingerprints, JSON objects of component name to hash, see lib/fingerprint
+ALTER TABLE Activations ADD COLUMN fingerprint TEXT;
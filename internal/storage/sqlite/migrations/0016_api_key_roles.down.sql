@@ -0,0 +1,3 @@
+UPDATE ApiKeys SET scopes = TRIM(REPLACE(REPLACE(REPLACE(' ' || scopes || ' ', ' licenses:freeze ', ' '), ' licenses:renew ', ' '), ' machines:manage ', ' '));
+
+ALTER TABLE ApiKeys DROP COLUMN role;
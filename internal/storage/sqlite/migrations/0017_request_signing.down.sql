@@ -0,0 +1,3 @@
+DROP TABLE RequestNonces;
+
+ALTER TABLE ApiKeys DROP COLUMN signingSecret;
@@ -0,0 +1,13 @@
+-- Signing secret of API keys that sign their requests, encrypted with the server secret
+ALTER TABLE ApiKeys ADD COLUMN signingSecret TEXT NOT NULL DEFAULT '';
+
+-- Nonces of signed requests, kept until their timestamp falls out of the allowed clock skew
+CREATE TABLE RequestNonces (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    apiKeyId INTEGER NOT NULL REFERENCES ApiKeys(id) ON DELETE CASCADE,
+    nonce VARCHAR(64) NOT NULL,
+    expiresAt TIMESTAMP NOT NULL,
+    UNIQUE (apiKeyId, nonce)
+);
+
+CREATE INDEX idx_requestnonces_expiresat ON RequestNonces (expiresAt);
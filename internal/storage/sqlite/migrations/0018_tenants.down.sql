@@ -0,0 +1,30 @@
+-- Fails if two tenants have products with the same code, or a machine used trials without a
+-- product in two tenants, resolve those before rolling back
+DROP INDEX idx_trialmachines_tenant_product_hwid;
+ALTER TABLE TrialMachines DROP COLUMN tenantId;
+CREATE UNIQUE INDEX idx_trialmachines_product_hwid ON TrialMachines (COALESCE(productId, 0), hwid);
+
+CREATE TABLE Products_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    code VARCHAR(50) NOT NULL UNIQUE,
+    name VARCHAR(255) NOT NULL,
+    createdAt TIMESTAMP NOT NULL,
+    keyPrefix VARCHAR(10) NOT NULL DEFAULT '',
+    graceDays INTEGER
+);
+
+INSERT INTO Products_old (id, code, name, createdAt, keyPrefix, graceDays)
+SELECT id, code, name, createdAt, keyPrefix, graceDays FROM Products;
+
+DROP TABLE Products;
+ALTER TABLE Products_old RENAME TO Products;
+
+DROP INDEX idx_transactionlogs_tenantid;
+DROP INDEX idx_apikeys_tenantid;
+DROP INDEX idx_userlicense_tenantid;
+
+ALTER TABLE TransactionLogs DROP COLUMN tenantId;
+ALTER TABLE ApiKeys DROP COLUMN tenantId;
+ALTER TABLE UserLicense DROP COLUMN tenantId;
+
+DROP TABLE Tenants;
@@ -0,0 +1,44 @@
+-- Vendors the service runs for. Everything created before tenants existed belongs to the default tenant.
+CREATE TABLE Tenants (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(100) NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'active',
+    createdAt TIMESTAMP NOT NULL
+);
+
+INSERT INTO Tenants (id, name, status, createdAt) VALUES (1, 'default', 'active', CURRENT_TIMESTAMP);
+
+-- No REFERENCES on added columns, SQLite couldn't drop them again when rolling back
+ALTER TABLE UserLicense ADD COLUMN tenantId INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE ApiKeys ADD COLUMN tenantId INTEGER NOT NULL DEFAULT 1;
+
+-- A machine gets one trial per product of every tenant
+ALTER TABLE TrialMachines ADD COLUMN tenantId INTEGER NOT NULL DEFAULT 1;
+DROP INDEX idx_trialmachines_product_hwid;
+CREATE UNIQUE INDEX idx_trialmachines_tenant_product_hwid ON TrialMachines (tenantId, COALESCE(productId, 0), hwid);
+
+-- NULL for entries about no tenant in particular, like sweeps of the background jobs
+ALTER TABLE TransactionLogs ADD COLUMN tenantId INTEGER;
+UPDATE TransactionLogs SET tenantId = 1;
+
+-- Product codes are unique per tenant, SQLite can only change the constraint by rebuilding the table
+CREATE TABLE Products_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenantId INTEGER NOT NULL DEFAULT 1 REFERENCES Tenants(id),
+    code VARCHAR(50) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    createdAt TIMESTAMP NOT NULL,
+    keyPrefix VARCHAR(10) NOT NULL DEFAULT '',
+    graceDays INTEGER,
+    UNIQUE (tenantId, code)
+);
+
+INSERT INTO Products_new (id, code, name, createdAt, keyPrefix, graceDays)
+SELECT id, code, name, createdAt, keyPrefix, graceDays FROM Products;
+
+DROP TABLE Products;
+ALTER TABLE Products_new RENAME TO Products;
+
+CREATE INDEX idx_userlicense_tenantid ON UserLicense (tenantId);
+CREATE INDEX idx_apikeys_tenantid ON ApiKeys (tenantId);
+CREATE INDEX idx_transactionlogs_tenantid ON TransactionLogs (tenantId);
@@ -0,0 +1,39 @@
+-- Structured audit records: who made each change, from where, and what it changed.
+-- Entries written before these columns existed have no actor, their action, license and target come from the description.
+ALTER TABLE TransactionLogs ADD COLUMN actor VARCHAR(20);
+ALTER TABLE TransactionLogs ADD COLUMN apiKeyId INTEGER;
+ALTER TABLE TransactionLogs ADD COLUMN ip VARCHAR(45);
+ALTER TABLE TransactionLogs ADD COLUMN requestId VARCHAR(36);
+ALTER TABLE TransactionLogs ADD COLUMN action VARCHAR(50) NOT NULL DEFAULT '';
+ALTER TABLE TransactionLogs ADD COLUMN licenseId INTEGER;
+ALTER TABLE TransactionLogs ADD COLUMN targetType VARCHAR(20);
+ALTER TABLE TransactionLogs ADD COLUMN targetId INTEGER;
+ALTER TABLE TransactionLogs ADD COLUMN beforeValues TEXT;
+ALTER TABLE TransactionLogs ADD COLUMN afterValues TEXT;
+
+UPDATE TransactionLogs
+SET action = substr(description, 8, instr(description || ' ', ' ') - 8)
+WHERE description LIKE 'action=%';
+
+-- The ID of the record an entry is about always directly follows the action, an ID further on is
+-- part of a value like a product code. CAST keeps the leading digits of the rest of the description.
+UPDATE TransactionLogs
+SET licenseId = CAST(substr(description, instr(description, ' ') + 12) AS INTEGER)
+WHERE action != '' AND substr(description, instr(description, ' '), 12) = ' license_id=';
+
+UPDATE TransactionLogs SET targetType = 'license', targetId = licenseId WHERE licenseId IS NOT NULL;
+
+UPDATE TransactionLogs
+SET targetType = 'product', targetId = CAST(substr(description, instr(description, ' ') + 12) AS INTEGER)
+WHERE action != '' AND substr(description, instr(description, ' '), 12) = ' product_id=';
+
+UPDATE TransactionLogs
+SET targetType = 'api_key', targetId = CAST(substr(description, instr(description, ' ') + 12) AS INTEGER)
+WHERE action != '' AND substr(description, instr(description, ' '), 12) = ' api_key_id=';
+
+UPDATE TransactionLogs
+SET targetType = 'tenant', targetId = CAST(substr(description, instr(description, ' ') + 11) AS INTEGER)
+WHERE action != '' AND substr(description, instr(description, ' '), 11) = ' tenant_id=';
+
+CREATE INDEX idx_transactionlogs_licenseid ON TransactionLogs (licenseId);
+CREATE INDEX idx_transactionlogs_target ON TransactionLogs (targetType, targetId);
@@ -2,12 +2,25 @@ package sqlite
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
+
+	"github.com/dzhisl/license-manager/internal/storage"
+	sqlite3 "modernc.org/sqlite"
+	sqlite3lib "modernc.org/sqlite/lib"
 )
 
-// DeleteLicenseById deletes a license by UserId
-func (s *Storage) DeleteLicenseById(userId string) error {
+// licenseColumns is the column list every license query selects, in scanLicense order
+const licenseColumns = `id, tenantId, displayPrefix, UserId, productId, licenseType, createdAt, updatedAt, expiresAt, updatesUntil, status, maxActivations, maxSessions`
+
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// DeleteLicenseById deletes a license by its ID
+func (s *Storage) DeleteLicenseById(id int64) error {
 	const op = "storage.sqlite.DeleteLicenseById"
 
 	// Start a transaction
@@ -17,13 +30,46 @@ func (s *Storage) DeleteLicenseById(userId string) error {
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.Prepare(`DELETE FROM UserLicense WHERE UserId = ?`)
+	license, err := scanLicense(tx.QueryRow(`SELECT `+licenseColumns+` FROM UserLicense WHERE id = ? AND `+s.tenantScope("tenantId"), id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%s: %w", op, storage.ErrLicenseNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Logged first, the entry finds its tenant through the license
+	if err := s.audit(tx, entry{
+		action:      "delete_license",
+		licenseId:   id,
+		before:      licenseValues(license),
+		description: fmt.Sprintf("action=delete_license license_id=%d", id),
+	}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Foreign keys are not enforced by SQLite unless enabled per connection, so clean up by hand
+	for _, query := range []string{
+		`DELETE FROM Activations WHERE licenseId = ?`,
+		`DELETE FROM Sessions WHERE licenseId = ?`,
+		`DELETE FROM RenewalHistory WHERE licenseId = ?`,
+		`DELETE FROM LicenseEntitlements WHERE licenseId = ?`,
+		`DELETE FROM MeterEvents WHERE meterId IN (SELECT id FROM Meters WHERE licenseId = ?)`,
+		`DELETE FROM Meters WHERE licenseId = ?`,
+		`DELETE FROM HwidResets WHERE licenseId = ?`,
+	} {
+		if _, err := tx.Exec(query, id); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	stmt, err := tx.Prepare(`DELETE FROM UserLicense WHERE id = ?`)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 	defer stmt.Close()
 
-	res, err := stmt.Exec(userId)
+	res, err := stmt.Exec(id)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
@@ -33,7 +79,7 @@ func (s *Storage) DeleteLicenseById(userId string) error {
 		return fmt.Errorf("%s: failed to get affected rows: %w", op, err)
 	}
 	if rowsAffected == 0 {
-		return fmt.Errorf("%s: no license found for Id: %s", op, userId)
+		return fmt.Errorf("%s: %w", op, storage.ErrLicenseNotFound)
 	}
 
 	// Commit transaction
@@ -41,65 +87,45 @@ func (s *Storage) DeleteLicenseById(userId string) error {
 		return fmt.Errorf("%s: transaction commit failed: %w", op, err)
 	}
 
-	// Log transaction
-	return s.LogTransaction(fmt.Sprintf("action=delete_license user_id=%s", userId))
+	return nil
 }
 
 // Get all licenses
-func (s *Storage) GetAllLicenses() ([]UserLicense, error) {
-	const op = "storage.sqlite.GetAllLicenses"
-
-	rows, err := s.db.Query(`SELECT id, license, UserId, createdAt, updatedAt, expiresAt, hwid, status FROM UserLicense`)
-	if err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
-	}
-	defer rows.Close()
-
-	var licenses []UserLicense
-
-	for rows.Next() {
-		var license UserLicense
-		var hwid sql.NullString
-
-		if err := rows.Scan(&license.ID, &license.License, &license.UserId, &license.CreatedAt, &license.UpdatedAt, &license.ExpiresAt, &hwid, &license.Status); err != nil {
-			return nil, fmt.Errorf("%s: %w", op, err)
-		}
-
-		if hwid.Valid {
-			license.HWID = &hwid.String
-		} else {
-			license.HWID = nil
-		}
-
-		licenses = append(licenses, license)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
-	}
+func (s *Storage) GetAllLicenses() ([]storage.License, error) {
+	return s.listLicenses("storage.sqlite.GetAllLicenses", `SELECT `+licenseColumns+` FROM UserLicense WHERE `+s.tenantScope("tenantId")+` ORDER BY id`)
+}
 
-	return licenses, nil
+// GetLicensesByUserId returns every license owned by the user
+func (s *Storage) GetLicensesByUserId(userId string) ([]storage.License, error) {
+	return s.listLicenses("storage.sqlite.GetLicensesByUserId", `SELECT `+licenseColumns+` FROM UserLicense WHERE UserId = ? AND `+s.tenantScope("tenantId")+` ORDER BY id`, userId)
 }
 
-func (s *Storage) AddLicense(license, UserId, status string, hwid *string, expiresAt time.Time) (int64, error) {
+// AddLicense inserts a new license stored under the hash of key and returns its ID
+func (s *Storage) AddLicense(license *storage.License, key, secret string) (int64, error) {
 	const op = "storage.sqlite.AddLicense"
 
-	stmt, err := s.db.Prepare(`
-INSERT INTO UserLicense (license, UserId, createdAt, updatedAt, expiresAt, hwid, status)
-VALUES (?, ?, ?, ?, ?, ?, ?)
-`)
+	tx, err := s.db.Begin()
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
+	defer tx.Rollback()
 
-	now := time.Now()
-	hwidValue := sql.NullString{Valid: false}
-	if hwid != nil {
-		hwidValue = sql.NullString{String: *hwid, Valid: true}
+	stmt, err := tx.Prepare(`
+INSERT INTO UserLicense (tenantId, displayPrefix, keyHash, secretHash, UserId, productId, licenseType, createdAt, updatedAt, expiresAt, updatesUntil, status, maxActivations, maxSessions)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+`)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
 	}
+	defer stmt.Close()
 
-	res, err := stmt.Exec(license, UserId, now, now, expiresAt, hwidValue, status)
+	now := time.Now()
+	displayPrefix := s.hasher.DisplayPrefix(key)
+	res, err := stmt.Exec(s.tenant(), displayPrefix, s.hasher.Hash(key), s.hasher.Hash(secret), license.UserId, nullInt64(license.ProductId), license.Type, now, now, license.ExpiresAt, license.UpdatesUntil, license.Status, license.MaxActivations, license.MaxSessions)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrLicenseExists)
+		}
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
@@ -108,114 +134,153 @@ VALUES (?, ?, ?, ?, ?, ?, ?)
 		return 0, fmt.Errorf("%s: failed to get last insert id: %w", op, err)
 	}
 
-	err = s.LogTransaction(fmt.Sprintf(
-		"action=add_license license=%s user_id=%s",
-		license, UserId,
-	))
+	license.ID = id
+	license.TenantId = s.tenant()
+	license.DisplayPrefix = displayPrefix
+	license.CreatedAt = now
+	license.UpdatedAt = now
+
+	err = s.audit(tx, entry{
+		action:    "add_license",
+		licenseId: id,
+		after:     licenseValues(license),
+		description: fmt.Sprintf(
+			"action=add_license license_id=%d license=%s user_id=%s type=%s",
+			id, displayPrefix, license.UserId, license.Type,
+		),
+	})
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+
 	return id, nil
 }
 
-// RenewLicenseById renews the license by extending its expiration date
-func (s *Storage) RenewLicenseById(userId string, days int) (time.Time, error) {
-	const op = "storage.sqlite.RenewLicenseById"
-
-	expirationTime := time.Now().AddDate(0, 0, days)
+// Common method to retrieve a license
+func (s *Storage) getLicense(query string, param any) (*storage.License, error) {
+	const op = "storage.sqlite.getLicense"
 
-	stmt, err := s.db.Prepare(`UPDATE UserLicense SET expiresAt = ?, updatedAt = ? WHERE UserId = ?`)
+	license, err := scanLicense(s.db.QueryRow(query, param))
 	if err != nil {
-		return time.Time{}, fmt.Errorf("%s: %w", op, err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrLicenseNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
-	defer stmt.Close()
 
-	res, err := stmt.Exec(expirationTime, time.Now(), userId)
+	return license, nil
+}
+
+// Common method to retrieve a list of licenses
+func (s *Storage) listLicenses(op, query string, args ...any) ([]storage.License, error) {
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
-		return time.Time{}, fmt.Errorf("%s: %w", op, err)
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
+	defer rows.Close()
 
-	rowsAffected, err := res.RowsAffected()
-	if err != nil || rowsAffected == 0 {
-		return time.Time{}, fmt.Errorf("%s: no license found for UserId: %s", op, userId)
-	}
+	var licenses []storage.License
 
-	return expirationTime, s.LogTransaction(fmt.Sprintf("action=renew_license user_id=%s days=%d", userId, days))
-}
+	for rows.Next() {
+		license, err := scanLicense(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
 
-// Common method to retrieve a license
-func (s *Storage) getLicense(query, param, paramName string) (*UserLicense, error) {
-	const op = "storage.sqlite.getLicense"
+		licenses = append(licenses, *license)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
 
-	row := s.db.QueryRow(query, param)
+	return licenses, nil
+}
 
-	var license UserLicense
-	var hwid sql.NullString
+// scanLicense reads a row selected with licenseColumns
+func scanLicense(row scanner) (*storage.License, error) {
+	var license storage.License
+	var productId sql.NullInt64
 
-	err := row.Scan(&license.ID, &license.License, &license.UserId, &license.CreatedAt, &license.UpdatedAt, &license.ExpiresAt, &hwid, &license.Status)
+	err := row.Scan(&license.ID, &license.TenantId, &license.DisplayPrefix, &license.UserId, &productId, &license.Type, &license.CreatedAt, &license.UpdatedAt, &license.ExpiresAt, &license.UpdatesUntil, &license.Status, &license.MaxActivations, &license.MaxSessions)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("%s: no license found for %s: %s", op, paramName, param)
-		}
-		return nil, fmt.Errorf("%s: %w", op, err)
+		return nil, err
 	}
 
-	if hwid.Valid {
-		license.HWID = &hwid.String
-	} else {
-		license.HWID = nil
+	if productId.Valid {
+		license.ProductId = &productId.Int64
 	}
 
 	return &license, nil
 }
 
-// Update HWID helper
-func (s *Storage) updateHwid(license, hwid, action string) error {
-	const op = "storage.sqlite.updateHwid"
+// Freeze/Unfreeze license helper
+func (s *Storage) updateLicenseStatus(id int64, status string) error {
+	return s.setLicenseValue("storage.sqlite.updateLicenseStatus", id, "status", "status", status,
+		status+"_license", fmt.Sprintf("action=%s_license license_id=%d", status, id))
+}
 
-	stmt, err := s.db.Prepare(`UPDATE UserLicense SET hwid = ?, updatedAt = ? WHERE license = ?`)
+// Common method to change one column of a license, the transaction log records the old
+// and the new value under key
+func (s *Storage) setLicenseValue(op string, id int64, column, key string, value any, action, description string) error {
+	tx, err := s.db.Begin()
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
-	defer stmt.Close()
+	defer tx.Rollback()
 
-	res, err := stmt.Exec(hwid, time.Now(), license)
-	if err != nil {
+	var old any
+	if err := tx.QueryRow(`SELECT `+column+` FROM UserLicense WHERE id = ? AND `+s.tenantScope("tenantId"), id).Scan(&old); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%s: %w", op, storage.ErrLicenseNotFound)
+		}
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	rowsAffected, err := res.RowsAffected()
-	if err != nil || rowsAffected == 0 {
-		return fmt.Errorf("%s: no license found for License: %s", op, license)
+	if _, err := tx.Exec(`UPDATE UserLicense SET `+column+` = ?, updatedAt = ? WHERE id = ?`, value, time.Now(), id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	return s.LogTransaction(fmt.Sprintf("action=%s hwid=%s license=%s", action, hwid, license))
-}
-
-// Freeze/Unfreeze license helper
-func (s *Storage) updateLicenseStatus(userId, status string) error {
-	stmt, err := s.db.Prepare(`UPDATE UserLicense SET status = ?, updatedAt = ? WHERE UserId = ?`)
-	if err != nil {
-		return fmt.Errorf("storage.sqlite.updateLicenseStatus: %w", err)
+	if err := s.audit(tx, entry{
+		action:      action,
+		licenseId:   id,
+		before:      map[string]any{key: old},
+		after:       map[string]any{key: value},
+		description: description,
+	}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
-	defer stmt.Close()
 
-	res, err := stmt.Exec(status, time.Now(), userId)
-	if err != nil {
-		return fmt.Errorf("storage.sqlite.updateLicenseStatus: %w", err)
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: transaction commit failed: %w", op, err)
 	}
 
-	rowsAffected, err := res.RowsAffected()
-	if err != nil || rowsAffected == 0 {
-		return fmt.Errorf("storage.sqlite.updateLicenseStatus: no license found for UserId: %s", userId)
+	return nil
+}
+
+// isUniqueViolation reports whether err was caused by a UNIQUE constraint
+func isUniqueViolation(err error) bool {
+	var sqliteErr *sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqlite3lib.SQLITE_CONSTRAINT_UNIQUE
 	}
+	return false
+}
 
-	return s.LogTransaction(fmt.Sprintf("action=%s_license user_id=%s", status, userId))
+func nullInt(i *int) sql.NullInt64 {
+	if i == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(*i), Valid: true}
 }
 
-// LogTransaction logs transaction actions
-func (s *Storage) LogTransaction(description string) error {
-	_, err := s.db.Exec(`INSERT INTO TransactionLogs (description) VALUES (?)`, description)
-	return err
+func nullInt64(i *int64) sql.NullInt64 {
+	if i == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: *i, Valid: true}
 }
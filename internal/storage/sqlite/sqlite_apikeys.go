@@ -0,0 +1,277 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dzhisl/license-manager/internal/lib/apikey"
+	"github.com/dzhisl/license-manager/internal/storage"
+)
+
+// apiKeyColumns is the column list every API key query selects, in scanApiKey order
+const apiKeyColumns = `id, tenantId, name, displayPrefix, role, scopes, createdAt, expiresAt, lastUsedAt, revokedAt, signingSecret`
+
+// AddApiKey inserts a new API key stored under the hash of key and returns its ID
+func (s *Storage) AddApiKey(apiKey *storage.ApiKey, key string) (int64, error) {
+	const op = "storage.sqlite.AddApiKey"
+
+	now := time.Now()
+	displayPrefix := apikey.DisplayPrefix(key)
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+INSERT INTO ApiKeys (tenantId, name, displayPrefix, keyHash, role, scopes, createdAt, expiresAt, signingSecret) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+`, s.tenant(), apiKey.Name, displayPrefix, s.hasher.Hash(key), apiKey.Role, strings.Join(apiKey.Scopes, " "), now, apiKey.ExpiresAt, apiKey.SigningSecret)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: failed to get last insert id: %w", op, err)
+	}
+
+	apiKey.ID = id
+	apiKey.TenantId = s.tenant()
+	apiKey.DisplayPrefix = displayPrefix
+	apiKey.CreatedAt = now
+
+	err = s.audit(tx, entry{
+		action:     "add_api_key",
+		targetType: storage.TargetApiKey,
+		targetId:   id,
+		after:      map[string]any{"name": apiKey.Name, "role": apiKey.Role, "scopes": apiKey.Scopes},
+		description: fmt.Sprintf(
+			"action=add_api_key api_key_id=%d name=%q key=%s role=%s scopes=%s signed=%t",
+			id, apiKey.Name, displayPrefix, apiKey.Role, strings.Join(apiKey.Scopes, ","), apiKey.SigningSecret != "",
+		),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// GetApiKeyByKey looks the API key up by the hash of key.
+// Only the keyed hash reaches the database, so lookup timing reveals nothing about the key.
+func (s *Storage) GetApiKeyByKey(key string) (*storage.ApiKey, error) {
+	const op = "storage.sqlite.GetApiKeyByKey"
+
+	apiKey, err := scanApiKey(s.db.QueryRow(`SELECT `+apiKeyColumns+` FROM ApiKeys WHERE keyHash = ? AND `+s.tenantScope("tenantId"), s.hasher.Hash(key)))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrApiKeyNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return apiKey, nil
+}
+
+// GetApiKeyById looks the API key up by its ID, revoked and expired keys included
+func (s *Storage) GetApiKeyById(id int64) (*storage.ApiKey, error) {
+	const op = "storage.sqlite.GetApiKeyById"
+
+	apiKey, err := scanApiKey(s.db.QueryRow(`SELECT `+apiKeyColumns+` FROM ApiKeys WHERE id = ? AND `+s.tenantScope("tenantId"), id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrApiKeyNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return apiKey, nil
+}
+
+// GetApiKeys returns every API key, revoked ones included, oldest first
+func (s *Storage) GetApiKeys() ([]storage.ApiKey, error) {
+	const op = "storage.sqlite.GetApiKeys"
+
+	rows, err := s.db.Query(`SELECT ` + apiKeyColumns + ` FROM ApiKeys WHERE ` + s.tenantScope("tenantId") + ` ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var apiKeys []storage.ApiKey
+
+	for rows.Next() {
+		apiKey, err := scanApiKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		apiKeys = append(apiKeys, *apiKey)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return apiKeys, nil
+}
+
+// RevokeApiKey marks the API key as revoked
+func (s *Storage) RevokeApiKey(id int64) error {
+	const op = "storage.sqlite.RevokeApiKey"
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var revokedAt *time.Time
+	if err := tx.QueryRow(`SELECT revokedAt FROM ApiKeys WHERE id = ? AND `+s.tenantScope("tenantId"), id).Scan(&revokedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%s: %w", op, storage.ErrApiKeyNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// revoking a revoked key keeps the time it was first revoked at
+	newRevokedAt := revokedAt
+	if newRevokedAt == nil {
+		now := time.Now()
+		newRevokedAt = &now
+	}
+
+	if _, err := tx.Exec(`UPDATE ApiKeys SET revokedAt = ? WHERE id = ?`, newRevokedAt, id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = s.audit(tx, entry{
+		action:      "revoke_api_key",
+		targetType:  storage.TargetApiKey,
+		targetId:    id,
+		before:      map[string]any{"revoked_at": revokedAt},
+		after:       map[string]any{"revoked_at": newRevokedAt},
+		description: fmt.Sprintf("action=revoke_api_key api_key_id=%d", id),
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+
+	return nil
+}
+
+// SetApiKeyRole changes the role of the API key, an empty role leaves it with its own scopes only
+func (s *Storage) SetApiKeyRole(id int64, role apikey.Role) error {
+	const op = "storage.sqlite.SetApiKeyRole"
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var old apikey.Role
+	if err := tx.QueryRow(`SELECT role FROM ApiKeys WHERE id = ? AND `+s.tenantScope("tenantId"), id).Scan(&old); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%s: %w", op, storage.ErrApiKeyNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := tx.Exec(`UPDATE ApiKeys SET role = ? WHERE id = ?`, role, id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = s.audit(tx, entry{
+		action:      "set_api_key_role",
+		targetType:  storage.TargetApiKey,
+		targetId:    id,
+		before:      map[string]any{"role": old},
+		after:       map[string]any{"role": role},
+		description: fmt.Sprintf("action=set_api_key_role api_key_id=%d role=%s", id, role),
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+
+	return nil
+}
+
+// SetApiKeySigningSecret replaces the sealed signing secret, the key only accepts signed requests from now on
+func (s *Storage) SetApiKeySigningSecret(id int64, sealedSecret string) error {
+	const op = "storage.sqlite.SetApiKeySigningSecret"
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`UPDATE ApiKeys SET signingSecret = ? WHERE id = ? AND `+s.tenantScope("tenantId"), sealedSecret, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: failed to get affected rows: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrApiKeyNotFound)
+	}
+
+	// the secret itself never goes into the log
+	err = s.audit(tx, entry{
+		action:      "rotate_signing_secret",
+		targetType:  storage.TargetApiKey,
+		targetId:    id,
+		description: fmt.Sprintf("action=rotate_signing_secret api_key_id=%d", id),
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+
+	return nil
+}
+
+// TouchApiKey records that the API key was used at now
+func (s *Storage) TouchApiKey(id int64, now time.Time) error {
+	const op = "storage.sqlite.TouchApiKey"
+
+	if _, err := s.db.Exec(`UPDATE ApiKeys SET lastUsedAt = ? WHERE id = ?`, now, id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func scanApiKey(row scanner) (*storage.ApiKey, error) {
+	var apiKey storage.ApiKey
+	var scopes string
+	err := row.Scan(&apiKey.ID, &apiKey.TenantId, &apiKey.Name, &apiKey.DisplayPrefix, &apiKey.Role, &scopes, &apiKey.CreatedAt, &apiKey.ExpiresAt, &apiKey.LastUsedAt, &apiKey.RevokedAt, &apiKey.SigningSecret)
+	if err != nil {
+		return nil, err
+	}
+	apiKey.Scopes = strings.Fields(scopes)
+
+	return &apiKey, nil
+}
@@ -0,0 +1,79 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/dzhisl/license-manager/internal/lib/grace"
+)
+
+// ExpireLicenses moves active licenses past their grace period to the expired status
+func (s *Storage) ExpireLicenses(now time.Time, defaultGraceDays int) ([]int64, error) {
+	const op = "storage.sqlite.ExpireLicenses"
+
+	// Reading inside the transaction keeps a renewal from slipping in between the check and the update
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	// expiresAt is stored as text in the server's time zone, so it is compared in Go
+	rows, err := tx.Query(`
+SELECT UserLicense.id, UserLicense.expiresAt, Products.graceDays
+FROM UserLicense LEFT JOIN Products ON Products.id = UserLicense.productId
+WHERE UserLicense.status = 'active' AND UserLicense.expiresAt IS NOT NULL AND ` + s.tenantScope("UserLicense.tenantId"))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var due []int64
+	for rows.Next() {
+		var id int64
+		var expiresAt time.Time
+		var graceDays sql.NullInt64
+		if err := rows.Scan(&id, &expiresAt, &graceDays); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		policy := grace.Policy{Days: defaultGraceDays}
+		if graceDays.Valid {
+			policy.Days = int(graceDays.Int64)
+		}
+		if policy.State(expiresAt, now) == grace.Expired {
+			due = append(due, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(due) == 0 {
+		return nil, nil
+	}
+
+	for _, id := range due {
+		if _, err := tx.Exec(`UPDATE UserLicense SET status = 'expired', updatedAt = ? WHERE id = ?`, now, id); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		err := s.audit(tx, entry{
+			action:      "expire_license",
+			licenseId:   id,
+			before:      map[string]any{"status": "active"},
+			after:       map[string]any{"status": "expired"},
+			description: fmt.Sprintf("action=expire_license license_id=%d", id),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+
+	return due, nil
+}
@@ -2,66 +2,63 @@ package sqlite
 
 import (
 	"database/sql"
+	"embed"
 	"fmt"
-	"time"
+	"io/fs"
+	"strings"
 
-	_ "modernc.org/sqlite"
+	"github.com/dzhisl/license-manager/internal/lib/licensekey"
+	"github.com/dzhisl/license-manager/internal/storage"
+	"github.com/dzhisl/license-manager/internal/storage/migrate"
 )
 
-type Storage struct {
-	db *sql.DB
-}
+var _ storage.Store = (*Storage)(nil)
 
-type UserLicense struct {
-	ID        int64
-	License   string
-	UserId    string
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	ExpiresAt time.Time
-	HWID      *string
-	Status    string
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Storage is the SQLite implementation of storage.LicenseStore
+type Storage struct {
+	db     *sql.DB
+	hasher *licensekey.Hasher
+	// tenantId is the tenant the store is scoped to, 0 for the store that sees every tenant
+	tenantId int64
+	// actor is who the transaction log records as making the changes of the store
+	actor storage.Actor
 }
 
-func New(storagePath string) (*Storage, error) {
+// New opens the SQLite database, the schema is managed by Migrator
+func New(storagePath string, hasher *licensekey.Hasher) (*Storage, error) {
 	const op = "storage.sqlite.New"
 
+	// Writers wait for each other instead of failing with SQLITE_BUSY, and transactions take the
+	// write lock when they begin, so what they read can't change before they write
+	sep := "?"
+	if strings.Contains(storagePath, "?") {
+		sep = "&"
+	}
+	dsn := storagePath + sep + "_pragma=busy_timeout(5000)&_txlock=immediate"
+
 	// Open the SQLite database using modernc.org/sqlite
-	db, err := sql.Open("sqlite", storagePath)
+	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	// Prepare SQL statements to create the required tables if they don't exist
-	createUserLicenseTable := `
-CREATE TABLE IF NOT EXISTS UserLicense (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    license VARCHAR(25) NOT NULL UNIQUE,
-    UserId VARCHAR(50) NOT NULL UNIQUE,
-    createdAt TIMESTAMP NOT NULL,
-    updatedAt TIMESTAMP NOT NULL,
-    expiresAt TIMESTAMP NOT NULL,
-    hwid VARCHAR(50),
-    status VARCHAR(10) NOT NULL
-);`
-
-	createTransactionLogsTable := `
-CREATE TABLE IF NOT EXISTS TransactionLogs (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
-    description TEXT NOT NULL
-);`
-
-	// Execute the SQL statement to create UserLicense table
-	if _, err := db.Exec(createUserLicenseTable); err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
-	}
+	// Return the storage instance
+	return &Storage{db: db, hasher: hasher}, nil
+}
 
-	// Execute the SQL statement to create TransactionLogs table
-	if _, err := db.Exec(createTransactionLogsTable); err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
+// Migrator returns the schema migrator for this database
+func (s *Storage) Migrator() (*migrate.Migrator, error) {
+	sub, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("storage.sqlite.Migrator: %w", err)
 	}
+	return migrate.New(s.db, sub, migrate.Question)
+}
 
-	// Return the storage instance
-	return &Storage{db: db}, nil
+// Close closes the underlying database
+func (s *Storage) Close() error {
+	return s.db.Close()
 }
@@ -0,0 +1,137 @@
+package sqlite
+
+import (
+	"fmt"
+)
+
+// HashPlaintextKeys converts licenses whose key is still stored in plaintext
+// (databases created before 0004_hashed_keys) to a keyed hash plus display prefix,
+// and scrubs those keys from the transaction log
+func (s *Storage) HashPlaintextKeys() (int, error) {
+	const op = "storage.sqlite.HashPlaintextKeys"
+
+	type plaintextKey struct {
+		id  int64
+		key string
+	}
+
+	// Before hashing, displayPrefix still holds the full plaintext key
+	rows, err := s.db.Query(`SELECT id, displayPrefix FROM UserLicense WHERE keyHash IS NULL`)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var keys []plaintextKey
+	for rows.Next() {
+		var k plaintextKey
+		if err := rows.Scan(&k.id, &k.key); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		keys = append(keys, k)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	for _, k := range keys {
+		displayPrefix := s.hasher.DisplayPrefix(k.key)
+
+		_, err := tx.Exec(`UPDATE UserLicense SET keyHash = ?, displayPrefix = ? WHERE id = ?`, s.hasher.Hash(k.key), displayPrefix, k.id)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		_, err = tx.Exec(`UPDATE TransactionLogs SET description = REPLACE(description, ?, ?) WHERE description LIKE ?`,
+			"license="+k.key, "license="+displayPrefix, "%license="+k.key+"%")
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := s.audit(tx, entry{action: "hash_plaintext_keys", description: fmt.Sprintf("action=hash_plaintext_keys count=%d", len(keys))}); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+
+	return len(keys), nil
+}
+
+// ShortenDisplayPrefixes cuts the display prefixes stored when they were the first two parts of the key
+// down to what the key hasher keeps now, in the transaction log too, and returns how many changed
+func (s *Storage) ShortenDisplayPrefixes() (int, error) {
+	const op = "storage.sqlite.ShortenDisplayPrefixes"
+
+	type displayPrefix struct {
+		id         int64
+		old, short string
+	}
+
+	rows, err := s.db.Query(`SELECT id, displayPrefix FROM UserLicense WHERE keyHash IS NOT NULL`)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var prefixes []displayPrefix
+	for rows.Next() {
+		var p displayPrefix
+		if err := rows.Scan(&p.id, &p.old); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		if p.short = s.hasher.ShortenDisplayPrefix(p.old); p.short != p.old {
+			prefixes = append(prefixes, p)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(prefixes) == 0 {
+		return 0, nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	for _, p := range prefixes {
+		_, err := tx.Exec(`UPDATE UserLicense SET displayPrefix = ? WHERE id = ?`, p.short, p.id)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		_, err = tx.Exec(`UPDATE TransactionLogs SET description = REPLACE(description, ?, ?) WHERE description LIKE ?`,
+			"license="+p.old, "license="+p.short, "%license="+p.old+"%")
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := s.audit(tx, entry{action: "shorten_display_prefixes", description: fmt.Sprintf("action=shorten_display_prefixes count=%d", len(prefixes))}); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+
+	return len(prefixes), nil
+}
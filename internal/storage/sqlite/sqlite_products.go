@@ -0,0 +1,177 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/dzhisl/license-manager/internal/storage"
+)
+
+// productColumns is the column list every product query selects, in scanProduct order
+const productColumns = `id, tenantId, code, name, keyPrefix, graceDays, createdAt`
+
+// AddProduct inserts a new product and returns its ID
+func (s *Storage) AddProduct(product *storage.Product) (int64, error) {
+	const op = "storage.sqlite.AddProduct"
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	res, err := tx.Exec(`INSERT INTO Products (tenantId, code, name, keyPrefix, graceDays, createdAt) VALUES (?, ?, ?, ?, ?, ?)`, s.tenant(), product.Code, product.Name, product.KeyPrefix, nullInt(product.GraceDays), now)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrProductExists)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: failed to get last insert id: %w", op, err)
+	}
+
+	product.ID = id
+	product.TenantId = s.tenant()
+	product.CreatedAt = now
+
+	err = s.audit(tx, entry{
+		action:     "add_product",
+		targetType: storage.TargetProduct,
+		targetId:   id,
+		after: map[string]any{
+			"code":       product.Code,
+			"name":       product.Name,
+			"key_prefix": product.KeyPrefix,
+			"grace_days": product.GraceDays,
+		},
+		description: fmt.Sprintf("action=add_product product_id=%d code=%s", id, product.Code),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// GetProductByCode retrieves a product by its unique code
+func (s *Storage) GetProductByCode(code string) (*storage.Product, error) {
+	return s.getProduct("storage.sqlite.GetProductByCode", `SELECT `+productColumns+` FROM Products WHERE code = ? AND `+s.tenantScope("tenantId"), code)
+}
+
+// GetProductById retrieves a product by its ID
+func (s *Storage) GetProductById(id int64) (*storage.Product, error) {
+	return s.getProduct("storage.sqlite.GetProductById", `SELECT `+productColumns+` FROM Products WHERE id = ? AND `+s.tenantScope("tenantId"), id)
+}
+
+// Common method to retrieve a product
+func (s *Storage) getProduct(op, query string, param any) (*storage.Product, error) {
+	product, err := scanProduct(s.db.QueryRow(query, param))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrProductNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return product, nil
+}
+
+// GetAllProducts lists every product
+func (s *Storage) GetAllProducts() ([]storage.Product, error) {
+	const op = "storage.sqlite.GetAllProducts"
+
+	rows, err := s.db.Query(`SELECT ` + productColumns + ` FROM Products WHERE ` + s.tenantScope("tenantId") + ` ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var products []storage.Product
+	for rows.Next() {
+		product, err := scanProduct(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		products = append(products, *product)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return products, nil
+}
+
+// SetProductGraceDays changes the grace period of the product's licenses, nil falls back to the default
+func (s *Storage) SetProductGraceDays(id int64, days *int) error {
+	const op = "storage.sqlite.SetProductGraceDays"
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var old *int64
+	if err := tx.QueryRow(`SELECT graceDays FROM Products WHERE id = ? AND `+s.tenantScope("tenantId"), id).Scan(&old); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%s: %w", op, storage.ErrProductNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := tx.Exec(`UPDATE Products SET graceDays = ? WHERE id = ?`, nullInt(days), id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	graceDays := "default"
+	if days != nil {
+		graceDays = strconv.Itoa(*days)
+	}
+	err = s.audit(tx, entry{
+		action:      "set_product_grace",
+		targetType:  storage.TargetProduct,
+		targetId:    id,
+		before:      map[string]any{"grace_days": old},
+		after:       map[string]any{"grace_days": days},
+		description: fmt.Sprintf("action=set_product_grace product_id=%d grace_days=%s", id, graceDays),
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+
+	return nil
+}
+
+// scanProduct reads a row selected with productColumns
+func scanProduct(row scanner) (*storage.Product, error) {
+	var product storage.Product
+	var graceDays sql.NullInt64
+
+	err := row.Scan(&product.ID, &product.TenantId, &product.Code, &product.Name, &product.KeyPrefix, &graceDays, &product.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if graceDays.Valid {
+		days := int(graceDays.Int64)
+		product.GraceDays = &days
+	}
+
+	return &product, nil
+}
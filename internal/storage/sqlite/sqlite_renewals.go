@@ -0,0 +1,130 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dzhisl/license-manager/internal/lib/renewal"
+	"github.com/dzhisl/license-manager/internal/storage"
+)
+
+// renewalColumns is the column list every renewal query selects, in scanRenewal order
+const renewalColumns = `id, licenseId, mode, oldExpiresAt, newExpiresAt, createdAt`
+
+// RenewLicenseById moves the expiry date of the license as described by plan and records the renewal
+func (s *Storage) RenewLicenseById(id int64, plan renewal.Plan) (*storage.Renewal, error) {
+	const op = "storage.sqlite.RenewLicenseById"
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	var licenseType, status string
+	var expiresAt *time.Time
+	err = tx.QueryRow(`SELECT licenseType, status, expiresAt FROM UserLicense WHERE id = ? AND `+s.tenantScope("tenantId"), id).Scan(&licenseType, &status, &expiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrLicenseNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if licenseType != storage.TypeSubscription || expiresAt == nil {
+		return nil, fmt.Errorf("%s: %w", op, storage.ErrNotRenewable)
+	}
+	oldExpiresAt := *expiresAt
+
+	newExpiresAt := plan.NewExpiry(oldExpiresAt, now)
+	newStatus := status
+	if status == "expired" && newExpiresAt.After(now) {
+		newStatus = "active"
+	}
+	_, err = tx.Exec(`UPDATE UserLicense SET expiresAt = ?, status = ?, updatedAt = ? WHERE id = ?`, newExpiresAt, newStatus, now, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := tx.Exec(`
+INSERT INTO RenewalHistory (licenseId, mode, oldExpiresAt, newExpiresAt, createdAt)
+VALUES (?, ?, ?, ?, ?)
+`, id, plan.Mode, oldExpiresAt, newExpiresAt, now)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	renewalId, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to get last insert id: %w", op, err)
+	}
+
+	err = s.audit(tx, entry{
+		action:    "renew_license",
+		licenseId: id,
+		before:    map[string]any{"expires_at": oldExpiresAt, "status": status},
+		after:     map[string]any{"expires_at": newExpiresAt, "status": newStatus},
+		description: fmt.Sprintf("action=renew_license license_id=%d mode=%s old_expires_at=%s new_expires_at=%s",
+			id, plan.Mode, oldExpiresAt.Format(time.RFC3339), newExpiresAt.Format(time.RFC3339)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+
+	renewed := &storage.Renewal{
+		ID:           renewalId,
+		LicenseId:    id,
+		Mode:         plan.Mode,
+		OldExpiresAt: oldExpiresAt,
+		NewExpiresAt: newExpiresAt,
+		CreatedAt:    now,
+	}
+
+	return renewed, nil
+}
+
+// GetRenewals returns the renewal history of the license, oldest first
+func (s *Storage) GetRenewals(licenseId int64) ([]storage.Renewal, error) {
+	const op = "storage.sqlite.GetRenewals"
+
+	rows, err := s.db.Query(`SELECT `+renewalColumns+` FROM RenewalHistory WHERE licenseId = ? AND `+s.licenseScope("licenseId")+` ORDER BY id`, licenseId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var renewals []storage.Renewal
+
+	for rows.Next() {
+		renewed, err := scanRenewal(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		renewals = append(renewals, *renewed)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return renewals, nil
+}
+
+// scanRenewal reads a row selected with renewalColumns
+func scanRenewal(row scanner) (*storage.Renewal, error) {
+	var renewed storage.Renewal
+
+	err := row.Scan(&renewed.ID, &renewed.LicenseId, &renewed.Mode, &renewed.OldExpiresAt, &renewed.NewExpiresAt, &renewed.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &renewed, nil
+}
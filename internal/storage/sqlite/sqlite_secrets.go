@@ -0,0 +1,93 @@
+package sqlite
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dzhisl/license-manager/internal/storage"
+)
+
+// ResetLicenseSecret stores the hash of a new ownership secret for the license
+func (s *Storage) ResetLicenseSecret(id int64, secret string) error {
+	const op = "storage.sqlite.ResetLicenseSecret"
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`UPDATE UserLicense SET secretHash = ?, updatedAt = ? WHERE id = ? AND `+s.tenantScope("tenantId"), s.hasher.Hash(secret), time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: failed to get affected rows: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrLicenseNotFound)
+	}
+
+	// The secret itself stays out of the log
+	if err := s.audit(tx, entry{
+		action:      "reset_license_secret",
+		licenseId:   id,
+		description: fmt.Sprintf("action=reset_license_secret license_id=%d", id),
+	}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+
+	return nil
+}
+
+// CheckLicenseSecret compares the hash of secret with the stored one in constant time
+func (s *Storage) CheckLicenseSecret(id int64, secret string) (bool, error) {
+	const op = "storage.sqlite.CheckLicenseSecret"
+
+	var secretHash sql.NullString
+	if err := s.db.QueryRow(`SELECT secretHash FROM UserLicense WHERE id = ? AND `+s.tenantScope("tenantId"), id).Scan(&secretHash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, fmt.Errorf("%s: %w", op, storage.ErrLicenseNotFound)
+		}
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	if !secretHash.Valid || secret == "" {
+		return false, nil
+	}
+
+	return subtle.ConstantTimeCompare([]byte(secretHash.String), []byte(s.hasher.Hash(secret))) == 1, nil
+}
+
+// LogOwnershipProofFailure records a failed ownership proof for the license, it changes nothing else
+func (s *Storage) LogOwnershipProofFailure(licenseId int64) error {
+	const op = "storage.sqlite.LogOwnershipProofFailure"
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if err := s.audit(tx, entry{
+		action:      "ownership_proof_failed",
+		licenseId:   licenseId,
+		description: fmt.Sprintf("action=ownership_proof_failed license_id=%d", licenseId),
+	}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+
+	return nil
+}
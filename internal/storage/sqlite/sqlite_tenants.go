@@ -0,0 +1,228 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dzhisl/license-manager/internal/storage"
+)
+
+// tenantColumns is the column list every tenant query selects, in scanTenant order
+const tenantColumns = `id, name, status, createdAt`
+
+// ForTenant returns a store that shares the database but only sees the tenant's data
+func (s *Storage) ForTenant(tenantId int64) storage.LicenseStore {
+	return s.forTenant(tenantId)
+}
+
+func (s *Storage) forTenant(tenantId int64) *Storage {
+	scoped := *s
+	scoped.tenantId = tenantId
+	return &scoped
+}
+
+// AddTenant inserts a new active tenant and returns its ID
+func (s *Storage) AddTenant(tenant *storage.Tenant) (int64, error) {
+	const op = "storage.sqlite.AddTenant"
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	res, err := tx.Exec(`INSERT INTO Tenants (name, status, createdAt) VALUES (?, ?, ?)`, tenant.Name, storage.TenantActive, now)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: failed to get last insert id: %w", op, err)
+	}
+
+	tenant.ID = id
+	tenant.Status = storage.TenantActive
+	tenant.CreatedAt = now
+
+	err = s.forTenant(id).audit(tx, entry{
+		action:      "add_tenant",
+		targetType:  storage.TargetTenant,
+		targetId:    id,
+		after:       map[string]any{"name": tenant.Name, "status": tenant.Status},
+		description: fmt.Sprintf("action=add_tenant tenant_id=%d name=%q", id, tenant.Name),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// GetTenantById retrieves a tenant by its ID
+func (s *Storage) GetTenantById(id int64) (*storage.Tenant, error) {
+	const op = "storage.sqlite.GetTenantById"
+
+	tenant, err := scanTenant(s.db.QueryRow(`SELECT `+tenantColumns+` FROM Tenants WHERE id = ?`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrTenantNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tenant, nil
+}
+
+// GetTenants lists every tenant
+func (s *Storage) GetTenants() ([]storage.Tenant, error) {
+	const op = "storage.sqlite.GetTenants"
+
+	rows, err := s.db.Query(`SELECT ` + tenantColumns + ` FROM Tenants ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var tenants []storage.Tenant
+	for rows.Next() {
+		tenant, err := scanTenant(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		tenants = append(tenants, *tenant)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tenants, nil
+}
+
+// SetTenantStatus suspends or resumes the tenant
+func (s *Storage) SetTenantStatus(id int64, status string) error {
+	const op = "storage.sqlite.SetTenantStatus"
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var old string
+	if err := tx.QueryRow(`SELECT status FROM Tenants WHERE id = ?`, id).Scan(&old); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%s: %w", op, storage.ErrTenantNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := tx.Exec(`UPDATE Tenants SET status = ? WHERE id = ?`, status, id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = s.forTenant(id).audit(tx, entry{
+		action:      "set_tenant_status",
+		targetType:  storage.TargetTenant,
+		targetId:    id,
+		before:      map[string]any{"status": old},
+		after:       map[string]any{"status": status},
+		description: fmt.Sprintf("action=set_tenant_status tenant_id=%d status=%s", id, status),
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: transaction commit failed: %w", op, err)
+	}
+
+	return nil
+}
+
+// tenant returns the tenant new licenses, products and API keys are created in
+func (s *Storage) tenant() int64 {
+	if s.tenantId == 0 {
+		return storage.DefaultTenantId
+	}
+	return s.tenantId
+}
+
+// scopedTenant returns the tenant of the store, nil for the store that sees every tenant
+func (s *Storage) scopedTenant() *int64 {
+	if s.tenantId == 0 {
+		return nil
+	}
+	return &s.tenantId
+}
+
+// tenantScope returns the condition limiting rows to the tenant of the store by their column,
+// always true for the store that sees every tenant.
+// The tenant ID is an integer, so it is written into the query as is.
+func (s *Storage) tenantScope(column string) string {
+	if s.tenantId == 0 {
+		return "1 = 1"
+	}
+	return fmt.Sprintf("%s = %d", column, s.tenantId)
+}
+
+// licenseScope returns the condition limiting rows to the licenses of the tenant by their license ID column
+func (s *Storage) licenseScope(column string) string {
+	if s.tenantId == 0 {
+		return "1 = 1"
+	}
+	return fmt.Sprintf("%s IN (SELECT id FROM UserLicense WHERE tenantId = %d)", column, s.tenantId)
+}
+
+// productScope returns the condition limiting rows to the products of the tenant by their product ID column
+func (s *Storage) productScope(column string) string {
+	if s.tenantId == 0 {
+		return "1 = 1"
+	}
+	return fmt.Sprintf("%s IN (SELECT id FROM Products WHERE tenantId = %d)", column, s.tenantId)
+}
+
+// checkLicense fails with ErrLicenseNotFound when the license belongs to another tenant,
+// it guards inserts that a scope in the query can't limit
+func (s *Storage) checkLicense(licenseId int64) error {
+	return s.checkOwned(`SELECT 1 FROM UserLicense WHERE id = ? AND `+s.tenantScope("tenantId"), licenseId, storage.ErrLicenseNotFound)
+}
+
+// checkProduct fails with ErrProductNotFound when the product belongs to another tenant
+func (s *Storage) checkProduct(productId int64) error {
+	return s.checkOwned(`SELECT 1 FROM Products WHERE id = ? AND `+s.tenantScope("tenantId"), productId, storage.ErrProductNotFound)
+}
+
+func (s *Storage) checkOwned(query string, id int64, notFound error) error {
+	if s.tenantId == 0 {
+		return nil
+	}
+
+	var found int
+	if err := s.db.QueryRow(query, id).Scan(&found); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return notFound
+		}
+		return err
+	}
+	return nil
+}
+
+// scanTenant reads a row selected with tenantColumns
+func scanTenant(row scanner) (*storage.Tenant, error) {
+	var tenant storage.Tenant
+
+	if err := row.Scan(&tenant.ID, &tenant.Name, &tenant.Status, &tenant.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	return &tenant, nil
+}
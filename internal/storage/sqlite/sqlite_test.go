@@ -0,0 +1,27 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/dzhisl/license-manager/internal/lib/licensekey"
+	"github.com/dzhisl/license-manager/internal/storage"
+	"github.com/dzhisl/license-manager/internal/storage/storagetest"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		s, err := New(filepath.Join(t.TempDir(), "storage.db"), licensekey.NewHasher("test", storagetest.KeyFormat))
+		if err != nil {
+			t.Fatal(err)
+		}
+		migrator, err := s.Migrator()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := migrator.Up(); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
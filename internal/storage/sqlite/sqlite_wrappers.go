@@ -1,25 +1,19 @@
 package sqlite
 
-func (s *Storage) GetLicenseById(userId string) (*UserLicense, error) {
-	return s.getLicense(`SELECT id, license, UserId, createdAt, updatedAt, expiresAt, hwid, status FROM UserLicense WHERE UserId = ?`, userId, "UserId")
-}
-
-func (s *Storage) GetLicenseByLicense(license string) (*UserLicense, error) {
-	return s.getLicense(`SELECT id, license, UserId, createdAt, updatedAt, expiresAt, hwid, status FROM UserLicense WHERE license = ?`, license, "License")
-}
+import "github.com/dzhisl/license-manager/internal/storage"
 
-func (s *Storage) BindHwidToLicenseByLicense(license, hwid string) error {
-	return s.updateHwid(license, hwid, "bind_hwid")
+func (s *Storage) GetLicenseById(id int64) (*storage.License, error) {
+	return s.getLicense(`SELECT `+licenseColumns+` FROM UserLicense WHERE id = ? AND `+s.tenantScope("tenantId"), id)
 }
 
-func (s *Storage) UnbindHwidFromLicense(license string) error {
-	return s.updateHwid(license, "", "unbind_hwid")
+func (s *Storage) GetLicenseByLicense(key string) (*storage.License, error) {
+	return s.getLicense(`SELECT `+licenseColumns+` FROM UserLicense WHERE keyHash = ? AND `+s.tenantScope("tenantId"), s.hasher.Hash(key))
 }
 
-func (s *Storage) FreezeLicenseById(userId string) error {
-	return s.updateLicenseStatus(userId, "frozen")
+func (s *Storage) FreezeLicenseById(id int64) error {
+	return s.updateLicenseStatus(id, "frozen")
 }
 
-func (s *Storage) UnfreezeLicenseById(userId string) error {
-	return s.updateLicenseStatus(userId, "active")
+func (s *Storage) UnfreezeLicenseById(id int64) error {
+	return s.updateLicenseStatus(id, "active")
 }
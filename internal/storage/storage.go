@@ -0,0 +1,345 @@
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dzhisl/license-manager/internal/lib/apikey"
+	"github.com/dzhisl/license-manager/internal/lib/fingerprint"
+	"github.com/dzhisl/license-manager/internal/lib/hwidreset"
+	"github.com/dzhisl/license-manager/internal/lib/renewal"
+	"github.com/dzhisl/license-manager/internal/lib/usage"
+	"github.com/dzhisl/license-manager/internal/storage/migrate"
+)
+
+var (
+	ErrLicenseNotFound = errors.New("license not found")
+	ErrLicenseExists   = errors.New("license already exists")
+	ErrProductNotFound = errors.New("product not found")
+	ErrProductExists   = errors.New("product already exists")
+
+	ErrActivationNotFound = errors.New("activation not found")
+	ErrActivationLimit    = errors.New("activation limit reached")
+	ErrResetLimit         = errors.New("hwid reset limit reached")
+
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionLimit    = errors.New("session limit reached")
+
+	ErrTrialUsed    = errors.New("machine already used a trial")
+	ErrNotRenewable = errors.New("license type can't be renewed")
+
+	ErrEntitlementNotFound = errors.New("entitlement not found")
+
+	ErrMeterNotFound = errors.New("meter not found")
+	ErrQuotaExceeded = errors.New("meter quota exceeded")
+
+	ErrTenantNotFound = errors.New("tenant not found")
+
+	ErrApiKeyNotFound = errors.New("api key not found")
+	ErrNonceUsed      = errors.New("nonce already used")
+)
+
+// DefaultTenantId is the tenant of the data created before tenants existed and of the root API key
+const DefaultTenantId = 1
+
+// Tenant statuses
+const (
+	TenantActive    = "active"
+	TenantSuspended = "suspended" // the API keys of the tenant stop working, its licenses keep working
+)
+
+// Tenant is a vendor whose licenses, products and API keys are kept apart from other vendors
+type Tenant struct {
+	ID        int64
+	Name      string
+	Status    string
+	CreatedAt time.Time
+}
+
+// Kinds of actors the transaction log records
+const (
+	ActorSystem = "system"  // background jobs and maintenance commands
+	ActorPublic = "public"  // end users on the public endpoints
+	ActorRoot   = "root"    // the root API key from the config
+	ActorApiKey = "api_key" // an API key from the database
+)
+
+// Kinds of records a transaction log entry can be about, besides its license
+const (
+	TargetLicense = "license"
+	TargetProduct = "product"
+	TargetApiKey  = "api_key"
+	TargetTenant  = "tenant"
+)
+
+// Actor is who made a change, the transaction log records it with the change
+type Actor struct {
+	Kind      string // empty is ActorSystem
+	ApiKeyId  int64  // set for ActorApiKey
+	IP        string
+	RequestId string
+}
+
+// License types
+const (
+	TypeSubscription = "subscription" // expires and can be renewed
+	TypeTrial        = "trial"        // expires, can't be renewed and is limited to one per machine and product
+	TypePerpetual    = "perpetual"    // never expires, UpdatesUntil may limit the releases it covers
+)
+
+// License is the backend-neutral representation of a user license.
+// The key itself is only stored as a keyed hash, DisplayPrefix is safe to show.
+type License struct {
+	ID            int64
+	TenantId      int64
+	DisplayPrefix string
+	UserId        string
+	ProductId     *int64
+	Type          string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	ExpiresAt     *time.Time // nil for perpetual licenses
+	// UpdatesUntil is the last release date a perpetual license covers, nil means every release
+	UpdatesUntil *time.Time
+	Status       string
+	// MaxActivations is how many machines may use the license at once
+	MaxActivations int
+	// MaxSessions is how many floating sessions may be checked out at once
+	MaxSessions int
+}
+
+// Activation is a machine a license is in use on
+type Activation struct {
+	ID        int64
+	LicenseId int64
+	HWID      string
+	Label     string
+	// Fingerprint is the latest hardware fingerprint the machine sent, nil if it never sent one
+	Fingerprint fingerprint.Fingerprint
+	FirstSeen   time.Time
+	LastSeen    time.Time
+}
+
+// HwidReset is a machine the owner of a license unbound themselves
+type HwidReset struct {
+	ID        int64
+	LicenseId int64
+	HWID      string
+	CreatedAt time.Time
+}
+
+// Session is a checked out seat of a floating license, kept alive by heartbeats.
+// The session token is only stored as a keyed hash.
+type Session struct {
+	ID            int64
+	LicenseId     int64
+	HWID          string
+	StartedAt     time.Time
+	LastHeartbeat time.Time
+	ExpiresAt     time.Time
+}
+
+// Renewal is an entry of the renewal history of a license
+type Renewal struct {
+	ID           int64
+	LicenseId    int64
+	Mode         renewal.Mode
+	OldExpiresAt time.Time
+	NewExpiresAt time.Time
+	CreatedAt    time.Time
+}
+
+// Entitlement is a named feature, Limit optionally caps how much of it may be used (nil means unlimited)
+type Entitlement struct {
+	Feature string
+	Limit   *int64
+}
+
+// EntitlementOverride changes a product entitlement for a single license, or grants one the
+// product doesn't have. A disabled override takes the feature away from the license.
+type EntitlementOverride struct {
+	Feature string
+	Limit   *int64
+	Enabled bool
+}
+
+// Meter counts how much of something a license used in the current period, up to Quota
+type Meter struct {
+	ID          int64
+	LicenseId   int64
+	Name        string
+	Quota       int64
+	Period      usage.Period
+	Used        int64
+	PeriodStart time.Time
+}
+
+// MeterIncrement is the outcome of counting usage on a meter
+type MeterIncrement struct {
+	Meter Meter
+	// Replayed is set when the idempotency key was seen before, nothing was counted again
+	Replayed bool
+}
+
+// ApiKey grants access to the admin API within the scopes of its role and its own scopes.
+// The key itself is only stored as a keyed hash, DisplayPrefix is safe to show.
+type ApiKey struct {
+	ID            int64
+	TenantId      int64
+	Name          string
+	DisplayPrefix string
+	Role          apikey.Role // empty when the key only has its own scopes
+	Scopes        []string
+	CreatedAt     time.Time
+	ExpiresAt     *time.Time // never expires if nil
+	LastUsedAt    *time.Time
+	RevokedAt     *time.Time
+	// SigningSecret is sealed with the server secret, keys that have one only accept signed requests
+	SigningSecret string
+}
+
+// Product is something we sell licenses for
+type Product struct {
+	ID        int64
+	TenantId  int64
+	Code      string // unique per tenant
+	Name      string
+	KeyPrefix string // prefix for license keys of this product, empty means the configured default
+	// GraceDays is how long licenses keep working after they expire, nil means the configured default
+	GraceDays *int
+	CreatedAt time.Time
+}
+
+// LicenseStore defines everything the HTTP layer needs from a storage backend.
+// A store returned by ForTenant only sees the licenses, products and API keys of its tenant and
+// creates new ones in it, the others behave as if they don't exist. The store a backend is opened
+// as sees every tenant, it serves the public endpoints, the background jobs and the super admin.
+// Every change is recorded in the transaction log, in the same database transaction, together
+// with the actor set by As, ActorSystem by default.
+type LicenseStore interface {
+	// ForTenant returns the store scoped to the tenant
+	ForTenant(tenantId int64) LicenseStore
+	// As returns the store that records actor as who made its changes
+	As(actor Actor) LicenseStore
+	AddTenant(tenant *Tenant) (int64, error)
+	GetTenantById(id int64) (*Tenant, error)
+	GetTenants() ([]Tenant, error)
+	SetTenantStatus(id int64, status string) error
+
+	// AddLicense stores the license under the hash of key, with the hash of the secret that proves
+	// ownership of it, and returns its ID. DisplayPrefix and CreatedAt/UpdatedAt are set by the store.
+	AddLicense(license *License, key, secret string) (int64, error)
+	GetLicenseById(id int64) (*License, error)
+	GetLicenseByLicense(key string) (*License, error)
+	GetLicensesByUserId(userId string) ([]License, error)
+	GetAllLicenses() ([]License, error)
+	DeleteLicenseById(id int64) error
+	// RenewLicenseById moves the expiry date of the license as described by plan and records
+	// the renewal in its history. An expired license whose new expiry date is in the future
+	// becomes active again. Trial and perpetual licenses fail with ErrNotRenewable.
+	RenewLicenseById(id int64, plan renewal.Plan) (*Renewal, error)
+	GetRenewals(licenseId int64) ([]Renewal, error)
+	// ExpireLicenses moves active licenses whose grace period ended before now to the "expired"
+	// status and returns their IDs. Licenses keep their status during the grace period of
+	// their product, or defaultGraceDays for licenses without one.
+	ExpireLicenses(now time.Time, defaultGraceDays int) ([]int64, error)
+	SetMaxActivations(id int64, max int) error
+	SetMaxSessions(id int64, max int) error
+	FreezeLicenseById(id int64) error
+	UnfreezeLicenseById(id int64) error
+	// ResetLicenseSecret replaces the secret that proves ownership of the license
+	ResetLicenseSecret(id int64, secret string) error
+	// CheckLicenseSecret reports whether secret is the one of the license, licenses created
+	// before secrets existed have none until it is reset
+	CheckLicenseSecret(id int64, secret string) (bool, error)
+	// LogOwnershipProofFailure records a failed ownership proof for the license in the transaction log
+	LogOwnershipProofFailure(licenseId int64) error
+
+	// ActivateMachine records that the license is used on hwid, refreshing LastSeen (and Label
+	// when not empty) for a known machine. A machine with an unknown hwid whose fingerprint fp
+	// matches a known one under policy is the same machine, it takes over the new hwid.
+	// The stored fingerprint follows fp when one is given.
+	// A new machine fails with ErrActivationLimit once the license has MaxActivations machines.
+	// A trial license fails with ErrTrialUsed on a machine that already had a trial of the same product.
+	// proof is how the owner proved they own the license for the transaction log, empty when they didn't have to.
+	ActivateMachine(licenseId int64, hwid, label string, fp fingerprint.Fingerprint, policy fingerprint.Policy, proof string) (*Activation, error)
+	GetActivations(licenseId int64) ([]Activation, error)
+	DeactivateMachine(licenseId int64, hwid string) error
+	// ResetMachine frees the seat hwid takes on the license on behalf of its owner and records
+	// the reset. It fails with ErrResetLimit, freeing nothing, when policy allows no reset at now.
+	// next is when the following reset is allowed, or on ErrResetLimit when this one would be.
+	// proof is how the owner proved they own the license for the transaction log.
+	ResetMachine(licenseId int64, hwid string, policy hwidreset.Policy, now time.Time, proof string) (next time.Time, err error)
+	GetHwidResets(licenseId int64) ([]HwidReset, error)
+
+	// OpenSession stores a session under the hash of token and returns its ID, it fails
+	// with ErrSessionLimit when the license already has MaxSessions unexpired sessions
+	OpenSession(session *Session, token string) (int64, error)
+	GetSessionByToken(token string) (*Session, error)
+	// HeartbeatSession extends an unexpired session until expiresAt
+	HeartbeatSession(token string, expiresAt time.Time) (*Session, error)
+	CloseSession(token string) error
+	GetSessions(licenseId int64) ([]Session, error)
+	// ReapSessions deletes the sessions that expired before now and returns how many there were
+	ReapSessions(now time.Time) (int, error)
+
+	// AddProduct stores the product and returns its ID, CreatedAt is set by the store
+	AddProduct(product *Product) (int64, error)
+	SetProductGraceDays(id int64, days *int) error
+	GetProductByCode(code string) (*Product, error)
+	GetProductById(id int64) (*Product, error)
+	GetAllProducts() ([]Product, error)
+
+	// SetProductEntitlement adds the feature to the product or changes its limit
+	SetProductEntitlement(productId int64, entitlement Entitlement) error
+	RemoveProductEntitlement(productId int64, feature string) error
+	GetProductEntitlements(productId int64) ([]Entitlement, error)
+	// SetLicenseEntitlement adds or replaces the override of a feature on the license
+	SetLicenseEntitlement(licenseId int64, override EntitlementOverride) error
+	RemoveLicenseEntitlement(licenseId int64, feature string) error
+	GetLicenseEntitlements(licenseId int64) ([]EntitlementOverride, error)
+
+	// SetMeter creates the meter of the license or changes its quota and period,
+	// changing the period starts the usage over. Used and PeriodStart are set by the store.
+	SetMeter(meter *Meter) error
+	RemoveMeter(licenseId int64, name string) error
+	// GetMeters returns the meters of the license as of now, meters whose period
+	// ended before now are returned with no usage
+	GetMeters(licenseId int64, now time.Time) ([]Meter, error)
+	// IncrementMeter counts amount on the meter unless idempotencyKey was used on it before,
+	// starting the usage over first if its period ended. It fails with ErrQuotaExceeded when
+	// the usage would go past the quota, without counting anything.
+	IncrementMeter(licenseId int64, name string, amount int64, idempotencyKey string, now time.Time) (*MeterIncrement, error)
+
+	// AddApiKey stores the API key under the hash of key and returns its ID,
+	// DisplayPrefix and CreatedAt are set by the store
+	AddApiKey(apiKey *ApiKey, key string) (int64, error)
+	// GetApiKeyByKey looks an API key up by the hash of key, revoked and expired keys included
+	GetApiKeyByKey(key string) (*ApiKey, error)
+	GetApiKeyById(id int64) (*ApiKey, error)
+	GetApiKeys() ([]ApiKey, error)
+	// RevokeApiKey stops the API key from working, revoking it again keeps the first RevokedAt
+	RevokeApiKey(id int64) error
+	SetApiKeyRole(id int64, role apikey.Role) error
+	TouchApiKey(id int64, now time.Time) error
+	// SetApiKeySigningSecret replaces the sealed signing secret of the API key
+	SetApiKeySigningSecret(id int64, sealedSecret string) error
+	// UseNonce records the nonce of a signed request until expiresAt,
+	// it fails with ErrNonceUsed when the API key sent the nonce before
+	UseNonce(apiKeyId int64, nonce string, expiresAt time.Time) error
+	// PruneNonces deletes the nonces that expired before now and returns how many there were
+	PruneNonces(now time.Time) (int, error)
+}
+
+// Store is a LicenseStore backed by a database whose schema is managed by migrations
+type Store interface {
+	LicenseStore
+	Migrator() (*migrate.Migrator, error)
+	// HashPlaintextKeys hashes keys left in plaintext by databases created before
+	// keys were hashed at rest, it returns how many licenses were converted
+	HashPlaintextKeys() (int, error)
+	// ShortenDisplayPrefixes cuts display prefixes stored when they showed two parts of the key
+	// down to what is shown now, it returns how many licenses were changed
+	ShortenDisplayPrefixes() (int, error)
+	Close() error
+}
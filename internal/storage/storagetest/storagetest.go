@@ -0,0 +1,495 @@
+// Package storagetest is the test suite every storage backend has to pass, so the backends
+// keep the same semantics
+package storagetest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/dzhisl/license-manager/internal/lib/apikey"
+	"github.com/dzhisl/license-manager/internal/lib/fingerprint"
+	"github.com/dzhisl/license-manager/internal/lib/hwidreset"
+	"github.com/dzhisl/license-manager/internal/lib/licensekey"
+	"github.com/dzhisl/license-manager/internal/lib/renewal"
+	"github.com/dzhisl/license-manager/internal/lib/usage"
+	"github.com/dzhisl/license-manager/internal/storage"
+)
+
+// KeyFormat is the license key format the store under test hashes keys for
+var KeyFormat = licensekey.Format{Prefix: "LIC", Groups: 3, GroupSize: 5}
+
+// Run runs the suite, open returns a store on a new, migrated database for every test
+func Run(t *testing.T, open func(t *testing.T) storage.Store) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s storage.Store)
+	}{
+		{"Licenses", testLicenses},
+		{"Status", testStatus},
+		{"Secrets", testSecrets},
+		{"Renewals", testRenewals},
+		{"Expiry", testExpiry},
+		{"Activations", testActivations},
+		{"Sessions", testSessions},
+		{"Products", testProducts},
+		{"Meters", testMeters},
+		{"Tenants", testTenants},
+		{"Nonces", testNonces},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := open(t)
+			t.Cleanup(func() { s.Close() })
+			tt.run(t, s)
+		})
+	}
+}
+
+// addLicense adds an active subscription of userId expiring at expiresAt under key
+func addLicense(t *testing.T, s storage.LicenseStore, userId, key string, expiresAt time.Time) int64 {
+	t.Helper()
+
+	id, err := s.AddLicense(&storage.License{
+		UserId:         userId,
+		Type:           storage.TypeSubscription,
+		Status:         "active",
+		ExpiresAt:      &expiresAt,
+		MaxActivations: 1,
+		MaxSessions:    1,
+	}, key, "secret-"+key)
+	if err != nil {
+		t.Fatalf("AddLicense: %v", err)
+	}
+	return id
+}
+
+// wantErr fails the test unless err is target
+func wantErr(t *testing.T, err, target error) {
+	t.Helper()
+
+	if !errors.Is(err, target) {
+		t.Fatalf("got error %v, want %v", err, target)
+	}
+}
+
+// date returns midnight UTC of the day, whole seconds compare equal on every backend
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func testLicenses(t *testing.T, s storage.Store) {
+	expiresAt := date(2040, time.January, 31)
+	id := addLicense(t, s, "alice", "LIC-AAAAA-BBBBB-CCCCC-1", expiresAt)
+
+	license, err := s.GetLicenseById(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if license.UserId != "alice" || license.Status != "active" || license.TenantId != storage.DefaultTenantId {
+		t.Errorf("got %+v", license)
+	}
+	if license.ExpiresAt == nil || !license.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("expires at %v, want %v", license.ExpiresAt, expiresAt)
+	}
+	if license.DisplayPrefix != "LIC-AAA" {
+		t.Errorf("display prefix %q", license.DisplayPrefix)
+	}
+
+	byKey, err := s.GetLicenseByLicense("LIC-AAAAA-BBBBB-CCCCC-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byKey.ID != id {
+		t.Errorf("found license %d by key, want %d", byKey.ID, id)
+	}
+	_, err = s.GetLicenseByLicense("LIC-AAAAA-BBBBB-CCCCC-2")
+	wantErr(t, err, storage.ErrLicenseNotFound)
+
+	_, err = s.AddLicense(&storage.License{UserId: "bob", Type: storage.TypeSubscription, Status: "active", ExpiresAt: &expiresAt}, "LIC-AAAAA-BBBBB-CCCCC-1", "")
+	wantErr(t, err, storage.ErrLicenseExists)
+
+	addLicense(t, s, "alice", "LIC-DDDDD-EEEEE-FFFFF-1", expiresAt)
+	licenses, err := s.GetLicensesByUserId("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(licenses) != 2 {
+		t.Errorf("got %d licenses of alice, want 2", len(licenses))
+	}
+
+	if err := s.DeleteLicenseById(id); err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.GetLicenseById(id)
+	wantErr(t, err, storage.ErrLicenseNotFound)
+	wantErr(t, s.DeleteLicenseById(id), storage.ErrLicenseNotFound)
+}
+
+func testStatus(t *testing.T, s storage.Store) {
+	id := addLicense(t, s, "alice", "LIC-STATUS", date(2040, time.January, 1))
+
+	if err := s.FreezeLicenseById(id); err != nil {
+		t.Fatal(err)
+	}
+	if license, _ := s.GetLicenseById(id); license.Status != "frozen" {
+		t.Errorf("status %q after freezing", license.Status)
+	}
+	if err := s.UnfreezeLicenseById(id); err != nil {
+		t.Fatal(err)
+	}
+	if license, _ := s.GetLicenseById(id); license.Status != "active" {
+		t.Errorf("status %q after unfreezing", license.Status)
+	}
+
+	if err := s.SetMaxActivations(id, 3); err != nil {
+		t.Fatal(err)
+	}
+	if license, _ := s.GetLicenseById(id); license.MaxActivations != 3 {
+		t.Errorf("max activations %d, want 3", license.MaxActivations)
+	}
+
+	wantErr(t, s.FreezeLicenseById(id+1), storage.ErrLicenseNotFound)
+}
+
+func testSecrets(t *testing.T, s storage.Store) {
+	id := addLicense(t, s, "alice", "LIC-SECRET", date(2040, time.January, 1))
+
+	for _, tt := range []struct {
+		secret string
+		want   bool
+	}{
+		{"secret-LIC-SECRET", true},
+		{"secret-LIC-OTHER", false},
+		{"", false},
+	} {
+		got, err := s.CheckLicenseSecret(id, tt.secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("CheckLicenseSecret(%q) = %t, want %t", tt.secret, got, tt.want)
+		}
+	}
+
+	if err := s.ResetLicenseSecret(id, "new"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := s.CheckLicenseSecret(id, "secret-LIC-SECRET"); ok {
+		t.Error("the old secret still works after a reset")
+	}
+	if ok, _ := s.CheckLicenseSecret(id, "new"); !ok {
+		t.Error("the new secret doesn't work")
+	}
+
+	if err := s.LogOwnershipProofFailure(id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testRenewals(t *testing.T, s storage.Store) {
+	id := addLicense(t, s, "alice", "LIC-RENEW", date(2040, time.January, 31))
+
+	renewed, err := s.RenewLicenseById(id, renewal.Plan{Mode: renewal.FromExpiry, Term: renewal.Term{Months: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := date(2040, time.February, 29); !renewed.NewExpiresAt.Equal(want) {
+		t.Errorf("renewed until %v, want %v", renewed.NewExpiresAt, want)
+	}
+
+	renewals, err := s.GetRenewals(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(renewals) != 1 || renewals[0].Mode != renewal.FromExpiry {
+		t.Errorf("got renewals %+v", renewals)
+	}
+
+	trialExpiresAt := date(2040, time.January, 1)
+	trialId, err := s.AddLicense(&storage.License{UserId: "bob", Type: storage.TypeTrial, Status: "active", ExpiresAt: &trialExpiresAt, MaxActivations: 1}, "LIC-TRIAL", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.RenewLicenseById(trialId, renewal.Plan{Mode: renewal.FromExpiry, Term: renewal.Term{Days: 1}})
+	wantErr(t, err, storage.ErrNotRenewable)
+
+	_, err = s.RenewLicenseById(trialId+1, renewal.Plan{Mode: renewal.FromExpiry, Term: renewal.Term{Days: 1}})
+	wantErr(t, err, storage.ErrLicenseNotFound)
+}
+
+func testExpiry(t *testing.T, s storage.Store) {
+	expiresAt := date(2040, time.March, 10)
+	id := addLicense(t, s, "alice", "LIC-EXPIRY", expiresAt)
+	graceDays := 5
+	productId, err := s.AddProduct(&storage.Product{Code: "GRACE", Name: "Grace", GraceDays: &graceDays})
+	if err != nil {
+		t.Fatal(err)
+	}
+	graced, err := s.AddLicense(&storage.License{UserId: "bob", ProductId: &productId, Type: storage.TypeSubscription, Status: "active", ExpiresAt: &expiresAt}, "LIC-GRACE", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired, err := s.ExpireLicenses(expiresAt.AddDate(0, 0, 1), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 0 {
+		t.Errorf("expired %v during the grace period", expired)
+	}
+
+	now := expiresAt.AddDate(0, 0, 3)
+	expired, err = s.ExpireLicenses(now, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 1 || expired[0] != id {
+		t.Errorf("expired %v, want [%d]", expired, id)
+	}
+	license, _ := s.GetLicenseById(id)
+	if license.Status != "expired" || !license.UpdatedAt.Equal(now) {
+		t.Errorf("got status %q updated at %v, want expired at %v", license.Status, license.UpdatedAt, now)
+	}
+
+	expired, err = s.ExpireLicenses(expiresAt.AddDate(0, 0, 6), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 1 || expired[0] != graced {
+		t.Errorf("expired %v, want the license of the product with a longer grace period [%d]", expired, graced)
+	}
+}
+
+func testActivations(t *testing.T, s storage.Store) {
+	id := addLicense(t, s, "alice", "LIC-ACTIVATE", date(2040, time.January, 1))
+	policy := fingerprint.Policy{Threshold: 0.5}
+
+	if _, err := s.ActivateMachine(id, "hwid-1", "laptop", nil, policy, ""); err != nil {
+		t.Fatal(err)
+	}
+	// Activating a known machine again only refreshes it
+	if _, err := s.ActivateMachine(id, "hwid-1", "", nil, policy, ""); err != nil {
+		t.Fatal(err)
+	}
+	_, err := s.ActivateMachine(id, "hwid-2", "", nil, policy, "")
+	wantErr(t, err, storage.ErrActivationLimit)
+
+	activations, err := s.GetActivations(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(activations) != 1 || activations[0].HWID != "hwid-1" || activations[0].Label != "laptop" {
+		t.Errorf("got activations %+v", activations)
+	}
+
+	resets := hwidreset.Policy{Limit: 1, Window: 24 * time.Hour}
+	now := time.Now()
+	if _, err := s.ResetMachine(id, "hwid-1", resets, now, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ActivateMachine(id, "hwid-2", "", nil, policy, ""); err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.ResetMachine(id, "hwid-2", resets, now.Add(time.Hour), "secret")
+	wantErr(t, err, storage.ErrResetLimit)
+
+	if err := s.DeactivateMachine(id, "hwid-2"); err != nil {
+		t.Fatal(err)
+	}
+	wantErr(t, s.DeactivateMachine(id, "hwid-2"), storage.ErrActivationNotFound)
+}
+
+func testSessions(t *testing.T, s storage.Store) {
+	id := addLicense(t, s, "alice", "LIC-SESSION", date(2040, time.January, 1))
+	now := time.Now()
+
+	_, err := s.OpenSession(&storage.Session{LicenseId: id, HWID: "hwid-1", ExpiresAt: now.Add(time.Minute)}, "token-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.OpenSession(&storage.Session{LicenseId: id, HWID: "hwid-2", ExpiresAt: now.Add(time.Minute)}, "token-2")
+	wantErr(t, err, storage.ErrSessionLimit)
+
+	session, err := s.HeartbeatSession("token-1", now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.HWID != "hwid-1" {
+		t.Errorf("heartbeat of session %+v", session)
+	}
+	if err := s.CloseSession("token-1"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.GetSessionByToken("token-1")
+	wantErr(t, err, storage.ErrSessionNotFound)
+
+	// An expired session doesn't hold its seat, even before the reaper runs
+	_, err = s.OpenSession(&storage.Session{LicenseId: id, HWID: "hwid-1", ExpiresAt: now.Add(-time.Minute)}, "token-3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.OpenSession(&storage.Session{LicenseId: id, HWID: "hwid-2", ExpiresAt: now.Add(time.Minute)}, "token-4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reaped, err := s.ReapSessions(now.Add(2 * time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reaped != 1 {
+		t.Errorf("reaped %d sessions, want 1", reaped)
+	}
+}
+
+func testProducts(t *testing.T, s storage.Store) {
+	id, err := s.AddProduct(&storage.Product{Code: "APP", Name: "App", KeyPrefix: "APP"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.AddProduct(&storage.Product{Code: "APP", Name: "Other"})
+	wantErr(t, err, storage.ErrProductExists)
+
+	product, err := s.GetProductByCode("APP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if product.ID != id || product.KeyPrefix != "APP" || product.GraceDays != nil {
+		t.Errorf("got %+v", product)
+	}
+
+	days := 7
+	if err := s.SetProductGraceDays(id, &days); err != nil {
+		t.Fatal(err)
+	}
+	if product, _ := s.GetProductById(id); product.GraceDays == nil || *product.GraceDays != 7 {
+		t.Errorf("grace days %v, want 7", product.GraceDays)
+	}
+
+	_, err = s.GetProductByCode("NOPE")
+	wantErr(t, err, storage.ErrProductNotFound)
+}
+
+func testMeters(t *testing.T, s storage.Store) {
+	id := addLicense(t, s, "alice", "LIC-METER", date(2040, time.January, 1))
+	if err := s.SetMeter(&storage.Meter{LicenseId: id, Name: "api", Quota: 3, Period: usage.Month}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	increment, err := s.IncrementMeter(id, "api", 2, "a", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if increment.Meter.Used != 2 || increment.Replayed {
+		t.Errorf("got %+v", increment)
+	}
+	increment, err = s.IncrementMeter(id, "api", 2, "a", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if increment.Meter.Used != 2 || !increment.Replayed {
+		t.Errorf("replaying the idempotency key gave %+v", increment)
+	}
+	_, err = s.IncrementMeter(id, "api", 2, "b", now)
+	wantErr(t, err, storage.ErrQuotaExceeded)
+	// An amount that overflows the usage is past the quota too
+	_, err = s.IncrementMeter(id, "api", math.MaxInt64, "b", now)
+	wantErr(t, err, storage.ErrQuotaExceeded)
+
+	// The next period starts the usage over
+	increment, err = s.IncrementMeter(id, "api", 2, "c", now.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if increment.Meter.Used != 2 {
+		t.Errorf("used %d in the next period, want 2", increment.Meter.Used)
+	}
+	// The reset pruned the events of the finished period, their keys count again
+	increment, err = s.IncrementMeter(id, "api", 1, "a", now.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if increment.Meter.Used != 3 || increment.Replayed {
+		t.Errorf("a key of the finished period gave %+v", increment)
+	}
+
+	_, err = s.IncrementMeter(id, "other", 1, "d", now)
+	wantErr(t, err, storage.ErrMeterNotFound)
+}
+
+func testTenants(t *testing.T, s storage.Store) {
+	tenantId, err := s.AddTenant(&storage.Tenant{Name: "Acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	acme := s.ForTenant(tenantId)
+	home := s.ForTenant(storage.DefaultTenantId)
+
+	id := addLicense(t, acme, "alice", "LIC-TENANT", date(2040, time.January, 1))
+	if license, err := acme.GetLicenseById(id); err != nil || license.TenantId != tenantId {
+		t.Fatalf("got %+v, %v from the tenant of the license", license, err)
+	}
+	_, err = home.GetLicenseById(id)
+	wantErr(t, err, storage.ErrLicenseNotFound)
+	wantErr(t, home.FreezeLicenseById(id), storage.ErrLicenseNotFound)
+
+	// Product codes are unique per tenant
+	if _, err := acme.AddProduct(&storage.Product{Code: "APP", Name: "App"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := home.AddProduct(&storage.Product{Code: "APP", Name: "App"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A machine gets one trial per tenant
+	expiresAt := date(2040, time.January, 1)
+	for i, tenant := range []storage.LicenseStore{acme, home} {
+		first, err := tenant.AddLicense(&storage.License{UserId: "bob", Type: storage.TypeTrial, Status: "active", ExpiresAt: &expiresAt, MaxActivations: 1}, fmt.Sprintf("LIC-TRIAL-%d-1", i), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := tenant.AddLicense(&storage.License{UserId: "bob", Type: storage.TypeTrial, Status: "active", ExpiresAt: &expiresAt, MaxActivations: 1}, fmt.Sprintf("LIC-TRIAL-%d-2", i), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tenant.ActivateMachine(first, "trial-machine", "", nil, fingerprint.Policy{}, ""); err != nil {
+			t.Fatalf("first trial of the tenant: %v", err)
+		}
+		_, err = tenant.ActivateMachine(second, "trial-machine", "", nil, fingerprint.Policy{}, "")
+		wantErr(t, err, storage.ErrTrialUsed)
+	}
+
+	// The store that sees every tenant finds the license too
+	if _, err := s.GetLicenseById(id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testNonces(t *testing.T, s storage.Store) {
+	now := date(2040, time.January, 1)
+	keyId, err := s.AddApiKey(&storage.ApiKey{Name: "signer", Role: apikey.Support}, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.UseNonce(keyId, "nonce", now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	// A replayed request is rejected
+	wantErr(t, s.UseNonce(keyId, "nonce", now.Add(time.Minute)), storage.ErrNonceUsed)
+	if err := s.UseNonce(keyId, "other", now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	pruned, err := s.PruneNonces(now.Add(2 * time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 2 {
+		t.Errorf("pruned %d nonces, want 2", pruned)
+	}
+}
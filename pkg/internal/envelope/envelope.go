@@ -0,0 +1,60 @@
+// Package envelope implements the compact signed token format shared by license
+// files and leases: "<header>.<base64url JSON payload>.<base64url Ed25519 signature>",
+// where the signature covers "<header>.<payload>".
+package envelope
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+var (
+	ErrMalformed    = errors.New("malformed token")
+	ErrWrongHeader  = errors.New("unexpected token header")
+	ErrBadSignature = errors.New("signature verification failed")
+)
+
+// Seal encodes v as JSON and signs it under header
+func Seal(header string, v any, key ed25519.PrivateKey) (string, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	signed := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature := ed25519.Sign(key, []byte(signed))
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Open verifies a token sealed under header and decodes its payload into v
+func Open(token, header string, publicKey ed25519.PublicKey, v any) error {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return ErrMalformed
+	}
+	if parts[0] != header {
+		return ErrWrongHeader
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return ErrMalformed
+	}
+	if len(publicKey) != ed25519.PublicKeySize || !ed25519.Verify(publicKey, []byte(parts[0]+"."+parts[1]), signature) {
+		return ErrBadSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return ErrMalformed
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		return ErrMalformed
+	}
+
+	return nil
+}
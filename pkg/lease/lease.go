@@ -0,0 +1,91 @@
+// Package lease issues and verifies short-lived offline leases.
+//
+// A successful /validate-license call made with "lease": true returns a lease token
+// bound to the license key and HWID. The token holds the SHA-256 hash of the key, not the key.
+// Clients store it and, while offline, accept it instead of an online validation until it expires:
+//
+//	claims, err := lease.Verify(token, publicKey)
+//	if err == nil {
+//		err = claims.Check(key, hwid, time.Now())
+//	}
+//
+// Every successful online validation returns a fresh lease, so the offline window
+// restarts whenever the client can reach the server. A lease never outlives the license.
+//
+// A lease token is "LT1.<payload>.<signature>", encoded the same way as license files.
+package lease
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dzhisl/license-manager/pkg/internal/envelope"
+)
+
+// header identifies the format and version of a lease token
+const header = "LT1"
+
+var (
+	ErrMalformed    = errors.New("lease: malformed lease token")
+	ErrBadSignature = errors.New("lease: signature verification failed")
+	ErrMismatch     = errors.New("lease: lease was issued for a different license or machine")
+	ErrExpired      = errors.New("lease: lease expired")
+	ErrNotYetValid  = errors.New("lease: lease issued in the future")
+)
+
+// Claims is the signed content of a lease token
+type Claims struct {
+	// KeyHash is the KeyHash of the license key the lease was issued for
+	KeyHash   string    `json:"key_hash"`
+	LicenseId int64     `json:"license_id"`
+	HWID      string    `json:"hwid"`
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// KeyHash returns the hex encoded SHA-256 hash of a license key, how a lease names it
+func KeyHash(license string) string {
+	sum := sha256.Sum256([]byte(license))
+	return hex.EncodeToString(sum[:])
+}
+
+// Issue signs claims with the server's private key
+func Issue(claims Claims, key ed25519.PrivateKey) (string, error) {
+	token, err := envelope.Seal(header, claims, key)
+	if err != nil {
+		return "", fmt.Errorf("lease: %w", err)
+	}
+	return token, nil
+}
+
+// Verify checks the signature of a lease token and returns its claims.
+// It does not check expiry or binding, use Claims.Check for that.
+func Verify(token string, publicKey ed25519.PublicKey) (*Claims, error) {
+	var claims Claims
+	switch err := envelope.Open(token, header, publicKey, &claims); {
+	case errors.Is(err, envelope.ErrBadSignature):
+		return nil, ErrBadSignature
+	case err != nil:
+		return nil, ErrMalformed
+	}
+	return &claims, nil
+}
+
+// Check reports whether the lease lets license run on the machine with the given HWID at time now.
+// A clock set before the issue time is rejected so winding it back can't extend a lease forever.
+func (c *Claims) Check(license, hwid string, now time.Time) error {
+	if c.KeyHash != KeyHash(license) || c.HWID != hwid {
+		return ErrMismatch
+	}
+	if now.Before(c.IssuedAt) {
+		return ErrNotYetValid
+	}
+	if !now.Before(c.ExpiresAt) {
+		return ErrExpired
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package lease
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return publicKey, privateKey
+}
+
+const testKey = "LIC-ABCDE-FGHJK-LMNPQ-5"
+
+var issuedAt = time.Date(2030, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+func testClaims() Claims {
+	return Claims{
+		KeyHash:   KeyHash(testKey),
+		LicenseId: 7,
+		HWID:      "machine",
+		IssuedAt:  issuedAt,
+		ExpiresAt: issuedAt.Add(72 * time.Hour),
+	}
+}
+
+func TestIssueVerify(t *testing.T) {
+	publicKey, privateKey := newKey(t)
+
+	token, err := Issue(testClaims(), privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(token, testKey) {
+		t.Fatal("the token contains the license key")
+	}
+	payload, _ := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[1])
+	if strings.Contains(string(payload), testKey) {
+		t.Fatal("the payload contains the license key")
+	}
+
+	claims, err := Verify(token, publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.KeyHash != KeyHash(testKey) || claims.LicenseId != 7 || claims.HWID != "machine" || !claims.ExpiresAt.Equal(issuedAt.Add(72*time.Hour)) {
+		t.Errorf("got %+v", claims)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	publicKey, privateKey := newKey(t)
+	otherPublicKey, _ := newKey(t)
+
+	token, err := Issue(testClaims(), privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, ".")
+
+	extended := testClaims()
+	extended.ExpiresAt = extended.ExpiresAt.AddDate(1, 0, 0)
+	extendedToken, err := Issue(extended, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	extendedPayload := strings.Split(extendedToken, ".")[1]
+
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	signature[0] ^= 1
+
+	tests := []struct {
+		name      string
+		token     string
+		publicKey ed25519.PublicKey
+		want      error
+	}{
+		{"wrong key", token, otherPublicKey, ErrBadSignature},
+		{"tampered payload", parts[0] + "." + extendedPayload + "." + parts[2], publicKey, ErrBadSignature},
+		{"tampered signature", parts[0] + "." + parts[1] + "." + base64.RawURLEncoding.EncodeToString(signature), publicKey, ErrBadSignature},
+		{"license file header", "LF1." + parts[1] + "." + parts[2], publicKey, ErrMalformed},
+		{"missing signature", parts[0] + "." + parts[1], publicKey, ErrMalformed},
+		{"signature not base64", parts[0] + "." + parts[1] + ".!!!", publicKey, ErrMalformed},
+		{"empty", "", publicKey, ErrMalformed},
+		{"truncated public key", token, publicKey[:16], ErrBadSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Verify(tt.token, tt.publicKey); !errors.Is(err, tt.want) {
+				t.Errorf("Verify() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	claims := testClaims()
+
+	tests := []struct {
+		name    string
+		license string
+		hwid    string
+		now     time.Time
+		want    error
+	}{
+		{"valid", testKey, "machine", issuedAt.Add(time.Hour), nil},
+		{"at issue", testKey, "machine", issuedAt, nil},
+		{"at expiry", testKey, "machine", claims.ExpiresAt, ErrExpired},
+		{"expired", testKey, "machine", claims.ExpiresAt.Add(time.Hour), ErrExpired},
+		{"clock wound back", testKey, "machine", issuedAt.Add(-time.Second), ErrNotYetValid},
+		{"other license", "LIC-ABCDE-FGHJK-LMNPR-5", "machine", issuedAt.Add(time.Hour), ErrMismatch},
+		{"key hash instead of the key", claims.KeyHash, "machine", issuedAt.Add(time.Hour), ErrMismatch},
+		{"other machine", testKey, "other", issuedAt.Add(time.Hour), ErrMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := claims.Check(tt.license, tt.hwid, tt.now); !errors.Is(err, tt.want) {
+				t.Errorf("Check() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyHash(t *testing.T) {
+	// SHA-256 of the key, so clients in other languages can compute it too
+	const want = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	if got := KeyHash("hello"); got != want {
+		t.Errorf("KeyHash(%q) = %s, want %s", "hello", got, want)
+	}
+}
@@ -0,0 +1,154 @@
+// Package licensefile issues and verifies Ed25519-signed license documents.
+//
+// It has no dependencies outside the standard library so client applications can
+// embed it and check a license file fully offline, with only the server's public key:
+//
+//	doc, err := licensefile.Verify(file, publicKey)
+//	if err == nil {
+//		err = doc.Check(myHWID, time.Now())
+//	}
+//
+// A license file is a single line "LF1.<payload>.<signature>" where payload is the
+// base64url encoded JSON Document and signature is the base64url encoded Ed25519
+// signature over "LF1.<payload>".
+package licensefile
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dzhisl/license-manager/pkg/internal/envelope"
+)
+
+// Version is the document format this package issues
+const Version = 1
+
+// header identifies the format and version of a license file
+const header = "LF1"
+
+var (
+	ErrMalformed          = errors.New("licensefile: malformed license file")
+	ErrUnsupportedVersion = errors.New("licensefile: unsupported version")
+	ErrBadSignature       = errors.New("licensefile: signature verification failed")
+	ErrExpired            = errors.New("licensefile: license expired")
+	ErrHWIDMismatch       = errors.New("licensefile: license is bound to a different machine")
+)
+
+// Entitlement is a named feature, optionally with a numeric limit
+type Entitlement struct {
+	Feature string `json:"feature"`
+	Limit   *int64 `json:"limit,omitempty"`
+}
+
+// Document is the signed content of a license file. It names the license by its ID and the
+// display prefix of its key, the key itself is never part of a file.
+type Document struct {
+	Version   int    `json:"v"`
+	LicenseId int64  `json:"license_id"`
+	KeyPrefix string `json:"key_prefix,omitempty"`
+	UserId    string `json:"user_id"`
+	Product   string `json:"product,omitempty"`
+	HWID      string `json:"hwid"`
+	// Type is "subscription", "trial" or "perpetual"
+	Type     string    `json:"type,omitempty"`
+	IssuedAt time.Time `json:"issued_at"`
+	// ExpiresAt is nil for perpetual licenses, which never expire
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// GraceEndsAt is set when the license keeps working for a while after ExpiresAt
+	GraceEndsAt *time.Time `json:"grace_ends_at,omitempty"`
+	// UpdatesUntil is the last release date a perpetual license covers, see CoversRelease
+	UpdatesUntil *time.Time    `json:"updates_until,omitempty"`
+	Entitlements []Entitlement `json:"entitlements,omitempty"`
+}
+
+// Sign encodes doc and signs it with the server's private key
+func Sign(doc Document, key ed25519.PrivateKey) (string, error) {
+	doc.Version = Version
+
+	file, err := envelope.Seal(header, doc, key)
+	if err != nil {
+		return "", fmt.Errorf("licensefile: %w", err)
+	}
+
+	return file, nil
+}
+
+// Verify checks the signature of a license file and returns its document.
+// It does not check expiry or HWID, use Document.Check for that.
+func Verify(file string, publicKey ed25519.PublicKey) (*Document, error) {
+	var doc Document
+	switch err := envelope.Open(file, header, publicKey, &doc); {
+	case errors.Is(err, envelope.ErrWrongHeader):
+		return nil, ErrUnsupportedVersion
+	case errors.Is(err, envelope.ErrBadSignature):
+		return nil, ErrBadSignature
+	case err != nil:
+		return nil, ErrMalformed
+	}
+	if doc.Version != Version {
+		return nil, ErrUnsupportedVersion
+	}
+
+	return &doc, nil
+}
+
+// Check reports whether the document is usable on the machine with the given HWID at time now.
+// A license in its grace period passes, use InGrace to warn the user about it.
+func (d *Document) Check(hwid string, now time.Time) error {
+	if d.HWID != hwid {
+		return ErrHWIDMismatch
+	}
+	if usableUntil := d.usableUntil(); usableUntil != nil && now.After(*usableUntil) {
+		return ErrExpired
+	}
+	return nil
+}
+
+// InGrace reports whether the license has expired at time now but is still in its grace period
+func (d *Document) InGrace(now time.Time) bool {
+	if d.ExpiresAt == nil {
+		return false
+	}
+	return now.After(*d.ExpiresAt) && !now.After(*d.usableUntil())
+}
+
+// CoversRelease reports whether the license covers a build released at releasedAt,
+// perpetual licenses may only include updates released until UpdatesUntil
+func (d *Document) CoversRelease(releasedAt time.Time) bool {
+	return d.UpdatesUntil == nil || !releasedAt.After(*d.UpdatesUntil)
+}
+
+// Feature returns the entitlement named feature, false if the license doesn't grant it
+func (d *Document) Feature(feature string) (Entitlement, bool) {
+	for _, entitlement := range d.Entitlements {
+		if entitlement.Feature == feature {
+			return entitlement, true
+		}
+	}
+	return Entitlement{}, false
+}
+
+// usableUntil returns when the license stops working, nil if it never does
+func (d *Document) usableUntil() *time.Time {
+	if d.GraceEndsAt != nil {
+		return d.GraceEndsAt
+	}
+	return d.ExpiresAt
+}
+
+// ParsePublicKey decodes a standard base64 encoded Ed25519 public key,
+// the form the server publishes it in
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("licensefile: invalid public key: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("licensefile: invalid public key length %d", len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
@@ -0,0 +1,200 @@
+package licensefile
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return publicKey, privateKey
+}
+
+func testDocument() Document {
+	expiresAt := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	limit := int64(5)
+	return Document{
+		LicenseId:    7,
+		KeyPrefix:    "LIC-GYL",
+		UserId:       "alice",
+		Product:      "APP",
+		HWID:         "machine",
+		Type:         "subscription",
+		IssuedAt:     time.Date(2029, time.January, 1, 0, 0, 0, 0, time.UTC),
+		ExpiresAt:    &expiresAt,
+		Entitlements: []Entitlement{{Feature: "seats", Limit: &limit}},
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	publicKey, privateKey := newKey(t)
+
+	file, err := Sign(testDocument(), privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(file, header+".") {
+		t.Fatalf("file %q doesn't start with %s", file, header)
+	}
+
+	doc, err := Verify(file, publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Version != Version || doc.LicenseId != 7 || doc.KeyPrefix != "LIC-GYL" || doc.HWID != "machine" {
+		t.Errorf("got %+v", doc)
+	}
+	if seats, ok := doc.Feature("seats"); !ok || seats.Limit == nil || *seats.Limit != 5 {
+		t.Errorf("seats = %+v, %t", seats, ok)
+	}
+	if _, ok := doc.Feature("export"); ok {
+		t.Error("found a feature the license doesn't grant")
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	publicKey, privateKey := newKey(t)
+	otherPublicKey, _ := newKey(t)
+
+	file, err := Sign(testDocument(), privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(file, ".")
+
+	tampered := testDocument()
+	tampered.HWID = "other"
+	tamperedFile, err := Sign(tampered, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tamperedPayload := strings.Split(tamperedFile, ".")[1]
+
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	signature[0] ^= 1
+
+	tests := []struct {
+		name      string
+		file      string
+		publicKey ed25519.PublicKey
+		want      error
+	}{
+		{"wrong key", file, otherPublicKey, ErrBadSignature},
+		{"tampered payload", parts[0] + "." + tamperedPayload + "." + parts[2], publicKey, ErrBadSignature},
+		{"tampered signature", parts[0] + "." + parts[1] + "." + base64.RawURLEncoding.EncodeToString(signature), publicKey, ErrBadSignature},
+		{"other header", "LT1." + parts[1] + "." + parts[2], publicKey, ErrUnsupportedVersion},
+		{"missing signature", parts[0] + "." + parts[1], publicKey, ErrMalformed},
+		{"signature not base64", parts[0] + "." + parts[1] + ".!!!", publicKey, ErrMalformed},
+		{"empty", "", publicKey, ErrMalformed},
+		{"truncated public key", file, publicKey[:16], ErrBadSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Verify(tt.file, tt.publicKey); !errors.Is(err, tt.want) {
+				t.Errorf("Verify() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsOtherVersions(t *testing.T) {
+	publicKey, privateKey := newKey(t)
+
+	// Sign always stamps the current version, seal another one the way it would
+	file, err := Sign(testDocument(), privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, _ := base64.RawURLEncoding.DecodeString(strings.Split(file, ".")[1])
+	payload = []byte(strings.Replace(string(payload), `"v":1`, `"v":2`, 1))
+	signed := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	file = signed + "." + base64.RawURLEncoding.EncodeToString(ed25519.Sign(privateKey, []byte(signed)))
+
+	if _, err := Verify(file, publicKey); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("Verify() = %v, want %v", err, ErrUnsupportedVersion)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	expiresAt := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	graceEndsAt := expiresAt.AddDate(0, 0, 7)
+
+	subscription := testDocument()
+	graced := testDocument()
+	graced.GraceEndsAt = &graceEndsAt
+	perpetual := testDocument()
+	perpetual.ExpiresAt = nil
+
+	tests := []struct {
+		name    string
+		doc     Document
+		hwid    string
+		now     time.Time
+		want    error
+		inGrace bool
+	}{
+		{"valid", subscription, "machine", expiresAt.Add(-time.Hour), nil, false},
+		{"at expiry", subscription, "machine", expiresAt, nil, false},
+		{"expired", subscription, "machine", expiresAt.Add(time.Second), ErrExpired, false},
+		{"other machine", subscription, "other", expiresAt.Add(-time.Hour), ErrHWIDMismatch, false},
+		{"in grace", graced, "machine", expiresAt.Add(time.Hour), nil, true},
+		{"grace over", graced, "machine", graceEndsAt.Add(time.Second), ErrExpired, false},
+		{"perpetual", perpetual, "machine", expiresAt.AddDate(100, 0, 0), nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.doc.Check(tt.hwid, tt.now); !errors.Is(err, tt.want) {
+				t.Errorf("Check() = %v, want %v", err, tt.want)
+			}
+			if got := tt.doc.InGrace(tt.now); got != tt.inGrace {
+				t.Errorf("InGrace() = %t, want %t", got, tt.inGrace)
+			}
+		})
+	}
+}
+
+func TestCoversRelease(t *testing.T) {
+	updatesUntil := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	doc := testDocument()
+	doc.UpdatesUntil = &updatesUntil
+
+	if !doc.CoversRelease(updatesUntil) {
+		t.Error("a release on the last covered day isn't covered")
+	}
+	if doc.CoversRelease(updatesUntil.Add(time.Second)) {
+		t.Error("a later release is covered")
+	}
+	unlimited := testDocument()
+	if !unlimited.CoversRelease(updatesUntil.AddDate(10, 0, 0)) {
+		t.Error("a license without an updates limit doesn't cover a release")
+	}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	publicKey, _ := newKey(t)
+
+	got, err := ParsePublicKey(" " + base64.StdEncoding.EncodeToString(publicKey) + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(publicKey) {
+		t.Error("parsed a different key")
+	}
+
+	for _, s := range []string{"", "not base64!", base64.StdEncoding.EncodeToString(publicKey[:16])} {
+		if _, err := ParsePublicKey(s); err == nil {
+			t.Errorf("ParsePublicKey(%q) succeeded", s)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Package reqsign signs and verifies requests to the admin API with HMAC-SHA256.
+//
+// An API key created with request signing only accepts signed requests. Instead of sending
+// the key itself, the caller sends the ID of the key and a signature made with its signing
+// secret over the method, path with query, a hash of the body, a timestamp and a nonce.
+// A leaked request can't be replayed: the server rejects timestamps outside its allowed
+// clock skew and nonces it has already seen.
+//
+//	req, _ := http.NewRequest(http.MethodPost, baseURL+"/freeze-license", body)
+//	err := reqsign.SignRequest(req, apiKeyId, signingSecret, time.Now())
+//
+// The signed string is, joined by newlines:
+//
+//	METHOD
+//	/path?query
+//	hex(sha256(body))
+//	unix timestamp in seconds
+//	nonce
+package reqsign
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers of a signed request
+const (
+	HeaderKeyId     = "X-Key-Id"
+	HeaderTimestamp = "X-Timestamp"
+	HeaderNonce     = "X-Nonce"
+	HeaderSignature = "X-Signature"
+)
+
+var (
+	ErrBadSignature = errors.New("reqsign: signature verification failed")
+	ErrStale        = errors.New("reqsign: timestamp outside the allowed clock skew")
+)
+
+// Signature returns the hex encoded HMAC-SHA256 of the request made with secret
+func Signature(secret, method, path string, body []byte, timestamp int64, nonce string) string {
+	bodyHash := sha256.Sum256(body)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%d\n%s", method, path, hex.EncodeToString(bodyHash[:]), timestamp, nonce)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks signature in constant time
+func Verify(secret, method, path string, body []byte, timestamp int64, nonce, signature string) error {
+	expected := Signature(secret, method, path, body, timestamp, nonce)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// CheckTimestamp reports whether timestamp is within maxSkew of now
+func CheckTimestamp(timestamp int64, now time.Time, maxSkew time.Duration) error {
+	skew := now.Sub(time.Unix(timestamp, 0))
+	if skew < -maxSkew || skew > maxSkew {
+		return ErrStale
+	}
+	return nil
+}
+
+// SignRequest sets the signing headers on req with a fresh nonce, the body is read and put back
+func SignRequest(req *http.Request, keyId int64, secret string, now time.Time) error {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return fmt.Errorf("reqsign: %w", err)
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Errorf("reqsign: %w", err)
+	}
+	nonce := hex.EncodeToString(b)
+	timestamp := now.Unix()
+
+	req.Header.Set(HeaderKeyId, strconv.FormatInt(keyId, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderNonce, nonce)
+	req.Header.Set(HeaderSignature, Signature(secret, req.Method, req.URL.RequestURI(), body, timestamp, nonce))
+	return nil
+}
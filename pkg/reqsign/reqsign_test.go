@@ -0,0 +1,151 @@
+package reqsign
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2030, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+// signedRequest returns a POST request with body signed by SignRequest
+func signedRequest(t *testing.T, body string) *http.Request {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, "https://licenses.example.com/freeze-license?reason=chargeback", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SignRequest(req, 42, "secret", now); err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestSignRequest(t *testing.T) {
+	const body = `{"license_id":7}`
+	req := signedRequest(t, body)
+
+	if got := req.Header.Get(HeaderKeyId); got != "42" {
+		t.Errorf("%s = %q, want 42", HeaderKeyId, got)
+	}
+	if got := req.Header.Get(HeaderTimestamp); got != strconv.FormatInt(now.Unix(), 10) {
+		t.Errorf("%s = %q, want %d", HeaderTimestamp, got, now.Unix())
+	}
+	if nonce := req.Header.Get(HeaderNonce); len(nonce) != 32 {
+		t.Errorf("%s = %q, want 32 hex characters", HeaderNonce, nonce)
+	}
+
+	// The body can still be sent after signing
+	sent, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(sent) != body {
+		t.Errorf("body %q after signing, want %q", sent, body)
+	}
+
+	timestamp, _ := strconv.ParseInt(req.Header.Get(HeaderTimestamp), 10, 64)
+	err = Verify("secret", req.Method, req.URL.RequestURI(), sent, timestamp, req.Header.Get(HeaderNonce), req.Header.Get(HeaderSignature))
+	if err != nil {
+		t.Errorf("Verify() = %v for a signed request", err)
+	}
+}
+
+func TestSignRequestUsesFreshNonces(t *testing.T) {
+	first := signedRequest(t, "{}")
+	second := signedRequest(t, "{}")
+
+	if first.Header.Get(HeaderNonce) == second.Header.Get(HeaderNonce) {
+		t.Error("two requests got the same nonce")
+	}
+	if first.Header.Get(HeaderSignature) == second.Header.Get(HeaderSignature) {
+		t.Error("two requests got the same signature")
+	}
+}
+
+func TestSignRequestWithoutBody(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://licenses.example.com/all-licenses", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SignRequest(req, 42, "secret", now); err != nil {
+		t.Fatal(err)
+	}
+
+	err = Verify("secret", http.MethodGet, "/all-licenses", nil, now.Unix(), req.Header.Get(HeaderNonce), req.Header.Get(HeaderSignature))
+	if err != nil {
+		t.Errorf("Verify() = %v for a signed request without a body", err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	const (
+		method = http.MethodPost
+		path   = "/freeze-license?reason=chargeback"
+		nonce  = "0123456789abcdef0123456789abcdef"
+	)
+	body := []byte(`{"license_id":7}`)
+	timestamp := now.Unix()
+	signature := Signature("secret", method, path, body, timestamp, nonce)
+
+	tests := []struct {
+		name      string
+		secret    string
+		method    string
+		path      string
+		body      []byte
+		timestamp int64
+		nonce     string
+		signature string
+		want      error
+	}{
+		{"valid", "secret", method, path, body, timestamp, nonce, signature, nil},
+		{"wrong secret", "other", method, path, body, timestamp, nonce, signature, ErrBadSignature},
+		{"other method", "secret", http.MethodGet, path, body, timestamp, nonce, signature, ErrBadSignature},
+		{"other path", "secret", method, "/del-license?reason=chargeback", body, timestamp, nonce, signature, ErrBadSignature},
+		{"other query", "secret", method, "/freeze-license?reason=other", body, timestamp, nonce, signature, ErrBadSignature},
+		{"tampered body", "secret", method, path, []byte(`{"license_id":8}`), timestamp, nonce, signature, ErrBadSignature},
+		{"other timestamp", "secret", method, path, body, timestamp + 1, nonce, signature, ErrBadSignature},
+		{"other nonce", "secret", method, path, body, timestamp, "fedcba9876543210fedcba9876543210", signature, ErrBadSignature},
+		{"tampered signature", "secret", method, path, body, timestamp, nonce, "0" + signature[1:], ErrBadSignature},
+		{"upper case signature", "secret", method, path, body, timestamp, nonce, strings.ToUpper(signature), ErrBadSignature},
+		{"no signature", "secret", method, path, body, timestamp, nonce, "", ErrBadSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.method, tt.path, tt.body, tt.timestamp, tt.nonce, tt.signature)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Verify() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckTimestamp(t *testing.T) {
+	tests := []struct {
+		name      string
+		timestamp time.Time
+		want      error
+	}{
+		{"now", now, nil},
+		{"at the skew", now.Add(-5 * time.Minute), nil},
+		{"at the skew ahead", now.Add(5 * time.Minute), nil},
+		{"too old", now.Add(-5*time.Minute - time.Second), ErrStale},
+		{"too far ahead", now.Add(5*time.Minute + time.Second), ErrStale},
+		{"zero", time.Unix(0, 0), ErrStale},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckTimestamp(tt.timestamp.Unix(), now, 5*time.Minute); !errors.Is(err, tt.want) {
+				t.Errorf("CheckTimestamp(%v) = %v, want %v", tt.timestamp, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+// Package validation signs and verifies the result of a /validate-license call.
+//
+// Every validation response carries a "signed" object whose payload states the outcome,
+// the license key, HWID and nonce from the request, and the server time. Client software
+// verifies it with the server's public key (published at /.well-known/license-signing-key),
+// so a local proxy can't fake a successful answer:
+//
+//	result, err := validation.Verify(resp.Signed, publicKey)
+//	if err == nil {
+//		err = result.Check(key, hwid, nonce, time.Now(), time.Minute)
+//	}
+//	licensed := err == nil && result.Valid
+//
+// Responses without a valid signature must be treated as a failed validation.
+package validation
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// header separates validation signatures from other documents signed with the same key
+const header = "VR1."
+
+var (
+	ErrMalformed     = errors.New("validation: malformed signed result")
+	ErrBadSignature  = errors.New("validation: signature verification failed")
+	ErrMismatch      = errors.New("validation: result does not match the request")
+	ErrStaleResponse = errors.New("validation: response timestamp outside the allowed window")
+)
+
+// Result is what the server asserts about a validation request
+type Result struct {
+	Valid bool `json:"valid"`
+	// Status is "valid", "grace" for a license past its expiry date that still works
+	// until GraceEndsAt, or the reason validation failed, e.g. "expired" or "activation_limit"
+	Status    string    `json:"status"`
+	License   string    `json:"license"`
+	HWID      string    `json:"hwid"`
+	Nonce     string    `json:"nonce"`
+	Timestamp time.Time `json:"timestamp"`
+	// Type is "subscription", "trial" or "perpetual", perpetual licenses have no ExpiresAt
+	Type        string     `json:"type,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	GraceEndsAt *time.Time `json:"grace_ends_at,omitempty"`
+	// UpdatesUntil is the last release date a perpetual license covers
+	UpdatesUntil *time.Time `json:"updates_until,omitempty"`
+	// Entitlements are the features the license grants, see Result.Feature
+	Entitlements []Entitlement `json:"entitlements,omitempty"`
+}
+
+// Entitlement is a named feature, optionally with a numeric limit
+type Entitlement struct {
+	Feature string `json:"feature"`
+	Limit   *int64 `json:"limit,omitempty"`
+}
+
+// Feature returns the entitlement named feature, false if the license doesn't grant it
+func (r *Result) Feature(feature string) (Entitlement, bool) {
+	for _, entitlement := range r.Entitlements {
+		if entitlement.Feature == feature {
+			return entitlement, true
+		}
+	}
+	return Entitlement{}, false
+}
+
+// Signed is the wire form of a Result
+type Signed struct {
+	Payload   string `json:"payload"`   // base64url encoded JSON Result
+	Signature string `json:"signature"` // base64url encoded Ed25519 signature over "VR1." + Payload
+}
+
+// Sign encodes the result and signs it with the server's private key
+func Sign(result Result, key ed25519.PrivateKey) (Signed, error) {
+	payload, err := json.Marshal(result)
+	if err != nil {
+		return Signed{}, fmt.Errorf("validation: %w", err)
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	signature := ed25519.Sign(key, []byte(header+encoded))
+
+	return Signed{Payload: encoded, Signature: base64.RawURLEncoding.EncodeToString(signature)}, nil
+}
+
+// Verify checks the signature and returns the signed result.
+// Use Result.Check to make sure it answers the request that was actually sent.
+func Verify(signed Signed, publicKey ed25519.PublicKey) (*Result, error) {
+	signature, err := base64.RawURLEncoding.DecodeString(signed.Signature)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	if len(publicKey) != ed25519.PublicKeySize || !ed25519.Verify(publicKey, []byte(header+signed.Payload), signature) {
+		return nil, ErrBadSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(signed.Payload)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	var result Result
+	if err := json.Unmarshal(payload, &result); err != nil {
+		return nil, ErrMalformed
+	}
+
+	return &result, nil
+}
+
+// Check reports whether the result answers a request for license, hwid and nonce,
+// and was produced within maxSkew of now
+func (r *Result) Check(license, hwid, nonce string, now time.Time, maxSkew time.Duration) error {
+	if r.License != license || r.HWID != hwid || r.Nonce != nonce {
+		return ErrMismatch
+	}
+
+	skew := now.Sub(r.Timestamp)
+	if skew < -maxSkew || skew > maxSkew {
+		return ErrStaleResponse
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package validation
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return publicKey, privateKey
+}
+
+var now = time.Date(2030, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+func testResult() Result {
+	limit := int64(5)
+	return Result{
+		Valid:        true,
+		Status:       "valid",
+		License:      "LIC-ABCDE-FGHJK-LMNPQ-5",
+		HWID:         "machine",
+		Nonce:        "nonce",
+		Timestamp:    now,
+		Type:         "subscription",
+		Entitlements: []Entitlement{{Feature: "seats", Limit: &limit}},
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	publicKey, privateKey := newKey(t)
+
+	signed, err := Sign(testResult(), privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Verify(signed, publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Valid || result.Status != "valid" || result.License != "LIC-ABCDE-FGHJK-LMNPQ-5" || !result.Timestamp.Equal(now) {
+		t.Errorf("got %+v", result)
+	}
+	if seats, ok := result.Feature("seats"); !ok || seats.Limit == nil || *seats.Limit != 5 {
+		t.Errorf("seats = %+v, %t", seats, ok)
+	}
+	if _, ok := result.Feature("export"); ok {
+		t.Error("found a feature the license doesn't grant")
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	publicKey, privateKey := newKey(t)
+	otherPublicKey, _ := newKey(t)
+
+	signed, err := Sign(testResult(), privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed validation signed by the server can't be turned into a successful one
+	failed := testResult()
+	failed.Valid = false
+	failed.Status = "expired"
+	signedFailed, err := Sign(failed, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature, _ := base64.RawURLEncoding.DecodeString(signed.Signature)
+	signature[0] ^= 1
+
+	// Documents signed with the same key under another header don't pass as results
+	otherHeader := base64.RawURLEncoding.EncodeToString(ed25519.Sign(privateKey, []byte("LF1."+signed.Payload)))
+
+	tests := []struct {
+		name      string
+		signed    Signed
+		publicKey ed25519.PublicKey
+		want      error
+	}{
+		{"wrong key", signed, otherPublicKey, ErrBadSignature},
+		{"tampered payload", Signed{Payload: signed.Payload, Signature: signedFailed.Signature}, publicKey, ErrBadSignature},
+		{"swapped payload", Signed{Payload: signedFailed.Payload, Signature: signed.Signature}, publicKey, ErrBadSignature},
+		{"tampered signature", Signed{Payload: signed.Payload, Signature: base64.RawURLEncoding.EncodeToString(signature)}, publicKey, ErrBadSignature},
+		{"other header", Signed{Payload: signed.Payload, Signature: otherHeader}, publicKey, ErrBadSignature},
+		{"signature not base64", Signed{Payload: signed.Payload, Signature: "!!!"}, publicKey, ErrMalformed},
+		{"unsigned", Signed{Payload: signed.Payload}, publicKey, ErrBadSignature},
+		{"empty", Signed{}, publicKey, ErrBadSignature},
+		{"truncated public key", signed, publicKey[:16], ErrBadSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Verify(tt.signed, tt.publicKey); !errors.Is(err, tt.want) {
+				t.Errorf("Verify() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsSignedGarbage(t *testing.T) {
+	publicKey, privateKey := newKey(t)
+
+	payload := base64.RawURLEncoding.EncodeToString([]byte("not json"))
+	signature := base64.RawURLEncoding.EncodeToString(ed25519.Sign(privateKey, []byte(header+payload)))
+
+	if _, err := Verify(Signed{Payload: payload, Signature: signature}, publicKey); !errors.Is(err, ErrMalformed) {
+		t.Errorf("Verify() = %v, want %v", err, ErrMalformed)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	result := testResult()
+
+	tests := []struct {
+		name    string
+		license string
+		hwid    string
+		nonce   string
+		now     time.Time
+		want    error
+	}{
+		{"matches", result.License, "machine", "nonce", now, nil},
+		{"within skew", result.License, "machine", "nonce", now.Add(time.Minute), nil},
+		{"within skew before", result.License, "machine", "nonce", now.Add(-time.Minute), nil},
+		{"stale", result.License, "machine", "nonce", now.Add(time.Minute + time.Second), ErrStaleResponse},
+		{"from the future", result.License, "machine", "nonce", now.Add(-time.Minute - time.Second), ErrStaleResponse},
+		{"other license", "LIC-ABCDE-FGHJK-LMNPR-5", "machine", "nonce", now, ErrMismatch},
+		{"other machine", result.License, "other", "nonce", now, ErrMismatch},
+		{"other nonce", result.License, "machine", "replayed", now, ErrMismatch},
+		{"no nonce", result.License, "machine", "", now, ErrMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := result.Check(tt.license, tt.hwid, tt.nonce, tt.now, time.Minute); !errors.Is(err, tt.want) {
+				t.Errorf("Check() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}